@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/credentials"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+	"golang.org/x/term"
+)
+
+// passphraseEnv unlocks the encrypted credential store without a prompt.
+const passphraseEnv = "MERCURY_PASSPHRASE"
+
+func newAuthCmd(app *appState, specDocs []*openapi.SpecDoc) *cobra.Command {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Store and inspect API tokens",
+		Long: "Store and inspect API tokens.\n\n" +
+			"'mercury auth login' saves a token for the selected profile so it does not have to\n" +
+			"live in MERCURY_TOKEN or a shell rc file. Tokens are kept in credentials.enc next to\n" +
+			"the config file, encrypted with a key derived from a passphrase (prompted for, or\n" +
+			"read from " + passphraseEnv + "). Set credential_helper on a profile to hand\n" +
+			"storage to an external program instead, in the style of git's credential.helper:\n" +
+			"it is run as '<helper> get|store|erase' with profile= and token= lines on stdin.\n\n" +
+			"'mercury auth oauth login' obtains a token through Mercury's OAuth2 server instead\n" +
+			"and stores it the same way, together with its refresh token.\n\n" +
+			"The stored token is used when neither --token, MERCURY_TOKEN nor a profile token\n" +
+			"source is set.\n\n" +
+			"Examples:\n" +
+			"  mercury auth login\n" +
+			"  op read op://vault/mercury/token | mercury --profile holdco auth login --with-token\n" +
+			"  mercury auth status\n",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	authCmd.AddCommand(newAuthLoginCmd(app))
+	authCmd.AddCommand(newAuthLogoutCmd(app))
+	authCmd.AddCommand(newAuthStatusCmd(app))
+	authCmd.AddCommand(newAuthOAuthCmd(app, specDocs))
+
+	return authCmd
+}
+
+func newAuthLoginCmd(app *appState) *cobra.Command {
+	var withToken bool
+	cmd := &cobra.Command{
+		Use:           "login",
+		Short:         "Store an API token for the selected profile",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var token string
+			var err error
+			if f, ok := terminalInput(cmd); ok && !withToken {
+				token, err = promptSecret(f, cmd.ErrOrStderr(), "Mercury API token: ")
+			} else {
+				token, err = readLine(cmd.InOrStdin())
+			}
+			if err != nil {
+				return err
+			}
+			if token == "" {
+				return errors.New("no token provided")
+			}
+
+			store := app.credentialStore(cmd)
+			name := app.credentialName()
+			if err := store.Set(name, credentials.Credential{Token: token}); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Stored token for profile %q in %s\n", name, store.Describe())
+			if app.profile != nil && app.profile.HasTokenSource() {
+				fmt.Fprintf(cmd.ErrOrStderr(), "note: profile %q also sets a token source, which takes precedence\n", name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&withToken, "with-token", false, "Read the token from stdin instead of prompting")
+	return cmd
+}
+
+func newAuthLogoutCmd(app *appState) *cobra.Command {
+	return &cobra.Command{
+		Use:           "logout",
+		Short:         "Remove the stored API token for the selected profile",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := app.credentialStore(cmd)
+			name := app.credentialName()
+			if err := store.Delete(name); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Removed stored token for profile %q\n", name)
+			return nil
+		},
+	}
+}
+
+func newAuthStatusCmd(app *appState) *cobra.Command {
+	return &cobra.Command{
+		Use:           "status",
+		Short:         "Show which token would be used and where it comes from",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rt, err := cligen.RuntimeFrom(cmd)
+			if err != nil {
+				return err
+			}
+			token, err := rt.ResolveToken(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "profile: %s\n", app.credentialName())
+			fmt.Fprintf(out, "env: %s\n", app.opts.Env)
+			if token == "" {
+				fmt.Fprintln(out, "token: none")
+				return errors.New("not logged in (run 'mercury auth login' or set MERCURY_TOKEN)")
+			}
+			fmt.Fprintf(out, "token: %s\n", maskToken(token))
+			fmt.Fprintf(out, "source: %s\n", app.tokenOrigin(cmd))
+			if d := app.stored.describe(); d != "" {
+				fmt.Fprintf(out, "oauth: %s\n", d)
+			}
+			return nil
+		},
+	}
+}
+
+// credentialName is the key tokens are stored under: the selected profile, or
+// "default" when no config profile exists.
+func (a *appState) credentialName() string {
+	if a.profileName != "" {
+		return a.profileName
+	}
+	return "default"
+}
+
+// credentialStore returns the profile's credential helper if configured, else the
+// encrypted file next to the config file.
+func (a *appState) credentialStore(cmd *cobra.Command) credentials.Store {
+	if a.profile != nil && a.profile.CredentialHelper != "" {
+		return credentials.NewHelperStore(a.profile.CredentialHelper)
+	}
+	var fs *credentials.FileStore
+	fs = credentials.NewFileStore(filepath.Join(filepath.Dir(a.configPath), "credentials.enc"), func() (string, error) {
+		return readPassphrase(cmd, !fs.Exists())
+	})
+	return fs
+}
+
+// tokenOrigin describes where the token returned by tokenSource comes from.
+func (a *appState) tokenOrigin(cmd *cobra.Command) string {
+	switch {
+	case a.opts.Token != "" && a.opts.Token == os.Getenv("MERCURY_TOKEN"):
+		return "MERCURY_TOKEN"
+	case a.opts.Token != "":
+		return "--token flag"
+	case a.profile != nil && a.profile.TokenEnv != "":
+		return fmt.Sprintf("profile %q token_env $%s", a.profileName, a.profile.TokenEnv)
+	case a.profile != nil && a.profile.TokenCommand != "":
+		return fmt.Sprintf("profile %q token_command", a.profileName)
+	case a.profile != nil && a.profile.Token != "":
+		return fmt.Sprintf("profile %q token", a.profileName)
+	default:
+		return a.credentialStore(cmd).Describe()
+	}
+}
+
+func readPassphrase(cmd *cobra.Command, confirm bool) (string, error) {
+	if v := os.Getenv(passphraseEnv); v != "" {
+		return v, nil
+	}
+	f, ok := terminalInput(cmd)
+	if !ok {
+		return "", fmt.Errorf("credential store is locked: set %s or run in a terminal", passphraseEnv)
+	}
+	pass, err := promptSecret(f, cmd.ErrOrStderr(), "Credential store passphrase: ")
+	if err != nil || !confirm {
+		return pass, err
+	}
+	again, err := promptSecret(f, cmd.ErrOrStderr(), "Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != pass {
+		return "", errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
+
+// terminalInput returns the command's stdin when it is an interactive terminal.
+func terminalInput(cmd *cobra.Command) (*os.File, bool) {
+	f, ok := cmd.InOrStdin().(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil, false
+	}
+	return f, true
+}
+
+func promptSecret(in *os.File, w io.Writer, prompt string) (string, error) {
+	fmt.Fprint(w, prompt)
+	b, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(w)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", 8) + token[len(token)-4:]
+}
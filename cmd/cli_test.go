@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"io"
@@ -11,14 +12,41 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/mock"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+	"github.com/tarrence/mercury-cli/internal/webhooks"
 )
 
 func newTestRoot(t *testing.T) (*bytes.Buffer, *bytes.Buffer, func(args ...string) error) {
+	t.Helper()
+	return newTestRootWithConfig(t, filepath.Join(t.TempDir(), "config.toml"))
+}
+
+func newTestRootWithConfig(t *testing.T, configPath string) (*bytes.Buffer, *bytes.Buffer, func(args ...string) error) {
+	t.Helper()
+	root, out, errBuf := newTestRootCmd(t, configPath)
+	run := func(args ...string) error {
+		root.SetArgs(args)
+		return root.Execute()
+	}
+	return out, errBuf, run
+}
+
+// newTestRootCmd isolates the environment the way newTestRootWithConfig does
+// and returns the root command itself, for tests that drive it directly.
+func newTestRootCmd(t *testing.T, configPath string) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
 	t.Helper()
 	t.Setenv("MERCURY_TOKEN", "")
 	t.Setenv("MERCURY_ENV", "")
+	t.Setenv("MERCURY_PROFILE", "")
+	t.Setenv("MERCURY_CONFIG", configPath)
+	t.Setenv("MERCURY_NO_RESOLVE", "")
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 
 	root, err := NewRootCmd()
 	if err != nil {
@@ -28,12 +56,7 @@ func newTestRoot(t *testing.T) (*bytes.Buffer, *bytes.Buffer, func(args ...strin
 	var errBuf bytes.Buffer
 	root.SetOut(&out)
 	root.SetErr(&errBuf)
-
-	run := func(args ...string) error {
-		root.SetArgs(args)
-		return root.Execute()
-	}
-	return &out, &errBuf, run
+	return root, &out, &errBuf
 }
 
 func TestQueryFlagAliases(t *testing.T) {
@@ -86,14 +109,14 @@ func TestJSONBody(t *testing.T) {
 	t.Cleanup(srv.Close)
 
 	_, errBuf, run := newTestRoot(t)
-	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "create-recipient", "--data", `{"name":"x"}`)
+	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "create-recipient", "--data", `{"name":"x","emails":["x@example.com"]}`)
 	if err != nil {
 		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
 	}
 	if !strings.HasPrefix(gotCT, "application/json") {
 		t.Fatalf("expected JSON Content-Type, got %q", gotCT)
 	}
-	if string(gotBody) != `{"name":"x"}` {
+	if string(gotBody) != `{"name":"x","emails":["x@example.com"]}` {
 		t.Fatalf("unexpected body: %q", string(gotBody))
 	}
 }
@@ -164,7 +187,7 @@ func TestMultipartUpload(t *testing.T) {
 	t.Cleanup(srv.Close)
 
 	_, errBuf, run := newTestRoot(t)
-	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "upload-recipient-attachment", "r_123",
+	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--no-resolve", "recipients", "upload-recipient-attachment", "r_123",
 		"--form", "note=hi",
 		"--form", "file=@"+fpath,
 	)
@@ -336,3 +359,1278 @@ func TestMultipartServerParseSanity(t *testing.T) {
 		t.Fatal("bad file")
 	}
 }
+
+func TestJSONBodyFieldFlags(t *testing.T) {
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	_, errBuf, run := newTestRoot(t)
+	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "create-recipient",
+		"--data", `{"name":"base","nickname":"nick"}`,
+		"--name", "Acme",
+		"--emails", "a@example.com",
+		"--emails", "b@example.com",
+		"--electronic-routing-info.account-number", "123",
+		"--electronic-routing-info.routing-number", "021000021",
+		"--electronic-routing-info.electronic-account-type", "businessChecking",
+		"--electronic-routing-info.address.address1", "1 Main St",
+		"--electronic-routing-info.address.city", "SF",
+		"--electronic-routing-info.address.region", "CA",
+		"--electronic-routing-info.address.postal-code", "94107",
+		"--electronic-routing-info.address.country", "US",
+	)
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if gotBody["name"] != "Acme" || gotBody["nickname"] != "nick" {
+		t.Fatalf("expected flags to override --data base, got %v", gotBody)
+	}
+	emails, _ := gotBody["emails"].([]any)
+	if len(emails) != 2 || emails[1] != "b@example.com" {
+		t.Fatalf("unexpected emails: %v", gotBody["emails"])
+	}
+	eri, _ := gotBody["electronicRoutingInfo"].(map[string]any)
+	addr, _ := eri["address"].(map[string]any)
+	if eri["accountNumber"] != "123" || addr["postalCode"] != "94107" {
+		t.Fatalf("unexpected nested body: %v", gotBody)
+	}
+}
+
+func TestJSONBodyFieldFlagShadowedByGlobal(t *testing.T) {
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	// The body's status would collide with the global --status.
+	_, errBuf, run := newTestRoot(t)
+	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--no-resolve", "webhooks", "update-webhook", "wh_1", "--body-status", "paused")
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if gotBody["status"] != "paused" {
+		t.Fatalf("expected status from --body-status, got %v", gotBody)
+	}
+}
+
+func TestJSONBodyFieldFlagsValidation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	{
+		_, _, run := newTestRoot(t)
+		err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "create-recipient", "--name", "Acme")
+		if err == nil || !strings.Contains(err.Error(), "--emails") {
+			t.Fatalf("expected missing --emails error, got %v", err)
+		}
+	}
+	{
+		_, _, run := newTestRoot(t)
+		err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "create-recipient",
+			"--name", "Acme", "--emails", "a@example.com",
+			"--electronic-routing-info.electronic-account-type", "checking")
+		if err == nil || !strings.Contains(err.Error(), "businessChecking") {
+			t.Fatalf("expected enum error, got %v", err)
+		}
+	}
+	{
+		_, _, run := newTestRoot(t)
+		err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "recipients", "create-recipient",
+			"--name", "Acme", "--emails", "a@example.com", "--address.city", "SF")
+		if err == nil || !strings.Contains(err.Error(), "--address.address1") {
+			t.Fatalf("expected nested required error, got %v", err)
+		}
+	}
+}
+
+func TestJSONBodyValidation(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	body := `{"recipientId":"r1","amount":0,"paymentMethod":"wire","idempotencyKey":"k"}`
+
+	_, _, run := newTestRoot(t)
+	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--no-resolve", "accounts", "create-transaction", "acc_1", "--data", body)
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, want := range []string{"/amount: must be >= 0.01", `/paymentMethod: value "wire"`, `/recipientId: invalid uuid "r1"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in error, got:\n%v", want, err)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("expected no request to be sent, got %d", calls)
+	}
+
+	_, errBuf, run := newTestRoot(t)
+	err = run("--token", "t", "--base-url", srv.URL+"/api/v1", "--no-resolve", "accounts", "create-transaction", "acc_1", "--data", body, "--skip-validation")
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if calls != 1 {
+		t.Fatalf("expected request with --skip-validation, got %d calls", calls)
+	}
+}
+
+func TestValidateResponseReportsDrift(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[{"id":"3fa85f64-5717-4562-b3fc-2c963f66afa6","name":"Ops","status":"frozenSolid","availableBalance":"12"}],"page":{"nextPage":null,"previousPage":null}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, errBuf, run := newTestRoot(t)
+	err := run("--token", "t", "--validate-response", "--base-url", srv.URL+"/api/v1", "accounts", "get-accounts")
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if out.Len() == 0 {
+		t.Fatalf("expected stdout body")
+	}
+	stderr := errBuf.String()
+	for _, want := range []string{
+		"response does not match spec (GET /api/v1/accounts -> 200)",
+		"/accounts/0/accountNumber: is required",
+		`/accounts/0/status: value "frozenSolid" is not one of`,
+		"/accounts/0/availableBalance: expected number, got string",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Fatalf("expected %q in stderr, got:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestSpecCheckResponses(t *testing.T) {
+	var oauthQuery url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/oauth2/auth":
+			oauthQuery = r.URL.Query()
+			io.WriteString(w, `{}`)
+		case "/api/v1/account/acc_1/transactions":
+			io.WriteString(w, `{"total":1,"transactions":[{"id":"t1","kind":"mysteryKind"}]}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	out, _, run := newTestRoot(t)
+	err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "spec", "check-responses",
+		"--path-param", "accountId=acc_1",
+		"--only", "accounts/list-account-transactions",
+		"--only", "accounts/get-account-cards",
+		"--only", "accounts/get-transaction",
+	)
+	if err == nil {
+		t.Fatalf("expected drift error (out=%s)", out.String())
+	}
+	got := out.String()
+	for _, want := range []string{
+		"drift\taccounts/list-account-transactions",
+		`/transactions/0/kind: value "mysteryKind" is not one of`,
+		"skip\taccounts/get-transaction\tmissing path parameter transactionId",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+
+	// Required query parameters without a declared example must be given.
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "spec", "check-responses",
+		"--only", "oauth2/start-oauth2-flow"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "skip\toauth2/start-oauth2-flow\tmissing required query parameter client_id"; !strings.Contains(out.String(), want) || oauthQuery != nil {
+		t.Fatalf("expected %q and no request, got:\n%s", want, out.String())
+	}
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "spec", "check-responses",
+		"--only", "oauth2/start-oauth2-flow", "--query-param", "client_id=c1",
+		"--query-param", "redirect_uri=https://example.com/cb", "--query-param", "response_type=code"); err != nil {
+		t.Fatalf("%v (out=%s)", err, out.String())
+	}
+	if oauthQuery.Get("client_id") != "c1" || oauthQuery.Get("response_type") != "code" {
+		t.Fatalf("unexpected query %v (out=%s)", oauthQuery, out.String())
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[],"page":{"nextPage":null,"previousPage":null}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgPath := filepath.Join(t.TempDir(), "mercury", "config.toml")
+	t.Setenv("HOLDCO_TOKEN", "holdco-secret")
+
+	for _, args := range [][]string{
+		{"--profile", "holdco", "config", "set", "base_url", srv.URL + "/api/v1"},
+		{"--profile", "holdco", "config", "set", "token_env", "HOLDCO_TOKEN"},
+		{"--profile", "opco", "config", "set", "env", "sandbox"},
+		{"config", "use", "holdco"},
+	} {
+		_, _, run := newTestRootWithConfig(t, cfgPath)
+		if err := run(args...); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	if fi, err := os.Stat(cfgPath); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected config file with mode 0600, got %v, %v", fi, err)
+	}
+
+	{
+		out, _, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("config", "list"); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "* holdco") || !strings.Contains(out.String(), "  opco\tenv=sandbox") {
+			t.Fatalf("unexpected config list output:\n%s", out.String())
+		}
+	}
+
+	// config get redacts a stored token unless asked not to.
+	{
+		_, _, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("--profile", "opco", "config", "set", "token", "opco-secret"); err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			args []string
+			want string
+		}{
+			{[]string{"config", "get", "token"}, "<redacted>\n"},
+			{[]string{"config", "get"}, "env=sandbox\ntoken=<redacted>\n"},
+			{[]string{"config", "get", "token", "--show-secret"}, "opco-secret\n"},
+		} {
+			out, _, run := newTestRootWithConfig(t, cfgPath)
+			if err := run(append([]string{"--profile", "opco"}, tc.args...)...); err != nil {
+				t.Fatalf("%v: %v", tc.args, err)
+			}
+			if out.String() != tc.want {
+				t.Fatalf("%v: got %q, want %q", tc.args, out.String(), tc.want)
+			}
+		}
+	}
+
+	// Active profile supplies base URL and token.
+	{
+		_, errBuf, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("accounts", "get-accounts"); err != nil {
+			t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+		}
+		if gotAuth != "Bearer holdco-secret" {
+			t.Fatalf("expected profile token, got %q", gotAuth)
+		}
+	}
+
+	// Environment overrides the profile; flags override the environment.
+	{
+		_, errBuf, run := newTestRootWithConfig(t, cfgPath)
+		t.Setenv("MERCURY_TOKEN", "env-token")
+		root, _ := NewRootCmd()
+		root.SetOut(io.Discard)
+		root.SetErr(errBuf)
+		root.SetArgs([]string{"accounts", "get-accounts"})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+		}
+		if gotAuth != "Bearer env-token" {
+			t.Fatalf("expected MERCURY_TOKEN to win over profile, got %q", gotAuth)
+		}
+		if err := run("--token", "flag-token", "accounts", "get-accounts"); err != nil {
+			t.Fatal(err)
+		}
+		if gotAuth != "Bearer flag-token" {
+			t.Fatalf("expected --token to win, got %q", gotAuth)
+		}
+	}
+
+	{
+		_, _, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("--profile", "missing", "accounts", "get-accounts"); err == nil || !strings.Contains(err.Error(), `profile "missing" not found`) {
+			t.Fatalf("expected missing profile error, got %v", err)
+		}
+	}
+}
+
+func TestAuthLoginStoresToken(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[],"page":{"nextPage":null,"previousPage":null}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.toml")
+	t.Setenv("MERCURY_PASSPHRASE", "correct horse")
+
+	{
+		root, _, errBuf := newTestRootCmd(t, cfgPath)
+		root.SetIn(strings.NewReader("stored-secret-1234\n"))
+		root.SetArgs([]string{"auth", "login", "--with-token"})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("login: %v (stderr=%s)", err, errBuf.String())
+		}
+	}
+	fi, err := os.Stat(filepath.Join(dir, "credentials.enc"))
+	if err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected credentials.enc with mode 0600, got %v, %v", fi, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "credentials.enc")); strings.Contains(string(b), "stored-secret") {
+		t.Fatalf("token stored in plaintext")
+	}
+
+	{
+		_, errBuf, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("--base-url", srv.URL+"/api/v1", "accounts", "get-accounts"); err != nil {
+			t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+		}
+		if gotAuth != "Bearer stored-secret-1234" {
+			t.Fatalf("expected stored token, got %q", gotAuth)
+		}
+	}
+
+	{
+		out, _, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("auth", "status"); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "token: ********1234") || !strings.Contains(out.String(), "source: encrypted file") {
+			t.Fatalf("unexpected status output:\n%s", out.String())
+		}
+	}
+
+	{
+		_, _, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("auth", "logout"); err != nil {
+			t.Fatal(err)
+		}
+		_, _, run = newTestRootWithConfig(t, cfgPath)
+		if err := run("auth", "status"); err == nil || !strings.Contains(err.Error(), "not logged in") {
+			t.Fatalf("expected not logged in after logout, got %v", err)
+		}
+	}
+}
+
+func TestAuthOAuthLoginRefreshesOn401(t *testing.T) {
+	var challenge, refreshes string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/auth", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		challenge = q.Get("code_challenge")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=c1&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge || r.PostForm.Get("client_id") != "cli" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, `{"access_token":"access-1","refresh_token":"refresh-1","token_type":"Bearer","expires_in":3600}`)
+		case "refresh_token":
+			refreshes += r.PostForm.Get("refresh_token") + ";"
+			io.WriteString(w, `{"access_token":"access-2","token_type":"Bearer","expires_in":3600}`)
+		}
+	})
+	var gotAuth []string
+	mux.HandleFunc("/api/v1/accounts", func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer access-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[],"page":{"nextPage":null,"previousPage":null}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	prev := openBrowser
+	openBrowser = func(u string) error {
+		resp, err := http.Get(u)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	t.Cleanup(func() { openBrowser = prev })
+
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+	t.Setenv("MERCURY_PASSPHRASE", "pw")
+
+	{
+		_, errBuf, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("auth", "oauth", "login", "--client-id", "cli", "--scope", "offline_access", "--oauth-url", srv.URL); err != nil {
+			t.Fatalf("oauth login: %v (stderr=%s)", err, errBuf.String())
+		}
+	}
+
+	// The stored access token is rejected; the client refreshes and retries once.
+	{
+		_, errBuf, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("--base-url", srv.URL+"/api/v1", "accounts", "get-accounts"); err != nil {
+			t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+		}
+		if strings.Join(gotAuth, ",") != "Bearer access-1,Bearer access-2" || refreshes != "refresh-1;" {
+			t.Fatalf("unexpected auth sequence %v (refreshes=%q)", gotAuth, refreshes)
+		}
+	}
+
+	// The refreshed token was written back to the store.
+	{
+		gotAuth = nil
+		_, errBuf, run := newTestRootWithConfig(t, cfgPath)
+		if err := run("--base-url", srv.URL+"/api/v1", "accounts", "get-accounts"); err != nil {
+			t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+		}
+		if strings.Join(gotAuth, ",") != "Bearer access-2" {
+			t.Fatalf("expected persisted refreshed token, got %v", gotAuth)
+		}
+	}
+}
+
+func TestOutputTable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[{"id":"a1","name":"Checking","status":"active","createdAt":"2024-01-01T00:00:00Z","availableBalance":12.5},{"id":"a2","name":"Savings","status":"active","createdAt":"2024-02-01T00:00:00Z","availableBalance":1000}],"page":{"nextPage":null,"previousPage":null}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, errBuf, run := newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--output", "table", "accounts", "get-accounts"); err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	want := "id  name      status  createdAt\n" +
+		"a1  Checking  active  2024-01-01T00:00:00Z\n" +
+		"a2  Savings   active  2024-02-01T00:00:00Z\n"
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--output", "table", "--columns", "id,availableBalance", "accounts", "get-accounts", "--all"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "id  availableBalance\na1  12.5\na2  1000\n" {
+		t.Fatalf("unexpected --columns output:\n%s", out.String())
+	}
+
+	_, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--output", "yaml", "accounts", "get-accounts"); err == nil || !strings.Contains(err.Error(), "invalid --output") {
+		t.Fatalf("expected invalid --output error, got %v", err)
+	}
+}
+
+func TestOutputCSVStreamsPages(t *testing.T) {
+	var pages int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/accounts" {
+			io.WriteString(w, `{"accounts":[{"id":"acc_1","nickname":"Ops"}]}`)
+			return
+		}
+		pages++
+		switch r.URL.Query().Get("offset") {
+		case "0":
+			io.WriteString(w, `{"total":3,"transactions":[{"id":"t1","amount":-12.5,"kind":"externalTransfer","details":{"address":{"city":"SF"}}},{"id":"t2","amount":100,"kind":"other"}]}`)
+		default:
+			io.WriteString(w, `{"total":3,"transactions":[{"id":"t3","amount":7,"kind":"other"}]}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// The account is given by name: it is looked up once, not per page.
+	out, errBuf, run := newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL, "--output", "csv", "--columns", "id,amount,kind,details.address.city",
+		"accounts", "list-account-transactions", "ops", "--all"); err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	want := "id,amount,kind,details.address.city\n" +
+		"t1,-12.5,externalTransfer,SF\n" +
+		"t2,100,other,\n" +
+		"t3,7,other,\n"
+	if out.String() != want || pages != 2 {
+		t.Fatalf("got (pages=%d):\n%s\nwant:\n%s", pages, out.String(), want)
+	}
+
+	// Without --columns the header comes from the response schema.
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL, "--output", "tsv", "accounts", "list-account-transactions", "acc_1", "--all"); err != nil {
+		t.Fatal(err)
+	}
+	header := strings.Split(strings.SplitN(out.String(), "\n", 2)[0], "\t")
+	for _, col := range []string{"id", "amount", "kind", "details.address.city", "counterpartyName"} {
+		if !slices.Contains(header, col) {
+			t.Fatalf("expected %q in schema-derived header %v", col, header)
+		}
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("start_after") == "" {
+			io.WriteString(w, `{"accounts":[{"id":"a1","name":"Checking","status":"active","availableBalance":12.5},{"id":"a2","name":"Old","status":"archived","availableBalance":0}],"page":{"nextPage":"a2","previousPage":null}}`)
+			return
+		}
+		io.WriteString(w, `{"accounts":[{"id":"a3","name":"Savings","status":"active","availableBalance":1000}],"page":{"nextPage":null,"previousPage":"a2"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	base := srv.URL + "/api/v1"
+
+	out, errBuf, run := newTestRoot(t)
+	if err := run("--token", "t", "--base-url", base, "--no-pretty", "--query", `[.accounts[] | select(.status == "active") | .id] | length`, "accounts", "get-accounts"); err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if out.String() != "1\n" {
+		t.Fatalf("got %q", out.String())
+	}
+
+	// With --all --ndjson the query runs against each item.
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", base, "--ndjson", "--query", `select(.availableBalance > 10) | {id, name}`, "accounts", "get-accounts", "--all"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"a1","name":"Checking"}` + "\n" + `{"id":"a3","name":"Savings"}` + "\n"
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// Query results feed table output.
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", base, "--output", "table", "--query", `.accounts | map({id, balance: .availableBalance})`, "accounts", "get-accounts"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "id  balance\na1  12.5\na2  0\n" {
+		t.Fatalf("unexpected table output:\n%s", out.String())
+	}
+
+	_, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--query", ".accounts[", "accounts", "get-accounts"); err == nil || !strings.HasPrefix(err.Error(), "--query:") {
+		t.Fatalf("expected --query parse error, got %v", err)
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[{"id":"a1","name":"Checking","availableBalance":1200.5},{"id":"a2","name":"Savings","availableBalance":98000}],"page":{"nextPage":null,"previousPage":null}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, errBuf, run := newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1",
+		"--template", `{{range .accounts}}{{.name}} {{.availableBalance}}{{"\n"}}{{end}}`, "accounts", "get-accounts"); err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if out.String() != "Checking 1200.5\nSavings 98000\n" {
+		t.Fatalf("got %q", out.String())
+	}
+
+	tmplPath := filepath.Join(t.TempDir(), "summary.tmpl")
+	if err := os.WriteFile(tmplPath, []byte("{{range .accounts}}*{{padRight 8 .name}}* {{money .availableBalance}}\n{{end}}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--template", "@"+tmplPath, "accounts", "get-accounts"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "*Checking* $1,200.50\n*Savings * $98,000.00\n" {
+		t.Fatalf("got %q", out.String())
+	}
+
+	_, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--output", "table", "--template", "{{.}}", "accounts", "get-accounts"); err == nil || !strings.Contains(err.Error(), "cannot combine --template") {
+		t.Fatalf("expected --template/--output conflict, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	t.Cleanup(srv.Close)
+
+	out, errBuf, run := newTestRoot(t)
+	err := run("--token", "secret-token", "--base-url", srv.URL+"/api/v1", "--dry-run", "recipients", "create-recipient",
+		"--data", `{"name":"Acme","emails":["ap@acme.example"]}`)
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	var got struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    map[string]any    `json:"body"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("dry run output is not JSON: %v\n%s", err, out.String())
+	}
+	if calls != 0 {
+		t.Fatalf("expected no requests, got %d", calls)
+	}
+	if got.Method != http.MethodPost || got.URL != srv.URL+"/api/v1/recipients" || got.Body["name"] != "Acme" {
+		t.Fatalf("unexpected dry run request: %+v", got)
+	}
+	if got.Headers["Authorization"] != "Bearer <redacted>" || !strings.HasPrefix(got.Headers["Content-Type"], "application/json") || got.Headers["Accept"] != "application/json" {
+		t.Fatalf("unexpected headers: %v", got.Headers)
+	}
+	if strings.Contains(out.String(), "secret-token") {
+		t.Fatalf("token leaked into dry run output:\n%s", out.String())
+	}
+
+	// --all prints only the first page request.
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--dry-run", "--no-pretty", "accounts", "get-accounts", "--all", "--limit", "50"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"query":{"limit":["50"]}`) || calls != 0 {
+		t.Fatalf("unexpected --all dry run (calls=%d):\n%s", calls, out.String())
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	var keys []string
+	fail := 0 // number of upcoming requests answered with a 503
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		k, _ := body["idempotencyKey"].(string)
+		keys = append(keys, k)
+		if fail > 0 {
+			fail--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgPath := filepath.Join(t.TempDir(), "mercury", "config.toml")
+	journal := filepath.Join(filepath.Dir(cfgPath), "idempotency.json")
+	transfer := func(amount string) error {
+		_, _, run := newTestRootWithConfig(t, cfgPath)
+		return run("--token", "t", "--base-url", srv.URL+"/api/v1", "accounts", "create-internal-transfer",
+			"--source-account-id", "11111111-1111-4111-8111-111111111111",
+			"--destination-account-id", "22222222-2222-4222-8222-222222222222",
+			"--amount", amount)
+	}
+
+	// A POST with a generated key is retried, with the same key.
+	fail = 1
+	if err := transfer("10"); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("expected one retry with the same key, got %q", keys)
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Fatalf("expected the journal entry to be removed after success (stat err = %v)", err)
+	}
+
+	// After a failed run, a re-run of the same command reuses the key...
+	keys, fail = nil, 5
+	if err := transfer("20"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected HTTP 503, got %v", err)
+	}
+	if err := transfer("20"); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 6 || keys[5] != keys[0] {
+		t.Fatalf("expected the re-run to reuse key %q, got %q", keys[0], keys[5])
+	}
+
+	// ...but a new successful run of the same command gets a new key.
+	if err := transfer("20"); err != nil {
+		t.Fatal(err)
+	}
+	if keys[6] == keys[0] {
+		t.Fatalf("expected a new key once the earlier attempt succeeded, got %q again", keys[6])
+	}
+
+	// A request that fails local validation is never sent and leaves no entry.
+	sent := len(keys)
+	if err := transfer("0"); err == nil || !strings.Contains(err.Error(), "failed validation") {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(keys) != sent {
+		t.Fatalf("an invalid request was sent")
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Fatalf("expected no journal entry for an unsent request (stat err = %v)", err)
+	}
+
+	// An explicit key is sent as given and not journaled.
+	_, _, run := newTestRootWithConfig(t, cfgPath)
+	fail = 1
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "accounts", "create-internal-transfer",
+		"--data", `{"sourceAccountId":"11111111-1111-4111-8111-111111111111","destinationAccountId":"22222222-2222-4222-8222-222222222222","amount":5,"idempotencyKey":"mine"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys[len(keys)-2:]; got[0] != "mine" || got[1] != "mine" {
+		t.Fatalf("expected the explicit key to be sent and retried, got %q", got)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[{"id":"a1","accountNumber":"123456789"}],"page":{}}`)
+	}))
+	dir := t.TempDir()
+
+	out, errBuf, run := newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--record", dir, "accounts", "get-accounts", "--limit", "1"); err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if !strings.Contains(out.String(), "123456789") {
+		t.Fatalf("recording should not change the live output:\n%s", out.String())
+	}
+	srv.Close()
+
+	// Replaying needs neither the server nor a token.
+	out, errBuf, run = newTestRoot(t)
+	if err := run("--base-url", srv.URL+"/api/v1", "--replay", dir, "--replay-strict", "--query", ".accounts[0]", "accounts", "get-accounts", "--limit", "1"); err != nil {
+		t.Fatalf("replay: %v (stderr=%s)", err, errBuf.String())
+	}
+	if strings.TrimSpace(out.String()) != `{"accountNumber":"<redacted>","id":"a1"}` {
+		t.Fatalf("unexpected replayed output:\n%s", out.String())
+	}
+
+	_, _, run = newTestRoot(t)
+	err := run("--base-url", srv.URL+"/api/v1", "--replay", dir, "--replay-strict", "accounts", "get-accounts", "--limit", "2")
+	if err == nil || !strings.Contains(err.Error(), "no recorded response for GET /api/v1/accounts?limit=2") {
+		t.Fatalf("expected strict replay miss, got %v", err)
+	}
+}
+
+func TestMockServer(t *testing.T) {
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := mock.NewServer(docs, mock.Options{Items: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	for _, args := range [][]string{
+		{"accounts", "get-accounts", "--limit", "2", "--all"},
+		{"--no-resolve", "accounts", "list-account-transactions", "acc_1", "--limit", "2", "--all"},
+		{"--no-resolve", "books", "get-books-journal-entries", "b1", "--limit", "2", "--all"},
+	} {
+		out, errBuf, run := newTestRoot(t)
+		if err := run(append([]string{"--token", "t", "--base-url", srv.URL + "/api/v1", "--ndjson", "--validate-response"}, args...)...); err != nil {
+			t.Fatalf("%v: %v (stderr=%s)", args, err, errBuf.String())
+		}
+		if n := strings.Count(out.String(), "\n"); n != 5 {
+			t.Fatalf("%v: got %d items, want 5:\n%s", args, n, out.String())
+		}
+		if errBuf.Len() > 0 {
+			t.Fatalf("%v: unexpected stderr:\n%s", args, errBuf.String())
+		}
+	}
+
+	_, _, run := newTestRoot(t)
+	if err := run("mock", "serve", "--port", "70000"); err == nil || !strings.Contains(err.Error(), "--port") {
+		t.Fatalf("expected --port error, got %v", err)
+	}
+}
+
+func TestWebhooksReplay(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.ndjson")
+	for _, body := range []string{
+		`{"id":"e1","resourceType":"transaction","operationType":"create"}`,
+		`{"id":"e2","resourceType":"checkingAccount","operationType":"update"}`,
+		`{"id":"e3","resourceType":"transaction","operationType":"create"}`,
+	} {
+		d := webhooks.Delivery{Headers: map[string]string{webhooks.SignatureHeader: "t=1,v1=stale"}, Body: json.RawMessage(body)}
+		if err := webhooks.AppendLog(logPath, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	target := httptest.NewServer(&webhooks.Receiver{
+		Secret: "whsec",
+		OnDelivery: func(d webhooks.Delivery, _ int, _ error) error {
+			got = append(got, d.EventID())
+			return nil
+		},
+	})
+	t.Cleanup(target.Close)
+
+	_, errBuf, run := newTestRoot(t)
+	if err := run("webhooks", "replay", logPath, "--to", target.URL, "--secret", "whsec", "--event-type", "transaction.created"); err != nil {
+		t.Fatalf("replay: %v (stderr=%s)", err, errBuf.String())
+	}
+	if !slices.Equal(got, []string{"e1", "e3"}) || !strings.Contains(errBuf.String(), "transaction.created e1: HTTP 200") {
+		t.Fatalf("got %v, stderr:\n%s", got, errBuf.String())
+	}
+
+	// Without --secret the recorded, now stale, signatures are sent and rejected.
+	_, _, run = newTestRoot(t)
+	if err := run("webhooks", "replay", logPath, "--to", target.URL, "--id", "e2"); err == nil || !strings.Contains(err.Error(), "1 of 1 deliveries failed") {
+		t.Fatalf("expected a failed replay, got %v", err)
+	}
+	_, _, run = newTestRoot(t)
+	if err := run("webhooks", "replay", logPath, "--to", target.URL, "--id", "nope"); err == nil || !strings.Contains(err.Error(), "no deliveries") {
+		t.Fatalf("expected no matches, got %v", err)
+	}
+}
+
+func TestWebhooksTrigger(t *testing.T) {
+	var got []webhooks.Delivery
+	target := httptest.NewServer(&webhooks.Receiver{
+		Secret: "whsec",
+		OnDelivery: func(d webhooks.Delivery, _ int, _ error) error {
+			got = append(got, d)
+			return nil
+		},
+	})
+	t.Cleanup(target.Close)
+
+	out, errBuf, run := newTestRoot(t)
+	if err := run("webhooks", "trigger", "checkingAccount.balance.updated", "--to", target.URL, "--secret", "whsec"); err != nil {
+		t.Fatalf("trigger: %v (stderr=%s)", err, errBuf.String())
+	}
+	if len(got) != 1 || !got[0].Verified || got[0].EventType() != "checkingAccount.balance.updated" {
+		t.Fatalf("unexpected deliveries: %+v", got)
+	}
+	if strings.TrimSpace(out.String()) != string(got[0].Body) || !strings.Contains(errBuf.String(), ": HTTP 200") {
+		t.Fatalf("stdout=%s stderr=%s", out.String(), errBuf.String())
+	}
+
+	fixture := filepath.Join(t.TempDir(), "event.json")
+	if err := os.WriteFile(fixture, []byte(`{"id":"fx","resourceType":"transaction","operationType":"create"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MERCURY_WEBHOOK_SECRET", "whsec")
+	_, errBuf, run = newTestRoot(t)
+	if err := run("webhooks", "trigger", "--file", fixture, "--to", target.URL); err != nil {
+		t.Fatalf("trigger --file: %v (stderr=%s)", err, errBuf.String())
+	}
+	if len(got) != 2 || got[1].EventID() != "fx" || !got[1].Verified {
+		t.Fatalf("fixture not delivered: %+v", got)
+	}
+
+	// A wrong secret is rejected by the receiver and reported.
+	_, _, run = newTestRoot(t)
+	if err := run("webhooks", "trigger", "transaction.created", "--to", target.URL, "--secret", "wrong"); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Fatalf("expected HTTP 401, got %v", err)
+	}
+	_, _, run = newTestRoot(t)
+	if err := run("webhooks", "trigger", "card.created"); err == nil || !strings.Contains(err.Error(), "transaction.updated") {
+		t.Fatalf("expected unknown event type error, got %v", err)
+	}
+}
+
+func TestShellHistorySkipsSecrets(t *testing.T) {
+	h := &shellHistory{path: filepath.Join(t.TempDir(), "shell_history")}
+	for _, line := range []string{
+		"set token abc",
+		"set --token=abc",
+		"config set token abc",
+		"mercury config set TOKEN abc",
+		"accounts get-accounts --token abc",
+		"webhooks listen --secret=whsec",
+		"oauth2 obtain-access-token --client-secret s --refresh-token r",
+		`accounts get-account 'unterminated`,
+		"config set token_env HOLDCO_TOKEN",
+		"accounts get-accounts --limit 5",
+		"set output table",
+	} {
+		h.Add(line)
+	}
+	b, err := os.ReadFile(h.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "config set token_env HOLDCO_TOKEN\naccounts get-accounts --limit 5\nset output table\n"; string(b) != want {
+		t.Fatalf("history:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestShell(t *testing.T) {
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := mock.NewServer(docs, mock.Options{Items: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	root, out, errBuf := newTestRootCmd(t, filepath.Join(t.TempDir(), "config.toml"))
+	root.SetIn(strings.NewReader(strings.Join([]string{
+		"accounts get-accounts",
+		"mercury accounts get-account $last.accounts[1].id",
+		"save acct",
+		"set output table",
+		"accounts get-account $acct.id --columns id,name",
+		"unset output",
+		"accounts get-account $acct.id --query .id",
+		"accounts get-account $missing",
+		`accounts get-account '$missing'`,
+		`accounts get-account $acct.id --query '"$acct.id"'`,
+		"set env nope",
+		"set",
+		"exit",
+		"accounts get-accounts",
+	}, "\n")))
+	root.SetArgs([]string{"--token", "t", "--base-url", srv.URL + "/api/v1", "--no-pretty", "shell"})
+	err = root.Execute()
+	if err == nil || err.Error() != "3 of 13 commands failed" {
+		t.Fatalf("unexpected result %v (stderr=%s)", err, errBuf.String())
+	}
+
+	var list struct {
+		Accounts []struct {
+			ID string `json:"id"`
+		} `json:"accounts"`
+	}
+	first, _, _ := strings.Cut(out.String(), "\n")
+	if err := json.Unmarshal([]byte(first), &list); err != nil || len(list.Accounts) != 2 {
+		t.Fatalf("unexpected first response %q: %v", first, err)
+	}
+	id := list.Accounts[1].ID
+	// '$missing' is looked up as a name, literally, and matches no account.
+	want := []string{"/api/v1/accounts", "/api/v1/account/" + id, "/api/v1/account/" + id, "/api/v1/account/" + id, "/api/v1/accounts", "/api/v1/account/" + id}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("requests %v, want %v", paths, want)
+	}
+	// "set output table" applies until "unset output"; --columns only to its line.
+	if table := "\nid    " + id + "\nname  Example name\n\"" + id + "\"\n"; !strings.Contains(out.String(), table) {
+		t.Fatalf("expected %q in output:\n%s", table, out.String())
+	}
+	// Single quotes keep "$" literal.
+	if !strings.Contains(out.String(), "\n\"$acct.id\"\n") {
+		t.Fatalf("expected the single-quoted query's literal output:\n%s", out.String())
+	}
+	// The rejected "set env nope" leaves env unset.
+	if strings.Contains(out.String(), "env =") || !strings.Contains(out.String(), "base-url = "+srv.URL) || !strings.Contains(out.String(), "token = (set)") {
+		t.Fatalf("unexpected settings:\n%s", out.String())
+	}
+	for _, s := range []string{"undefined variable $missing", `accountId: no account named "$missing"`, `set env: invalid --env "nope"`} {
+		if !strings.Contains(errBuf.String(), s) {
+			t.Fatalf("expected %q in stderr:\n%s", s, errBuf.String())
+		}
+	}
+
+	sh := &shell{root: root}
+	for line, want := range map[string][]string{
+		"acc":                            {"accounts"},
+		"accounts get-accou":             {"get-account", "get-account-cards", "get-account-statements", "get-accounts"},
+		"accounts get-accounts --li":     {"--limit"},
+		"set en":                         {"env"},
+		"webhooks trigger transaction.c": {"transaction.created"},
+		"ex":                             {"exit"},
+	} {
+		if _, got := sh.completions(line); !slices.Equal(got, want) {
+			t.Fatalf("completions(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestCompletePathArgs(t *testing.T) {
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := mock.NewServer(docs, mock.Options{Items: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, errBuf, run := newTestRoot(t)
+	complete := func(args ...string) []string {
+		t.Helper()
+		out.Reset()
+		if err := run(append([]string{"__complete", "--token", "t", "--base-url", srv.URL + "/api/v1"}, args...)...); err != nil {
+			t.Fatalf("__complete %v: %v (stderr=%s)", args, err, errBuf.String())
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if last := lines[len(lines)-1]; last != ":4" {
+			t.Fatalf("__complete %v: unexpected directive %q", args, last)
+		}
+		return lines[:len(lines)-1]
+	}
+
+	ids := complete("accounts", "get-account", "")
+	if len(ids) != 2 || !strings.HasSuffix(ids[0], "\tExample nickname") {
+		t.Fatalf("unexpected account completions %q", ids)
+	}
+	id, _, _ := strings.Cut(ids[1], "\t")
+	// The list is cached, and filtered by what was typed.
+	if got := complete("accounts", "get-account", id[:8]); len(got) != 1 || got[0] != ids[1] {
+		t.Fatalf("prefix completions %q, want %q", got, ids[1])
+	}
+	if !slices.Equal(paths, []string{"/api/v1/accounts"}) {
+		t.Fatalf("requests %v, want one list", paths)
+	}
+	// Transactions of the given account.
+	if got := complete("accounts", "get-transaction", id, ""); len(got) != 2 || paths[1] != "/api/v1/account/"+id+"/transactions" {
+		t.Fatalf("transaction completions %q after %v", got, paths)
+	}
+
+	if got := complete("transactions", "list-transactions", "--status", ""); !slices.Contains(got, "pending") || !slices.Contains(got, "sent") {
+		t.Fatalf("unexpected --status completions %q", got)
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	const checking, savings = "8a1f7c3e-2b4d-4e6f-9a1b-3c5d7e9f1a2b", "c4e6a8b0-1d3f-4a5b-8c7d-9e1f2a3b4c5d"
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/accounts" {
+			io.WriteString(w, `{"accounts":[`+
+				`{"id":"`+checking+`","name":"Mercury Checking ••1234","nickname":"Ops Checking"},`+
+				`{"id":"`+savings+`","name":"Mercury Savings ••5678","nickname":"Ops Savings"}]}`)
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	_, errBuf, run := newTestRoot(t)
+	call := func(args ...string) error {
+		requests = nil
+		errBuf.Reset()
+		return run(append([]string{"--token", "t", "--base-url", srv.URL + "/api/v1"}, args...)...)
+	}
+
+	for _, tc := range []struct {
+		arg  string
+		want []string
+	}{
+		{"ops checking", []string{"/api/v1/accounts", "/api/v1/account/" + checking}},
+		// The list is cached for a while, and so are resolved names.
+		{"Mercury Sav", []string{"/api/v1/account/" + savings}},
+		{checking[:6], []string{"/api/v1/account/" + checking}},
+		// UUIDs are used as given.
+		{savings, []string{"/api/v1/account/" + savings}},
+	} {
+		if err := call("accounts", "get-account", tc.arg); err != nil {
+			t.Fatalf("get-account %q: %v (stderr=%s)", tc.arg, err, errBuf.String())
+		}
+		if !slices.Equal(requests, tc.want) {
+			t.Fatalf("get-account %q: requests %v, want %v", tc.arg, requests, tc.want)
+		}
+	}
+
+	err := call("accounts", "get-account", "Ops")
+	if err == nil || !strings.Contains(err.Error(), `accountId "Ops" is ambiguous`) ||
+		!strings.Contains(err.Error(), checking+" (Ops Checking)") || !strings.Contains(err.Error(), savings+" (Ops Savings)") {
+		t.Fatalf("expected an ambiguity error listing both accounts, got %v", err)
+	}
+	if len(requests) != 0 {
+		t.Fatalf("nothing should be sent for an ambiguous name: %v", requests)
+	}
+
+	// Flags that take IDs resolve names the same way.
+	if err := call("transactions", "list-transactions", "--account-id", "Ops Savings"); err != nil {
+		t.Fatalf("list-transactions: %v (stderr=%s)", err, errBuf.String())
+	}
+	if len(requests) != 1 || !strings.Contains(requests[0], "accountId="+savings) {
+		t.Fatalf("unexpected requests %v", requests)
+	}
+	if !strings.Contains(errBuf.String(), `Resolved --account-id "Ops Savings" to `+savings) {
+		t.Fatalf("expected a resolution note on stderr, got %q", errBuf.String())
+	}
+
+	// A name that matches nothing in a complete list is an error, not an ID.
+	err = call("accounts", "get-account", "Ops Payroll")
+	if err == nil || !strings.Contains(err.Error(), `accountId: no account named "Ops Payroll"`) || len(requests) != 0 {
+		t.Fatalf("expected a no-match error and no request, got %v (requests %v)", err, requests)
+	}
+
+	// Body fields take an exact name or ID only.
+	transfer := func(dest string) error {
+		return call("accounts", "create-internal-transfer", "--amount", "1",
+			"--source-account-id", "Ops Checking", "--destination-account-id", dest)
+	}
+	err = transfer("Ops Sav")
+	if err == nil || !strings.Contains(err.Error(), `--destination-account-id takes an exact destination account ID or name; "Ops Sav" only starts `+savings) {
+		t.Fatalf("expected a prefix to be refused for a body field, got %v", err)
+	}
+	if slices.Contains(requests, "/api/v1/transfer") {
+		t.Fatalf("nothing should be sent for a refused prefix: %v", requests)
+	}
+	// So do path arguments outside GETs, such as the account money leaves.
+	err = call("accounts", "create-transaction", "Ops Chec", "--data", `{"recipientId":"r","amount":1,"paymentMethod":"ach"}`)
+	if err == nil || !strings.Contains(err.Error(), `accountId takes an exact account ID or name; "Ops Chec" only starts `+checking) {
+		t.Fatalf("expected a prefix to be refused for a POST path argument, got %v", err)
+	}
+	if err := transfer("ops savings"); err != nil {
+		t.Fatalf("create-internal-transfer: %v (stderr=%s)", err, errBuf.String())
+	}
+	if !slices.Equal(requests, []string{"/api/v1/transfer"}) {
+		t.Fatalf("unexpected requests %v", requests)
+	}
+
+	// --no-resolve, or MERCURY_NO_RESOLVE, sends arguments as typed.
+	if err := call("--no-resolve", "accounts", "get-account", "payroll"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MERCURY_NO_RESOLVE", "1")
+	root, err := NewRootCmd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.SetOut(io.Discard)
+	root.SetArgs([]string{"--token", "t", "--base-url", srv.URL + "/api/v1", "accounts", "get-account", "ops"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/api/v1/account/payroll", "/api/v1/account/ops"}; !slices.Equal(requests, want) {
+		t.Fatalf("requests %v, want %v", requests, want)
+	}
+}
+
+func TestRequestSnippets(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	t.Cleanup(srv.Close)
+
+	fpath := filepath.Join(t.TempDir(), "w9.pdf")
+	if err := os.WriteFile(fpath, []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, errBuf, run := newTestRoot(t)
+	err := run("--token", "secret-token", "--base-url", srv.URL+"/api/v1", "--as-curl", "recipients", "upload-recipient-attachment", "r_123",
+		"--form", "note=hi", "--form", "file=@"+fpath)
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	for _, want := range []string{
+		"curl -X POST " + srv.URL + "/api/v1/recipient/r_123/attachments",
+		`-H "Authorization: Bearer $MERCURY_TOKEN"`,
+		"--form-string note=hi",
+		"-F file=@" + fpath,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "secret-token") || calls != 0 {
+		t.Fatalf("snippet leaked the token or sent the request (calls=%d):\n%s", calls, out.String())
+	}
+
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--as-httpie", "accounts", "get-accounts", "--limit", "5"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "http GET '"+srv.URL+"/api/v1/accounts?limit=5'") {
+		t.Fatalf("unexpected httpie snippet:\n%s", out.String())
+	}
+
+	out, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--base-url", srv.URL+"/api/v1", "--as-go", "accounts", "get-accounts"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "package main\n") || !strings.Contains(out.String(), `os.Getenv("MERCURY_TOKEN")`) {
+		t.Fatalf("unexpected Go snippet:\n%s", out.String())
+	}
+
+	_, _, run = newTestRoot(t)
+	if err := run("--token", "t", "--as-curl", "--as-go", "accounts", "get-accounts"); err == nil || !strings.Contains(err.Error(), "only one of") {
+		t.Fatalf("expected conflicting snippet flags error, got %v", err)
+	}
+}
+
+func TestFromCurl(t *testing.T) {
+	out, errBuf, run := newTestRoot(t)
+	err := run("from-curl", `curl --request GET \
+  --url 'https://api-sandbox.mercury.com/api/v1/account/acc_1/transactions?limit=5&status=pending' \
+  --header 'accept: application/json' \
+  --header 'Authorization: Bearer secret-token'`)
+	if err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if got := out.String(); got != "mercury --env sandbox accounts list-account-transactions acc_1 --limit 5 --status pending\n" {
+		t.Fatalf("got %q", got)
+	}
+
+	out, _, run = newTestRoot(t)
+	if err := run("from-curl", "--", "curl", "-X", "POST", "https://api.mercury.com/api/v1/recipients",
+		"-H", "Content-Type: application/json", "-d", `{"name":"Acme"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "mercury recipients create-recipient --data '{\"name\":\"Acme\"}'\n" {
+		t.Fatalf("got %q", got)
+	}
+
+	_, _, run = newTestRoot(t)
+	if err := run("from-curl", "curl https://api.mercury.com/api/v1/accounts?bogus=1"); err == nil || !strings.Contains(err.Error(), `no query parameter "bogus"`) {
+		t.Fatalf("expected unknown query parameter error, got %v", err)
+	}
+
+	// --run executes the translated command; an unknown host maps to --base-url.
+	var gotLimit string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLimit = r.URL.Query().Get("limit")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"accounts":[{"id":"a1"}],"page":{"nextPage":null,"previousPage":null}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, errBuf, run = newTestRoot(t)
+	if err := run("--token", "t", "--no-pretty", "from-curl", "--run", "curl "+srv.URL+"/api/v1/accounts?limit=7"); err != nil {
+		t.Fatalf("execute: %v (stderr=%s)", err, errBuf.String())
+	}
+	if gotLimit != "7" || !strings.Contains(out.String(), `"id":"a1"`) {
+		t.Fatalf("unexpected --run result (limit=%q):\n%s", gotLimit, out.String())
+	}
+}
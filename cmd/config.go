@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/config"
+)
+
+func newConfigCmd(app *appState) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage config profiles",
+		Long: "Manage config profiles.\n\n" +
+			"Profiles are stored in ~/.config/mercury/config.toml ($XDG_CONFIG_HOME and\n" +
+			"MERCURY_CONFIG override the location). Each profile may set:\n" +
+			"  " + strings.Join(config.Keys(), ", ") + "\n\n" +
+			"The active profile is chosen by --profile, then MERCURY_PROFILE, then\n" +
+			"current_profile in the file ('mercury config use'), then a profile named \"default\".\n" +
+			"Flags and MERCURY_TOKEN/MERCURY_ENV always override profile values.\n\n" +
+			"Examples:\n" +
+			"  mercury --profile holdco config set env sandbox\n" +
+			"  mercury --profile holdco config set token_env MERCURY_HOLDCO_TOKEN\n" +
+			"  mercury config use holdco\n",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		// Config commands only touch the file; skip the root's profile and client setup
+		// so a broken profile can still be repaired.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+
+	configCmd.AddCommand(newConfigListCmd(app))
+	configCmd.AddCommand(newConfigGetCmd(app))
+	configCmd.AddCommand(newConfigSetCmd(app))
+	configCmd.AddCommand(newConfigUseCmd())
+	configCmd.AddCommand(newConfigPathCmd())
+
+	return configCmd
+}
+
+func loadConfig() (string, *config.File, error) {
+	path, err := config.DefaultPath()
+	if err != nil {
+		return "", nil, err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, cfg, nil
+}
+
+// configProfileName is the profile that config get/set act on.
+func configProfileName(app *appState, cfg *config.File) string {
+	if app.opts.Profile != "" {
+		return app.opts.Profile
+	}
+	if cfg.CurrentProfile != "" {
+		return cfg.CurrentProfile
+	}
+	return "default"
+}
+
+func newConfigListCmd(app *appState) *cobra.Command {
+	return &cobra.Command{
+		Use:           "list",
+		Short:         "List profiles (* marks the active one)",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			active, _, _ := cfg.Select(app.opts.Profile)
+			for _, name := range cfg.ProfileNames() {
+				marker := " "
+				if name == active {
+					marker = "*"
+				}
+				var kv []string
+				p := cfg.Profiles[name]
+				for _, k := range config.Keys() {
+					v, _ := p.Get(k)
+					if v == "" {
+						continue
+					}
+					if k == "token" {
+						v = "<redacted>"
+					}
+					kv = append(kv, k+"="+v)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s\t%s\n", marker, name, strings.Join(kv, " "))
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigGetCmd(app *appState) *cobra.Command {
+	var showSecret bool
+	cmd := &cobra.Command{
+		Use:           "get [key]",
+		Short:         "Print a profile setting, or all settings of the profile (the token redacted)",
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			name := configProfileName(app, cfg)
+			p, ok := cfg.Profiles[name]
+			if !ok {
+				return fmt.Errorf("profile %q not found in config", name)
+			}
+			get := func(k string) (string, bool) {
+				v, ok := p.Get(k)
+				if k == "token" && v != "" && !showSecret {
+					v = "<redacted>"
+				}
+				return v, ok
+			}
+			if len(args) == 1 {
+				v, ok := get(args[0])
+				if !ok {
+					return fmt.Errorf("unknown config key %q (expected one of: %s)", args[0], strings.Join(config.Keys(), ", "))
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), v)
+				return nil
+			}
+			for _, k := range config.Keys() {
+				if v, _ := get(k); v != "" {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s=%s\n", k, v)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&showSecret, "show-secret", false, "Print the token instead of <redacted>")
+	return cmd
+}
+
+func newConfigSetCmd(app *appState) *cobra.Command {
+	return &cobra.Command{
+		Use:           "set <key> <value>",
+		Short:         "Set a profile setting (creates the profile if needed; empty value unsets)",
+		Args:          cobra.ExactArgs(2),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			name := configProfileName(app, cfg)
+			p, ok := cfg.Profiles[name]
+			if !ok {
+				p = &config.Profile{}
+				cfg.Profiles[name] = p
+			}
+			if err := p.Set(args[0], args[1]); err != nil {
+				return err
+			}
+			return cfg.Save(path)
+		},
+	}
+}
+
+func newConfigUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "use <profile>",
+		Short:         "Make a profile the default for future commands",
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if _, ok := cfg.Profiles[args[0]]; !ok {
+				return fmt.Errorf("profile %q not found in config (create it with: mercury --profile %s config set env prod)", args[0], args[0])
+			}
+			cfg.CurrentProfile = args[0]
+			return cfg.Save(path)
+		},
+	}
+}
+
+func newConfigPathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "path",
+		Short:         "Print the config file location",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := config.DefaultPath()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), path)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+	"github.com/tarrence/mercury-cli/internal/snippet"
+)
+
+func newFromCurlCmd(specDocs []*openapi.SpecDoc) *cobra.Command {
+	var run bool
+	cmd := &cobra.Command{
+		Use:   "from-curl [curl command]",
+		Short: "Translate a curl command into the matching mercury command",
+		Long: "Translate a curl command into the matching mercury command.\n\n" +
+			"The curl URL and method are matched against the operations in the embedded\n" +
+			"OpenAPI specs; path segments become arguments and query parameters, header\n" +
+			"parameters and the body become flags. The Authorization header is dropped: the\n" +
+			"generated command authenticates the usual way (--token, MERCURY_TOKEN or\n" +
+			"'mercury auth login').\n\n" +
+			"Pass the curl command as one quoted argument, after '--', or on stdin.\n\n" +
+			"Examples:\n" +
+			"  mercury from-curl 'curl https://api.mercury.com/api/v1/accounts?limit=10'\n" +
+			"  mercury from-curl -- curl -X POST https://api.mercury.com/api/v1/recipients -d @recipient.json\n" +
+			"  pbpaste | mercury from-curl --run\n",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			words := args
+			if len(args) <= 1 {
+				src := ""
+				if len(args) == 1 {
+					src = args[0]
+				} else {
+					b, err := io.ReadAll(cmd.InOrStdin())
+					if err != nil {
+						return err
+					}
+					src = string(b)
+				}
+				var err error
+				if words, err = snippet.SplitShell(src); err != nil {
+					return fmt.Errorf("parse curl command: %w", err)
+				}
+			}
+			c, err := snippet.ParseCurl(words)
+			if err != nil {
+				return fmt.Errorf("parse curl command: %w", err)
+			}
+
+			ops, err := cligen.ListOperations(specDocs)
+			if err != nil {
+				return err
+			}
+			mercuryArgs, err := curlToArgs(c, ops, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+
+			if !run {
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), snippet.ShellJoin(append([]string{"mercury"}, mercuryArgs...)))
+				return err
+			}
+			root := cmd.Root()
+			root.SetArgs(mercuryArgs)
+			return root.ExecuteContext(cmd.Context())
+		},
+	}
+	cmd.Flags().BoolVar(&run, "run", false, "Run the translated command instead of printing it")
+	return cmd
+}
+
+// curlToArgs maps a parsed curl command onto mercury arguments. Headers that are
+// neither operation parameters nor implied by the CLI are reported to warn and
+// dropped; query parameters the operation does not declare are an error.
+func curlToArgs(c *snippet.CurlCommand, ops []cligen.Operation, warn io.Writer) ([]string, error) {
+	m, err := cligen.MatchURL(ops, c.Method, c.URL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	switch {
+	case m.BaseURL != "":
+		args = append(args, "--base-url", m.BaseURL)
+	case m.Env == "sandbox":
+		args = append(args, "--env", "sandbox")
+	}
+	if c.User != "" || strings.HasPrefix(c.Header.Get("Authorization"), "Basic ") {
+		args = append(args, "--auth", "basic")
+	}
+	args = append(args, m.Group, m.Name)
+	args = append(args, m.PathArgs...)
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		flag, ok := m.ParamFlag("query", k)
+		if !ok {
+			return nil, fmt.Errorf("%s %s has no query parameter %q", m.Group, m.Name, k)
+		}
+		for _, v := range query[k] {
+			args = append(args, "--"+flag, v)
+		}
+	}
+
+	contentType := c.Header.Get("Content-Type")
+	headerNames := make([]string, 0, len(c.Header))
+	for k := range c.Header {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+	for _, k := range headerNames {
+		switch strings.ToLower(k) {
+		case "authorization", "user-agent", "content-length", "content-type":
+			continue
+		case "accept":
+			if strings.HasPrefix(c.Header.Get(k), "application/json") || c.Header.Get(k) == "*/*" {
+				continue
+			}
+		}
+		flag, ok := m.ParamFlag("header", k)
+		if !ok {
+			fmt.Fprintf(warn, "warning: ignoring header %s (not a parameter of %s %s)\n", k, m.Group, m.Name)
+			continue
+		}
+		for _, v := range c.Header.Values(k) {
+			args = append(args, "--"+flag, v)
+		}
+	}
+
+	switch {
+	case len(c.Form) > 0:
+		for _, f := range c.Form {
+			v := f.Value
+			if f.File {
+				v = "@" + v
+			}
+			args = append(args, "--form", f.Name+"="+v)
+		}
+	case isFormBody(contentType, c.Data):
+		vals, err := url.ParseQuery(c.Data)
+		if err != nil {
+			return nil, fmt.Errorf("parse form body: %w", err)
+		}
+		names := make([]string, 0, len(vals))
+		for k := range vals {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			for _, v := range vals[k] {
+				args = append(args, "--form", k+"="+v)
+			}
+		}
+	case c.Data != "":
+		args = append(args, "--data", c.Data)
+		if contentType != "" && !strings.HasPrefix(contentType, "application/json") {
+			args = append(args, "--content-type", contentType)
+		}
+	}
+	return args, nil
+}
+
+// isFormBody reports whether curl would send data as a form: it says so, or no
+// Content-Type is set and the data is not JSON (curl's -d default is form-encoded).
+func isFormBody(contentType, data string) bool {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return true
+	}
+	return contentType == "" && data != "" && !strings.HasPrefix(data, "@") && !json.Valid([]byte(data))
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/mock"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+func newMockCmd(specDocs []*openapi.SpecDoc) *cobra.Command {
+	mockCmd := &cobra.Command{
+		Use:           "mock",
+		Short:         "Offline stand-in for the Mercury API",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	mockCmd.AddCommand(newMockServeCmd(specDocs))
+	return mockCmd
+}
+
+func newMockServeCmd(specDocs []*openapi.SpecDoc) *cobra.Command {
+	var (
+		host  string
+		port  int
+		opts  mock.Options
+		quiet bool
+	)
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve every API operation with responses synthesized from the specs",
+		Long: `Serve every operation in the embedded specs with responses synthesized from
+their response schemas (examples, defaults, enums and formats). List operations
+return --items items paged the way --all expects. Fixtures named
+<operationId>.json in --seed replace the synthesized body; for list operations
+a fixture may be a bare array of items.
+
+With --stateful (or --state to keep it in a file across restarts), accounts,
+recipients and payments are modeled: created recipients can be fetched and
+paid, ACH payments hold funds and stay pending for a day on a simulated clock
+before they are sent (amounts ending in .13 fail instead), and internal
+transfers move money at once. Advance the clock with
+  curl -X POST '<url>/_mock/clock/advance?by=36h'
+and inspect everything at <url>/_mock/state.
+
+Point the CLI at the server with --base-url, e.g.
+  mercury --base-url http://127.0.0.1:8080/api/v1 accounts get-accounts`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if port < 0 || port > 65535 {
+				return fmt.Errorf("--port: must be between 0 and 65535")
+			}
+			if opts.Items < 0 {
+				return fmt.Errorf("--items: must not be negative")
+			}
+			if opts.ClockSpeed < 0 {
+				return fmt.Errorf("--clock-speed: must not be negative")
+			}
+			if !quiet {
+				opts.Log = cmd.ErrOrStderr()
+			}
+			handler, err := mock.NewServer(specDocs, opts)
+			if err != nil {
+				return err
+			}
+
+			ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				return fmt.Errorf("mock: %w", err)
+			}
+			baseURL := "http://" + ln.Addr().String()
+			fmt.Fprintf(cmd.ErrOrStderr(), "Mock Mercury API listening on %s\n", baseURL)
+			fmt.Fprintf(cmd.ErrOrStderr(), "Use it with: mercury --base-url %s/api/v1 <command>\n", baseURL)
+			if st := handler.State(); st != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Simulated clock at %s; advance it with POST %s/_mock/clock/advance?by=24h\n",
+					st.Now().Format(time.RFC3339), baseURL)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+			errc := make(chan error, 1)
+			go func() { errc <- srv.Serve(ln) }()
+
+			select {
+			case err := <-errc:
+				return fmt.Errorf("mock: %w", err)
+			case <-ctx.Done():
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("mock: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&host, "host", "127.0.0.1", "Address to listen on")
+	cmd.Flags().IntVar(&port, "port", 8080, "Port to listen on (0 picks a free port)")
+	cmd.Flags().StringVar(&opts.SeedDir, "seed", "", "Directory of <operationId>.json response fixtures")
+	cmd.Flags().IntVar(&opts.Items, "items", mock.DefaultItems, "Number of items synthesized for list responses")
+	cmd.Flags().BoolVar(&opts.Stateful, "stateful", false, "Model accounts, recipients and payments in memory")
+	cmd.Flags().StringVar(&opts.StateFile, "state", "", "Persist the stateful model to this JSON file (implies --stateful)")
+	cmd.Flags().Float64Var(&opts.ClockSpeed, "clock-speed", 1, "Simulated seconds per real second for the stateful model")
+	cmd.Flags().BoolVar(&quiet, "quiet", false, "Do not log requests to stderr")
+	return cmd
+}
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/credentials"
+	"github.com/tarrence/mercury-cli/internal/mercuryhttp"
+	"github.com/tarrence/mercury-cli/internal/oauth"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// oauthLoginTimeout bounds how long login waits for the browser redirect.
+const oauthLoginTimeout = 5 * time.Minute
+
+// openBrowser opens url in the user's browser. Tests replace it.
+var openBrowser = func(url string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", url)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		c = exec.Command("xdg-open", url)
+	}
+	return c.Start()
+}
+
+func newAuthOAuthCmd(app *appState, specDocs []*openapi.SpecDoc) *cobra.Command {
+	oauthCmd := &cobra.Command{
+		Use:           "oauth",
+		Short:         "Obtain tokens through Mercury's OAuth2 server",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	oauthCmd.AddCommand(newAuthOAuthLoginCmd(app, specDocs))
+	return oauthCmd
+}
+
+func newAuthOAuthLoginCmd(app *appState, specDocs []*openapi.SpecDoc) *cobra.Command {
+	var (
+		clientID     string
+		clientSecret string
+		scopes       []string
+		port         int
+		noBrowser    bool
+		serverURL    string
+	)
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Authorize in the browser and store the resulting tokens",
+		Long: "Authorize in the browser and store the resulting tokens.\n\n" +
+			"Runs the OAuth2 authorization-code flow with PKCE. A listener on 127.0.0.1\n" +
+			"receives the redirect, so http://127.0.0.1:<port>/callback must be registered as a\n" +
+			"redirect URI for the client (use --redirect-port to pin the port). The access and\n" +
+			"refresh tokens are stored like 'mercury auth login' tokens; expired access tokens\n" +
+			"are refreshed automatically. Refresh tokens are only issued for the offline_access scope.\n\n" +
+			"Examples:\n" +
+			"  mercury auth oauth login --client-id abc --scope read --scope offline_access\n" +
+			"  mercury --env sandbox auth oauth login --client-id abc --redirect-port 8085\n",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if clientID == "" {
+				return errors.New("--client-id is required")
+			}
+			if clientSecret == "" {
+				clientSecret = os.Getenv("MERCURY_CLIENT_SECRET")
+			}
+			authURL, tokenURL, err := oauthEndpoints(specDocs, app.opts.Env, serverURL)
+			if err != nil {
+				return err
+			}
+
+			cfg := &oauth.Config{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				AuthURL:      authURL,
+				TokenURL:     tokenURL,
+				Scopes:       scopes,
+				HTTPClient:   &http.Client{Timeout: app.opts.Timeout},
+			}
+			errOut := cmd.ErrOrStderr()
+			open := func(u string) error {
+				fmt.Fprintf(errOut, "Open this URL to authorize the CLI:\n\n  %s\n\nWaiting for the redirect to %s ...\n", u, cfg.RedirectURL)
+				if noBrowser {
+					return nil
+				}
+				if err := openBrowser(u); err != nil {
+					fmt.Fprintf(errOut, "note: could not open a browser: %v\n", err)
+				}
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), oauthLoginTimeout)
+			defer cancel()
+			tok, err := cfg.Login(ctx, port, open)
+			if err != nil {
+				return err
+			}
+
+			store := app.credentialStore(cmd)
+			name := app.credentialName()
+			err = store.Set(name, credentials.Credential{
+				Token:        tok.AccessToken,
+				RefreshToken: tok.RefreshToken,
+				Expiry:       tok.Expiry,
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				TokenURL:     tokenURL,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(errOut, "Logged in. Stored OAuth token for profile %q in %s\n", name, store.Describe())
+			if tok.RefreshToken == "" {
+				fmt.Fprintln(errOut, "note: no refresh token was issued (request the offline_access scope to enable refresh)")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&clientID, "client-id", "", "OAuth2 client ID")
+	cmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 client secret for confidential clients (or set MERCURY_CLIENT_SECRET)")
+	cmd.Flags().StringSliceVar(&scopes, "scope", nil, "Scope to request (repeatable or comma-separated)")
+	cmd.Flags().IntVar(&port, "redirect-port", 0, "Port for the loopback redirect listener (0 picks a free port)")
+	cmd.Flags().BoolVar(&noBrowser, "no-browser", false, "Print the authorization URL without opening a browser")
+	cmd.Flags().StringVar(&serverURL, "oauth-url", "", "Override the OAuth2 server base URL (advanced)")
+	return cmd
+}
+
+// oauthEndpoints returns the authorization and token URLs from the embedded oauth2
+// spec, for env or on serverURL when it is set.
+func oauthEndpoints(specDocs []*openapi.SpecDoc, env string, serverURL string) (string, string, error) {
+	ops, err := cligen.ListOperations(specDocs)
+	if err != nil {
+		return "", "", err
+	}
+	var authURL, tokenURL string
+	for _, o := range ops {
+		var dst *string
+		switch o.Op.OperationID {
+		case "startOAuth2Flow":
+			dst = &authURL
+		case "obtainAccessToken":
+			dst = &tokenURL
+		default:
+			continue
+		}
+		if *dst, err = o.URL(env, serverURL); err != nil {
+			return "", "", err
+		}
+	}
+	if authURL == "" || tokenURL == "" {
+		return "", "", errors.New("oauth2 spec does not declare the authorization and token endpoints")
+	}
+	return authURL, tokenURL, nil
+}
+
+// storedToken serves the token saved by 'mercury auth login' and renews OAuth access
+// tokens with their refresh token, writing the new tokens back to the store.
+type storedToken struct {
+	store credentials.Store
+	name  string
+
+	loaded bool
+	found  bool
+	cred   credentials.Credential
+}
+
+// storedCredential returns the stored token when it is the token source for this
+// run: no --token/MERCURY_TOKEN, no profile token source, and a store to read.
+func (a *appState) storedCredential(cmd *cobra.Command) *storedToken {
+	if a.opts.Token != "" || (a.profile != nil && a.profile.HasTokenSource()) {
+		return nil
+	}
+	store := a.credentialStore(cmd)
+	if fs, ok := store.(*credentials.FileStore); ok && !fs.Exists() {
+		return nil
+	}
+	return &storedToken{store: store, name: a.credentialName()}
+}
+
+func (s *storedToken) load() error {
+	if s.loaded {
+		return nil
+	}
+	c, err := s.store.Get(s.name)
+	switch {
+	case errors.Is(err, credentials.ErrNotFound):
+	case err != nil:
+		return err
+	default:
+		s.cred, s.found = c, true
+	}
+	s.loaded = true
+	return nil
+}
+
+// Token returns the stored access token, refreshing it first if it has expired.
+// No stored credential yields an empty token.
+func (s *storedToken) Token(ctx context.Context) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	if !s.found {
+		return "", nil
+	}
+	if s.cred.Refreshable() && oauth.Expired(s.cred.Expiry) {
+		return s.Refresh(ctx)
+	}
+	return s.cred.Token, nil
+}
+
+// Refresh exchanges the refresh token for a new access token. It returns
+// mercuryhttp.ErrNoRefresh for credentials without a refresh token.
+func (s *storedToken) Refresh(ctx context.Context) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	if !s.found || !s.cred.Refreshable() {
+		return "", mercuryhttp.ErrNoRefresh
+	}
+	cfg := &oauth.Config{
+		ClientID:     s.cred.ClientID,
+		ClientSecret: s.cred.ClientSecret,
+		TokenURL:     s.cred.TokenURL,
+	}
+	tok, err := cfg.Refresh(ctx, s.cred.RefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("%w (run 'mercury auth oauth login' again)", err)
+	}
+	s.cred.Token = tok.AccessToken
+	s.cred.RefreshToken = tok.RefreshToken
+	s.cred.Expiry = tok.Expiry
+	if err := s.store.Set(s.name, s.cred); err != nil {
+		return "", fmt.Errorf("save refreshed token: %w", err)
+	}
+	return tok.AccessToken, nil
+}
+
+// describe summarizes an OAuth credential for 'mercury auth status'.
+func (s *storedToken) describe() string {
+	if s == nil || !s.found || s.cred.ClientID == "" {
+		return ""
+	}
+	expiry := "never"
+	if !s.cred.Expiry.IsZero() {
+		expiry = s.cred.Expiry.Local().Format(time.RFC3339)
+	}
+	refresh := "no refresh token"
+	if s.cred.Refreshable() {
+		refresh = "refreshable"
+	}
+	return strings.Join([]string{"client " + s.cred.ClientID, "expires " + expiry, refresh}, ", ")
+}
@@ -5,17 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/config"
+	"github.com/tarrence/mercury-cli/internal/idempotency"
 	"github.com/tarrence/mercury-cli/internal/mercuryhttp"
 	"github.com/tarrence/mercury-cli/internal/openapi"
 	"github.com/tarrence/mercury-cli/internal/output"
+	"github.com/tarrence/mercury-cli/internal/query"
 	"github.com/tarrence/mercury-cli/internal/version"
 )
 
 type rootOptions struct {
+	Profile string
+
 	Token string
 	Env   string
 	Auth  string
@@ -26,6 +34,10 @@ type rootOptions struct {
 	Pretty   bool
 	NoPretty bool
 	Ndjson   bool
+	Output   string
+	Columns  []string
+	Query    string
+	Template string
 
 	Debug bool
 	Trace bool
@@ -33,35 +45,265 @@ type rootOptions struct {
 	Status  bool
 	Headers bool
 
+	DryRun   bool
+	AsCurl   bool
+	AsHTTPie bool
+	AsGo     bool
+
 	RetryNonIdempotent bool
+	Retry              mercuryhttp.RetryPolicy
+
+	RateLimit       string
+	RateLimitShared bool
+
+	Record       string
+	Replay       string
+	ReplayStrict bool
+
+	ValidateResponse bool
+
+	NoResolve bool
 }
 
 type appState struct {
 	opts    rootOptions
 	client  *mercuryhttp.Client
 	printer *output.Printer
+	snippet string // set by --as-curl, --as-httpie or --as-go
+
+	// configPath is the config file location; the credential store lives next to it.
+	configPath string
+
+	// profileName and profile are the config profile selected for this run, if any.
+	profileName string
+	profile     *config.Profile
+	// profileFlags are the flags applyProfile set from the profile.
+	profileFlags []string
+
+	// stored is the token saved by 'mercury auth login', when it is the token source.
+	stored *storedToken
+
+	// shell is the interactive session commands run in, if any.
+	shell *shell
+}
+
+// applyProfile loads the config file and fills in options that were not set by a
+// flag or environment variable from the selected profile. Precedence, highest
+// first: flags, environment variables, config profile, built-in defaults.
+func (a *appState) applyProfile(cmd *cobra.Command) error {
+	path, err := config.DefaultPath()
+	if err != nil {
+		return err
+	}
+	a.configPath = path
+	a.profileName, a.profile, a.profileFlags = "", nil, nil
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	name, p, err := cfg.Select(a.opts.Profile)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	a.profileName, a.profile = name, p
+
+	flags := cmd.Flags()
+	set := func(flag string, value string) error {
+		if value == "" || flags.Changed(flag) {
+			return nil
+		}
+		if err := flags.Set(flag, value); err != nil {
+			return fmt.Errorf("profile %q: %s: %w", name, flag, err)
+		}
+		a.profileFlags = append(a.profileFlags, flag)
+		return nil
+	}
+	if err := set("env", p.Env); err != nil {
+		return err
+	}
+	if err := set("auth", p.Auth); err != nil {
+		return err
+	}
+	if err := set("base-url", p.BaseURL); err != nil {
+		return err
+	}
+	if p.Timeout != "" && !flags.Changed("timeout") {
+		d, err := p.Duration()
+		if err != nil {
+			return fmt.Errorf("profile %q: timeout: %w", name, err)
+		}
+		a.opts.Timeout = d
+	}
+	if !flags.Changed("pretty") && !flags.Changed("no-pretty") && !flags.Changed("ndjson") && !flags.Changed("output") {
+		switch p.Output {
+		case "pretty":
+			a.opts.Pretty = true
+		case "compact":
+			a.opts.NoPretty = true
+		case "ndjson":
+			a.opts.Ndjson = true
+		case output.FormatTable, output.FormatCSV, output.FormatTSV:
+			a.opts.Output = p.Output
+		}
+	}
+	return nil
+}
+
+// tokenSource returns where to look up a token when none was given by flag or
+// environment: the selected profile's token source if it has one, else the token
+// stored by 'mercury auth login'.
+func (a *appState) tokenSource() func(ctx context.Context) (string, error) {
+	if a.opts.Token != "" {
+		return nil
+	}
+	if p, name := a.profile, a.profileName; p != nil && p.HasTokenSource() {
+		return func(ctx context.Context) (string, error) {
+			tok, err := p.ReadToken(ctx)
+			if err != nil {
+				return "", fmt.Errorf("profile %q: %w", name, err)
+			}
+			return tok, nil
+		}
+	}
+	if a.stored != nil {
+		return a.stored.Token
+	}
+	return nil
 }
 
 func (a *appState) initFromFlags(cmd *cobra.Command) error {
 	if a.opts.Pretty && a.opts.NoPretty {
 		return fmt.Errorf("cannot set both --pretty and --no-pretty")
 	}
+	switch a.opts.Output {
+	case "", output.FormatJSON:
+		if len(a.opts.Columns) > 0 {
+			return fmt.Errorf("--columns requires --output table, csv or tsv")
+		}
+	case output.FormatTable, output.FormatCSV, output.FormatTSV:
+		if a.opts.Ndjson {
+			return fmt.Errorf("cannot combine --output %s with --ndjson", a.opts.Output)
+		}
+	default:
+		return fmt.Errorf("invalid --output %q (expected one of: %s)", a.opts.Output, strings.Join(output.Formats, ", "))
+	}
+	var q *query.Query
+	if a.opts.Query != "" {
+		var err error
+		if q, err = query.Parse(a.opts.Query); err != nil {
+			return fmt.Errorf("--query: %w", err)
+		}
+	}
+	var tmpl *template.Template
+	if a.opts.Template != "" {
+		if a.opts.Output != "" && a.opts.Output != output.FormatJSON {
+			return fmt.Errorf("cannot combine --template with --output %s", a.opts.Output)
+		}
+		src := a.opts.Template
+		if strings.HasPrefix(src, "@") {
+			b, err := os.ReadFile(strings.TrimPrefix(src, "@"))
+			if err != nil {
+				return fmt.Errorf("--template: %w", err)
+			}
+			src = string(b)
+		}
+		var err error
+		if tmpl, err = output.ParseTemplate(src); err != nil {
+			return fmt.Errorf("--template: %w", err)
+		}
+	}
+
+	var snippets []string
+	for _, f := range []struct {
+		set    bool
+		format string
+	}{{a.opts.AsCurl, "curl"}, {a.opts.AsHTTPie, "httpie"}, {a.opts.AsGo, "go"}} {
+		if f.set {
+			snippets = append(snippets, f.format)
+		}
+	}
+	if len(snippets) > 1 {
+		return fmt.Errorf("only one of --as-curl, --as-httpie and --as-go may be set")
+	}
+	if len(snippets) == 1 {
+		if a.opts.DryRun {
+			return fmt.Errorf("cannot combine --dry-run with --as-%s", snippets[0])
+		}
+		a.snippet = snippets[0]
+	}
 
 	a.printer = output.NewPrinter(cmd.OutOrStdout(), cmd.ErrOrStderr(), output.PrinterOptions{
 		ForcePretty:  a.opts.Pretty,
 		ForceCompact: a.opts.NoPretty,
 		Ndjson:       a.opts.Ndjson,
+		Format:       a.opts.Output,
+		Columns:      a.opts.Columns,
+		Query:        q,
+		Template:     tmpl,
 		PrintStatus:  a.opts.Status,
 		PrintHeaders: a.opts.Headers,
 	})
 
+	if a.opts.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("--retry-max-attempts must be at least 1")
+	}
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"retry-backoff", a.opts.Retry.BaseBackoff},
+		{"retry-max-backoff", a.opts.Retry.MaxBackoff},
+		{"retry-budget", a.opts.Retry.Budget},
+		{"attempt-timeout", a.opts.Retry.AttemptTimeout},
+	} {
+		if d.value < 0 {
+			return fmt.Errorf("--%s must not be negative", d.flag)
+		}
+	}
+
+	var limiter *mercuryhttp.Limiter
+	if a.opts.RateLimit != "" {
+		rate, err := mercuryhttp.ParseRate(a.opts.RateLimit)
+		if err != nil {
+			return fmt.Errorf("--rate-limit: %w", err)
+		}
+		if a.opts.RateLimitShared {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return fmt.Errorf("--rate-limit-shared: %w", err)
+			}
+			limiter = mercuryhttp.NewSharedLimiter(rate, filepath.Join(dir, "mercury"))
+		} else {
+			limiter = mercuryhttp.NewLimiter(rate)
+		}
+	} else if a.opts.RateLimitShared {
+		return fmt.Errorf("--rate-limit-shared requires --rate-limit")
+	}
+
+	if a.opts.ReplayStrict && a.opts.Replay == "" {
+		return fmt.Errorf("--replay-strict requires --replay")
+	}
+
+	var refresh func(ctx context.Context) (string, error)
+	if a.stored != nil {
+		refresh = a.stored.Refresh
+	}
 	httpClient, err := mercuryhttp.NewClient(mercuryhttp.ClientOptions{
 		Timeout:            a.opts.Timeout,
 		Debug:              a.opts.Debug,
 		Trace:              a.opts.Trace,
 		RetryNonIdempotent: a.opts.RetryNonIdempotent,
+		Retry:              a.opts.Retry,
+		RateLimiter:        limiter,
+		Record:             a.opts.Record,
+		Replay:             a.opts.Replay,
+		ReplayStrict:       a.opts.ReplayStrict,
 		UserAgent:          version.UserAgent(),
 		Out:                cmd.ErrOrStderr(),
+		RefreshToken:       refresh,
 	})
 	if err != nil {
 		return err
@@ -83,6 +325,42 @@ func (a *appState) initFromFlags(cmd *cobra.Command) error {
 	return nil
 }
 
+// newRuntime configures the app for cmd from its flags, the config profile and
+// stored credentials, and returns the Runtime generated commands run with.
+func (a *appState) newRuntime(cmd *cobra.Command) (*cligen.Runtime, error) {
+	if err := a.applyProfile(cmd); err != nil {
+		return nil, err
+	}
+	a.stored = a.storedCredential(cmd)
+	if err := a.initFromFlags(cmd); err != nil {
+		return nil, err
+	}
+	cacheDir := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheDir = filepath.Join(dir, "mercury")
+	}
+	return &cligen.Runtime{
+		Env:     a.opts.Env,
+		BaseURL: a.opts.BaseURL,
+		Token:   a.opts.Token,
+		Auth:    a.opts.Auth,
+		Client:  a.client,
+		Printer: a.printer,
+
+		TokenSource: a.tokenSource(),
+
+		ValidateResponse: a.opts.ValidateResponse,
+		DryRun:           a.opts.DryRun,
+		Snippet:          a.snippet,
+
+		Idempotency: idempotency.NewJournal(filepath.Join(filepath.Dir(a.configPath), "idempotency.json")),
+		CacheDir:    cacheDir,
+		Profile:     a.credentialName(),
+
+		ResolveNames: !a.opts.NoResolve,
+	}, nil
+}
+
 func (a *appState) contextWithApp(ctx context.Context) context.Context {
 	return context.WithValue(ctx, appKey{}, a)
 }
@@ -122,33 +400,42 @@ func NewRootCmd() (*cobra.Command, error) {
 			"This CLI is generated from Mercury's published OpenAPI specs.\n\n" +
 			"Authentication:\n" +
 			"  export MERCURY_TOKEN=\"...\"\n" +
-			"  mercury accounts get-accounts\n\n" +
+			"  mercury accounts get-accounts\n" +
+			"  Or store the token once with 'mercury auth login'.\n\n" +
+			"Profiles:\n" +
+			"  Settings are read from ~/.config/mercury/config.toml (see 'mercury config').\n" +
+			"  Precedence: flags, then MERCURY_* environment variables, then the selected profile.\n\n" +
 			"Common usage:\n" +
-			"  mercury <group> <operation> [path-args...] [--query/--header flags]\n\n" +
+			"  mercury <group> <operation> [path-args...] [parameter flags]\n\n" +
 			"Examples:\n" +
 			"  mercury accounts get-accounts --limit 100\n" +
 			"  mercury accounts get-accounts --all\n" +
-			"  mercury recipients create-recipient --data @recipient.json\n",
+			"  mercury accounts get-accounts --output table --columns id,name,availableBalance\n" +
+			"  mercury accounts get-accounts --query '.accounts[] | select(.status == \"active\") | {id, name}'\n" +
+			"  mercury accounts get-accounts --template '{{range .accounts}}{{.name}} {{money .availableBalance}}{{\"\\n\"}}{{end}}'\n" +
+			"  mercury recipients create-recipient --data @recipient.json\n" +
+			"  mercury recipients create-recipient --name Acme --emails ap@acme.example\n",
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			if err := app.initFromFlags(cmd); err != nil {
+			if app.shell != nil {
+				return app.shell.preRun(cmd)
+			}
+			if cmd.Name() == cobra.ShellCompRequestCmd {
+				// The completed command line's flags are parsed after this runs.
+				cmd.SetContext(cligen.WithRuntimeLoader(app.contextWithApp(cmd.Context()), app.newRuntime))
+				return nil
+			}
+			rt, err := app.newRuntime(cmd)
+			if err != nil {
 				return err
 			}
-			ctx := app.contextWithApp(cmd.Context())
-			ctx = cligen.WithRuntime(ctx, &cligen.Runtime{
-				Env:     app.opts.Env,
-				BaseURL: app.opts.BaseURL,
-				Token:   app.opts.Token,
-				Auth:    app.opts.Auth,
-				Client:  app.client,
-				Printer: app.printer,
-			})
-			cmd.SetContext(ctx)
+			cmd.SetContext(cligen.WithRuntime(app.contextWithApp(cmd.Context()), rt))
 			return nil
 		},
 	}
 
+	root.PersistentFlags().StringVar(&app.opts.Profile, "profile", "", "Config profile to use (or set MERCURY_PROFILE)")
 	root.PersistentFlags().StringVar(&app.opts.Token, "token", "", "Mercury API token (or set MERCURY_TOKEN)")
 	root.PersistentFlags().StringVar(&app.opts.Env, "env", app.opts.Env, "Environment: prod or sandbox")
 	root.PersistentFlags().StringVar(&app.opts.Auth, "auth", app.opts.Auth, "Auth scheme for --token: bearer or basic")
@@ -158,12 +445,32 @@ func NewRootCmd() (*cobra.Command, error) {
 	root.PersistentFlags().BoolVar(&app.opts.Pretty, "pretty", false, "Force pretty-printed JSON output")
 	root.PersistentFlags().BoolVar(&app.opts.NoPretty, "no-pretty", false, "Force compact (non-pretty) output")
 	root.PersistentFlags().BoolVar(&app.opts.Ndjson, "ndjson", false, "Output newline-delimited JSON where applicable (primarily with --all)")
+	root.PersistentFlags().StringVar(&app.opts.Output, "output", "", "Output format: json (default), table, csv or tsv")
+	root.PersistentFlags().StringSliceVar(&app.opts.Columns, "columns", nil, "Columns for table/csv/tsv output, comma-separated; dotted paths select nested fields (e.g. id,counterparty.name)")
+	root.PersistentFlags().StringVar(&app.opts.Query, "query", "", "Filter JSON output with a jq-style expression (e.g. '.accounts[] | {id, name}'); applied per item with --all --ndjson")
+	root.PersistentFlags().StringVar(&app.opts.Template, "template", "", "Render JSON output with a Go template, inline or @file (helpers: money, currency, number, date, parseTime, now, padLeft, padRight, truncate, json, jsonIndent, upper, lower, join, default)")
 
 	root.PersistentFlags().BoolVar(&app.opts.Debug, "debug", false, "Log request/response metadata to stderr (redacts auth)")
 	root.PersistentFlags().BoolVar(&app.opts.Trace, "trace", false, "Log full request/response bodies to stderr (redacts auth headers)")
 	root.PersistentFlags().BoolVar(&app.opts.Status, "status", false, "Print HTTP status code to stderr")
 	root.PersistentFlags().BoolVar(&app.opts.Headers, "headers", false, "Print response headers to stderr (redacts auth-related headers)")
-	root.PersistentFlags().BoolVar(&app.opts.RetryNonIdempotent, "retry-non-idempotent", false, "Allow retries for non-idempotent requests on 429/5xx")
+	root.PersistentFlags().BoolVar(&app.opts.DryRun, "dry-run", false, "Print the request as JSON instead of sending it (auth redacted; with --all, the first page only)")
+	root.PersistentFlags().BoolVar(&app.opts.AsCurl, "as-curl", false, "Print the request as a curl command instead of sending it (token read from $MERCURY_TOKEN)")
+	root.PersistentFlags().BoolVar(&app.opts.AsHTTPie, "as-httpie", false, "Print the request as an HTTPie command instead of sending it")
+	root.PersistentFlags().BoolVar(&app.opts.AsGo, "as-go", false, "Print the request as a Go program instead of sending it")
+	root.PersistentFlags().IntVar(&app.opts.Retry.MaxAttempts, "retry-max-attempts", mercuryhttp.DefaultRetryPolicy.MaxAttempts, "Max attempts per request, including the first (1 disables retries)")
+	root.PersistentFlags().DurationVar(&app.opts.Retry.BaseBackoff, "retry-backoff", mercuryhttp.DefaultRetryPolicy.BaseBackoff, "Backoff before the first retry; doubles per retry (Retry-After takes precedence)")
+	root.PersistentFlags().DurationVar(&app.opts.Retry.MaxBackoff, "retry-max-backoff", mercuryhttp.DefaultRetryPolicy.MaxBackoff, "Upper bound for the backoff between retries")
+	root.PersistentFlags().DurationVar(&app.opts.Retry.Budget, "retry-budget", 0, "Total time a request may take including retries; no retry starts past it (0 = no limit)")
+	root.PersistentFlags().DurationVar(&app.opts.Retry.AttemptTimeout, "attempt-timeout", 0, "Timeout for each attempt, retried like a network error (0 = only --timeout applies)")
+	root.PersistentFlags().StringVar(&app.opts.RateLimit, "rate-limit", "", "Client-side request rate limit, e.g. 10/s or 300/min; also pauses on the API's rate limit headers")
+	root.PersistentFlags().BoolVar(&app.opts.RateLimitShared, "rate-limit-shared", false, "Share the --rate-limit budget with other mercury processes on this machine (state in the user cache dir)")
+	root.PersistentFlags().BoolVar(&app.opts.RetryNonIdempotent, "retry-non-idempotent", false, "Allow retries on 429/5xx for non-idempotent requests that carry no idempotency key")
+	root.PersistentFlags().StringVar(&app.opts.Record, "record", "", "Save each request/response pair as a cassette file in this directory (credentials and sensitive fields redacted)")
+	root.PersistentFlags().StringVar(&app.opts.Replay, "replay", "", "Answer requests from the cassettes in this directory; unmatched requests are sent unless --replay-strict is set")
+	root.PersistentFlags().BoolVar(&app.opts.ReplayStrict, "replay-strict", false, "With --replay, fail requests that have no recorded response instead of sending them")
+	root.PersistentFlags().BoolVar(&app.opts.ValidateResponse, "validate-response", false, "Report 2xx response bodies that do not match the OpenAPI response schema to stderr")
+	root.PersistentFlags().BoolVar(&app.opts.NoResolve, "no-resolve", false, "Send ID arguments and flags as typed instead of looking up names (or set MERCURY_NO_RESOLVE=1)")
 
 	root.SetVersionTemplate("{{.Version}}\n")
 	root.Version = version.Version()
@@ -171,19 +478,33 @@ func NewRootCmd() (*cobra.Command, error) {
 	// Built-ins
 	root.AddCommand(newSpecCmd(specDocs))
 	root.AddCommand(newVersionCmd())
+	root.AddCommand(newConfigCmd(app))
+	root.AddCommand(newAuthCmd(app, specDocs))
+	root.AddCommand(newFromCurlCmd(specDocs))
+	root.AddCommand(newMockCmd(specDocs))
+	root.AddCommand(newShellCmd(app))
 
 	// Generated API commands
 	if err := cligen.AddOpenAPICommands(root, specDocs); err != nil {
 		return nil, err
 	}
+	addWebhookCommands(root, specDocs)
 
-	// Env default from MERCURY_ENV, token default from MERCURY_TOKEN
+	// Env default from MERCURY_ENV, token default from MERCURY_TOKEN, profile from MERCURY_PROFILE,
+	// --no-resolve from MERCURY_NO_RESOLVE.
+	// Values set here count as explicitly set, so they take precedence over the config profile.
+	if v := os.Getenv("MERCURY_PROFILE"); v != "" {
+		_ = root.PersistentFlags().Set("profile", v)
+	}
 	if v := os.Getenv("MERCURY_ENV"); v != "" {
 		_ = root.PersistentFlags().Set("env", v)
 	}
 	if v := os.Getenv("MERCURY_TOKEN"); v != "" {
 		_ = root.PersistentFlags().Set("token", v)
 	}
+	if v := os.Getenv("MERCURY_NO_RESOLVE"); v != "" {
+		_ = root.PersistentFlags().Set("no-resolve", v)
+	}
 
 	return root, nil
 }
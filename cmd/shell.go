@@ -0,0 +1,760 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/query"
+	"github.com/tarrence/mercury-cli/internal/snippet"
+	"golang.org/x/term"
+)
+
+// maxShellHistory bounds the history kept on disk.
+const maxShellHistory = 1000
+
+// shellBuiltins are the commands the shell handles itself.
+var shellBuiltins = []string{"exit", "help", "quit", "save", "set", "unset", "vars"}
+
+// shell is an interactive session. Every line runs against the same cobra tree
+// and, unless it sets global flags, the same Runtime.
+type shell struct {
+	root *cobra.Command
+	cmd  *cobra.Command // the shell command itself
+	app  *appState
+	rt   *cligen.Runtime
+
+	// ctx is the context of the line being run.
+	ctx context.Context
+
+	// settings are the global flags in effect for every line: those given when
+	// the shell started, plus those changed with "set".
+	settings map[string][]string
+	// vars are the response captured as $last and those kept with "save".
+	vars map[string]any
+
+	term *term.Terminal
+}
+
+func newShellCmd(app *appState) *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell",
+		Short: "Run commands in an interactive session",
+		Long: `Run commands in an interactive session. The specs are parsed and credentials
+resolved once, and every line reuses the same HTTP client. Lines are commands
+without the leading "mercury", e.g.
+
+  accounts get-accounts --output table
+  accounts get-account $last.accounts[0].id
+  set env sandbox
+
+Tab completes groups, operations and flags, and history is kept next to the
+config file.
+
+$last is the last response; $last.path selects from it with --query syntax,
+and the value can be used anywhere in a line except inside single quotes or
+after a backslash ('$5 fee', \$5). Built-ins:
+
+  set [flag [value]]   show or change a global flag for the session (e.g. set output table)
+  unset <flag>         restore a global flag's default
+  save <name>          keep the last response as $name
+  vars                 list variables
+  exit                 leave the shell (or Ctrl-D)
+
+Commands are read from stdin when it is not a terminal.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if app.shell != nil {
+				return fmt.Errorf("already in a shell")
+			}
+			rt, err := cligen.RuntimeFrom(cmd)
+			if err != nil {
+				return err
+			}
+			s := &shell{
+				root:     cmd.Root(),
+				cmd:      cmd,
+				app:      app,
+				rt:       rt,
+				settings: map[string][]string{},
+				vars:     map[string]any{},
+			}
+			rt.Capture = s.capture
+			cmd.Root().PersistentFlags().VisitAll(func(f *pflag.Flag) {
+				if f.Changed && !slices.Contains(app.profileFlags, f.Name) {
+					s.settings[f.Name] = flagValues(f)
+				}
+			})
+			app.shell = s
+			defer func() { app.shell = nil }()
+
+			if in, ok := cmd.InOrStdin().(*os.File); ok && term.IsTerminal(int(in.Fd())) {
+				if out, ok := cmd.OutOrStdout().(*os.File); ok && term.IsTerminal(int(out.Fd())) {
+					return s.interactive(in, out)
+				}
+			}
+			return s.script(cmd.InOrStdin())
+		},
+	}
+}
+
+// interactive reads lines from a terminal with history and completion.
+func (s *shell) interactive(in, out *os.File) error {
+	s.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, out}, s.prompt())
+	s.term.History = loadShellHistory(filepath.Join(filepath.Dir(s.app.configPath), "shell_history"))
+	s.term.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return s.completeKey(line, pos)
+	}
+	fmt.Fprintln(s.rt.Printer.Err(), `Mercury shell. Type "help" for built-ins, Tab to complete, Ctrl-D to exit.`)
+
+	for {
+		if w, h, err := term.GetSize(int(out.Fd())); err == nil && w > 0 {
+			_ = s.term.SetSize(w, h)
+		}
+		s.term.SetPrompt(s.prompt())
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return err
+		}
+		line, err := s.term.ReadLine()
+		_ = term.Restore(int(in.Fd()), state)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		done, err := s.run(line)
+		if err != nil {
+			if msg := err.Error(); msg != "" {
+				fmt.Fprintln(s.rt.Printer.Err(), msg)
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// script runs the lines read from r, reporting errors and carrying on.
+func (s *shell) script(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	total, failed := 0, 0
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		total++
+		done, err := s.run(line)
+		if err != nil {
+			failed++
+			if msg := err.Error(); msg != "" {
+				fmt.Fprintln(s.rt.Printer.Err(), msg)
+			}
+		}
+		if done {
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commands failed", failed, total)
+	}
+	return nil
+}
+
+func (s *shell) prompt() string {
+	if s.rt.Env != "" && s.rt.Env != "prod" {
+		return "mercury (" + s.rt.Env + ")> "
+	}
+	return "mercury> "
+}
+
+// run runs one line and reports whether the session is over.
+func (s *shell) run(line string) (done bool, err error) {
+	words, err := snippet.SplitShell(line)
+	if err != nil {
+		return false, err
+	}
+	if len(words) > 0 && words[0] == "mercury" {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return false, nil
+	}
+	switch words[0] {
+	case "exit", "quit":
+		return true, nil
+	case "help":
+		if len(words) == 1 {
+			fmt.Fprintln(s.cmd.OutOrStdout(), s.cmd.Long)
+			return false, nil
+		}
+	case "set":
+		return false, s.set(words[1:])
+	case "unset":
+		return false, s.unset(words[1:])
+	case "save":
+		return false, s.save(words[1:])
+	case "vars":
+		return false, s.listVars()
+	case "shell":
+		return false, fmt.Errorf("already in a shell")
+	}
+	// Variables are expanded outside single quotes, before quotes are removed.
+	if words, err = snippet.SplitShellExpand(line, s.expand); err != nil {
+		return false, err
+	}
+	if words[0] == "mercury" {
+		words = words[1:]
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s.ctx = ctx
+	s.root.SetArgs(words)
+	c, err := s.root.ExecuteContextC(ctx)
+	s.restoreFlags(c)
+	if c != nil {
+		// cobra only hands the root context to commands that have none yet.
+		c.SetContext(nil)
+	}
+	return false, err
+}
+
+// preRun gives cmd the session Runtime, or a fresh one when the line sets
+// global flags of its own.
+func (s *shell) preRun(cmd *cobra.Command) error {
+	rt := s.rt
+	if s.lineSetsGlobals() {
+		var err error
+		if rt, err = s.app.newRuntime(cmd); err != nil {
+			return err
+		}
+		rt.Capture = s.capture
+	}
+	cmd.SetContext(cligen.WithRuntime(s.app.contextWithApp(s.ctx), rt))
+	return nil
+}
+
+func (s *shell) lineSetsGlobals() bool {
+	changed := false
+	s.root.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		want, ok := s.settings[f.Name]
+		if f.Changed != ok || (ok && !slices.Equal(flagValues(f), want)) {
+			changed = true
+		}
+	})
+	return changed
+}
+
+// restoreFlags puts the flags a line may have changed back to the session's
+// settings and defaults, since cobra keeps flag values between executions.
+func (s *shell) restoreFlags(c *cobra.Command) {
+	globals := s.root.PersistentFlags()
+	restore := func(f *pflag.Flag) {
+		if want, ok := s.settings[f.Name]; ok && globals.Lookup(f.Name) == f {
+			setFlagValues(f, want)
+			f.Changed = true
+			return
+		}
+		if f.Changed {
+			setFlagValues(f, defaultValues(f))
+			f.Changed = false
+		}
+	}
+	if c != nil {
+		c.Flags().VisitAll(restore)
+	}
+	globals.VisitAll(restore)
+}
+
+func flagValues(f *pflag.Flag) []string {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.GetSlice()
+	}
+	return []string{f.Value.String()}
+}
+
+func defaultValues(f *pflag.Flag) []string {
+	if _, ok := f.Value.(pflag.SliceValue); ok {
+		def := strings.Trim(f.DefValue, "[]")
+		if def == "" {
+			return nil
+		}
+		return strings.Split(def, ",")
+	}
+	return []string{f.DefValue}
+}
+
+func setFlagValues(f *pflag.Flag, values []string) {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		_ = sv.Replace(values)
+		return
+	}
+	if len(values) > 0 {
+		_ = f.Value.Set(values[0])
+	}
+}
+
+// set shows the session settings or changes a global flag for the session.
+func (s *shell) set(args []string) error {
+	globals := s.root.PersistentFlags()
+	if len(args) == 0 {
+		names := make([]string, 0, len(s.settings))
+		for name := range s.settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := strings.Join(s.settings[name], ",")
+			if name == "token" {
+				v = "(set)"
+			}
+			fmt.Fprintf(s.cmd.OutOrStdout(), "%s = %s\n", name, v)
+		}
+		return nil
+	}
+	name := strings.TrimPrefix(args[0], "--")
+	f := globals.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("set: unknown global flag %q", name)
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("set: too many arguments")
+	}
+	value := f.NoOptDefVal
+	if len(args) == 2 {
+		value = args[1]
+	}
+	if value == "" {
+		return fmt.Errorf("set %s: a value is required", name)
+	}
+
+	prev, hadPrev := s.settings[name]
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		_ = sv.Replace(nil)
+	}
+	if err := f.Value.Set(value); err != nil {
+		setFlagValues(f, prev)
+		return fmt.Errorf("set %s: %w", name, err)
+	}
+	f.Changed = true
+	s.settings[name] = flagValues(f)
+	if err := s.reload(); err != nil {
+		if hadPrev {
+			s.settings[name] = prev
+		} else {
+			delete(s.settings, name)
+		}
+		s.restoreFlags(nil)
+		return fmt.Errorf("set %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *shell) unset(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("unset: expected one flag name")
+	}
+	name := strings.TrimPrefix(args[0], "--")
+	if s.root.PersistentFlags().Lookup(name) == nil {
+		return fmt.Errorf("unset: unknown global flag %q", name)
+	}
+	delete(s.settings, name)
+	s.restoreFlags(nil)
+	return s.reload()
+}
+
+// reload rebuilds the session Runtime from the current settings.
+func (s *shell) reload() error {
+	rt, err := s.app.newRuntime(s.cmd)
+	s.restoreFlags(nil) // newRuntime applies the config profile to the flags
+	if err != nil {
+		return err
+	}
+	rt.Capture = s.capture
+	s.rt = rt
+	return nil
+}
+
+// capture keeps a JSON response as $last.
+func (s *shell) capture(body []byte) {
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	var v any
+	if dec.Decode(&v) == nil {
+		s.vars["last"] = v
+	}
+}
+
+func (s *shell) save(args []string) error {
+	if len(args) != 1 || !varName.MatchString(args[0]) {
+		return fmt.Errorf("save: expected a variable name")
+	}
+	v, ok := s.vars["last"]
+	if !ok {
+		return fmt.Errorf("save: no response yet")
+	}
+	s.vars[args[0]] = v
+	return nil
+}
+
+func (s *shell) listVars() error {
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		desc := "value"
+		switch v := s.vars[name].(type) {
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			desc = "object {" + strings.Join(keys, ", ") + "}"
+		case []any:
+			desc = fmt.Sprintf("array of %d", len(v))
+		}
+		fmt.Fprintf(s.cmd.OutOrStdout(), "$%s  %s\n", name, desc)
+	}
+	return nil
+}
+
+var (
+	varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	varRef  = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)((?:\.[A-Za-z_][A-Za-z0-9_]*|\[[^\]]*\])*)`)
+)
+
+// expand replaces $name and $name.path references in text with the selected
+// value: strings as is, anything else as JSON.
+func (s *shell) expand(text string) (string, error) {
+	var err error
+	out := varRef.ReplaceAllStringFunc(text, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := varRef.FindStringSubmatch(ref)
+		v, ok := s.vars[m[1]]
+		if !ok {
+			err = fmt.Errorf("undefined variable $%s", m[1])
+			return ""
+		}
+		if path := m[2]; path != "" {
+			if strings.HasPrefix(path, "[") {
+				path = "." + path
+			}
+			q, perr := query.Parse(path)
+			if perr != nil {
+				err = fmt.Errorf("%s: %w", ref, perr)
+				return ""
+			}
+			res, qerr := q.Run(v)
+			switch {
+			case qerr != nil:
+				err = fmt.Errorf("%s: %w", ref, qerr)
+				return ""
+			case len(res) != 1:
+				err = fmt.Errorf("%s: selects %d values, expected one", ref, len(res))
+				return ""
+			}
+			v = res[0]
+		}
+		switch v := v.(type) {
+		case nil:
+			err = fmt.Errorf("%s is null", ref)
+			return ""
+		case string:
+			return v
+		default:
+			b, merr := json.Marshal(v)
+			if merr != nil {
+				err = merr
+			}
+			return string(b)
+		}
+	})
+	return out, err
+}
+
+// completeKey completes the word before pos, listing the candidates when
+// there is more than one and no longer common prefix.
+func (s *shell) completeKey(line string, pos int) (string, int, bool) {
+	word, cands := s.completions(line[:pos])
+	if len(cands) == 0 {
+		return "", 0, false
+	}
+	fill := cands[0]
+	if len(cands) > 1 {
+		fill = commonPrefix(cands)
+		if fill == word {
+			fmt.Fprintf(s.term, "%s\n", strings.Join(cands, "  "))
+			return "", 0, false
+		}
+	} else {
+		fill += " "
+	}
+	head := line[:pos-len(word)] + fill
+	return head + line[pos:], len(head), true
+}
+
+// completions returns the word being completed at the end of line and the
+// groups, operations, flags, flag values or arguments it may become.
+func (s *shell) completions(line string) (string, []string) {
+	words := strings.Fields(line)
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	if len(words) > 0 && words[0] == "mercury" {
+		words = words[1:]
+	}
+
+	var cands []string
+	add := func(c string) {
+		if strings.HasPrefix(c, word) && !slices.Contains(cands, c) {
+			cands = append(cands, c)
+		}
+	}
+	if len(words) > 0 && (words[0] == "set" || words[0] == "unset") {
+		if len(words) == 1 {
+			s.root.PersistentFlags().VisitAll(func(f *pflag.Flag) { add(f.Name) })
+		} else if f := s.root.PersistentFlags().Lookup(words[1]); f != nil && len(words) == 2 {
+			for _, v := range s.flagValueCompletions(s.root, f.Name, word) {
+				add(v)
+			}
+		}
+		sort.Strings(cands)
+		return word, cands
+	}
+
+	c := s.root
+	var args []string
+	var pending *pflag.Flag // flag waiting for its value
+	for _, w := range words {
+		switch {
+		case pending != nil:
+			pending = nil
+		case strings.HasPrefix(w, "-"):
+			name, _, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			if f := lookupFlag(c, name); f != nil && f.NoOptDefVal == "" && !hasValue {
+				pending = f
+			}
+		default:
+			if sub := findSubcommand(c, w); sub != nil && len(args) == 0 {
+				c = sub
+			} else {
+				args = append(args, w)
+			}
+		}
+	}
+
+	switch {
+	case pending != nil:
+		for _, v := range s.flagValueCompletions(c, pending.Name, word) {
+			add(v)
+		}
+	case strings.HasPrefix(word, "-"):
+		visit := func(f *pflag.Flag) {
+			if !f.Hidden {
+				add("--" + f.Name)
+			}
+		}
+		c.LocalFlags().VisitAll(visit)
+		c.InheritedFlags().VisitAll(visit)
+	case c.HasAvailableSubCommands() && len(args) == 0:
+		for _, sub := range c.Commands() {
+			if sub.IsAvailableCommand() {
+				add(sub.Name())
+			}
+		}
+		if c == s.root {
+			for _, b := range shellBuiltins {
+				add(b)
+			}
+		}
+	default:
+		for _, v := range c.ValidArgs {
+			add(v)
+		}
+		if c.ValidArgsFunction != nil {
+			c.SetContext(cligen.WithRuntime(s.app.contextWithApp(context.Background()), s.rt))
+			vals, _ := c.ValidArgsFunction(c, args, word)
+			c.SetContext(nil)
+			for _, v := range vals {
+				add(completionValue(v))
+			}
+		}
+	}
+	sort.Strings(cands)
+	return word, cands
+}
+
+func (s *shell) flagValueCompletions(c *cobra.Command, name, word string) []string {
+	fn, ok := c.GetFlagCompletionFunc(name)
+	if !ok {
+		return nil
+	}
+	vals, _ := fn(c, nil, word)
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		out = append(out, completionValue(v))
+	}
+	return out
+}
+
+// completionValue strips the description cobra allows after a tab.
+func completionValue(v string) string {
+	value, _, _ := strings.Cut(v, "\t")
+	return value
+}
+
+func lookupFlag(c *cobra.Command, name string) *pflag.Flag {
+	if f := c.LocalFlags().Lookup(name); f != nil {
+		return f
+	}
+	return c.InheritedFlags().Lookup(name)
+}
+
+func findSubcommand(c *cobra.Command, name string) *cobra.Command {
+	for _, sub := range c.Commands() {
+		if sub.Name() == name || sub.HasAlias(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// shellHistory is the terminal history, persisted one line per entry.
+type shellHistory struct {
+	path    string
+	entries []string // oldest first
+}
+
+func loadShellHistory(path string) *shellHistory {
+	h := &shellHistory{path: path}
+	if b, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if line != "" {
+				h.entries = append(h.entries, line)
+			}
+		}
+	}
+	if len(h.entries) > maxShellHistory {
+		h.entries = h.entries[len(h.entries)-maxShellHistory:]
+		_ = os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+	}
+	return h
+}
+
+// Add records a line, skipping repeats and lines that carry a secret.
+func (h *shellHistory) Add(entry string) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || carriesSecret(entry) {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+	_, _ = f.WriteString(entry + "\n")
+	_ = f.Close()
+}
+
+// carriesSecret reports whether line sets a flag or config key holding a
+// credential: --token, --secret, --client-secret=..., "set token ...",
+// "config set token ...". Lines that do not parse are treated as secret.
+func carriesSecret(line string) bool {
+	words, err := snippet.SplitShell(line)
+	if err != nil {
+		return true
+	}
+	if len(words) > 0 && words[0] == "mercury" {
+		words = words[1:]
+	}
+	switch {
+	case len(words) >= 2 && words[0] == "set":
+		if secretName(strings.TrimPrefix(words[1], "--")) {
+			return true
+		}
+	case len(words) >= 3 && words[0] == "config" && words[1] == "set":
+		if secretName(words[2]) {
+			return true
+		}
+	}
+	for _, w := range words {
+		if name, ok := strings.CutPrefix(w, "--"); ok {
+			name, _, _ = strings.Cut(name, "=")
+			if secretName(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// secretName reports whether a flag or config key name holds a credential.
+func secretName(name string) bool {
+	name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	switch name {
+	case "token", "secret", "password", "passphrase", "code", "code-verifier":
+		return true
+	}
+	for _, suffix := range []string{"-token", "-secret", "-password"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *shellHistory) Len() int { return len(h.entries) }
+
+// At returns the idx-th most recent entry.
+func (h *shellHistory) At(idx int) string { return h.entries[len(h.entries)-1-idx] }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -50,6 +51,7 @@ func newSpecCmd(specDocs []*openapi.SpecDoc) *cobra.Command {
 	specCmd.AddCommand(newSpecListCmd(specDocs))
 	specCmd.AddCommand(newSpecVerifyCmd(specDocs))
 	specCmd.AddCommand(newSpecUpdateCmd())
+	specCmd.AddCommand(newSpecCheckResponsesCmd(specDocs))
 
 	return specCmd
 }
@@ -166,3 +168,98 @@ func newSpecUpdateCmd() *cobra.Command {
 	cmd.Flags().StringVar(&outDir, "out-dir", "specs", "Output directory for spec files")
 	return cmd
 }
+
+func newSpecCheckResponsesCmd(specDocs []*openapi.SpecDoc) *cobra.Command {
+	var pathParams, queryParams []string
+	var only []string
+	cmd := &cobra.Command{
+		Use:   "check-responses",
+		Short: "Call GET operations and report responses that drift from the embedded specs",
+		Long: "Call GET operations and report responses that drift from the embedded specs.\n\n" +
+			"Every GET operation whose path parameters can be filled from --path-param is called with the\n" +
+			"current token and environment, and its 2xx body is validated against the response schema.\n" +
+			"Required query parameters are taken from --query-param, else from the example, default or enum\n" +
+			"in their schema; operations with one that has neither are skipped.\n" +
+			"Missing required fields, unknown enum values and type mismatches are reported.\n\n" +
+			"Example:\n" +
+			"  mercury spec check-responses --path-param accountId=acc_123 --only accounts/list-account-transactions\n",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rt, err := cligen.RuntimeFrom(cmd)
+			if err != nil {
+				return err
+			}
+
+			values, err := paramValues("path-param", pathParams)
+			if err != nil {
+				return err
+			}
+			queryValues, err := paramValues("query-param", queryParams)
+			if err != nil {
+				return err
+			}
+			selected := map[string]bool{}
+			for _, o := range only {
+				selected[o] = true
+			}
+
+			ops, err := cligen.ListOperations(specDocs)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			checked, drifted, failed := 0, 0, 0
+			for _, o := range ops {
+				id := o.Group + "/" + o.Name
+				if len(selected) > 0 && !selected[id] {
+					continue
+				}
+				if o.Method != http.MethodGet {
+					continue
+				}
+				r := cligen.CheckOperationResponse(cmd.Context(), rt, o, values, queryValues)
+				switch {
+				case r.Skipped != "":
+					fmt.Fprintf(out, "skip\t%s\t%s\n", id, r.Skipped)
+				case r.Err != nil:
+					failed++
+					fmt.Fprintf(out, "error\t%s\t%v\n", id, r.Err)
+				case len(r.Issues) > 0:
+					checked++
+					drifted++
+					fmt.Fprintf(out, "drift\t%s\t%d issue(s)\n", id, len(r.Issues))
+					for _, e := range r.Issues {
+						fmt.Fprintf(out, "  %s\n", e.Error())
+					}
+				default:
+					checked++
+					fmt.Fprintf(out, "ok\t%s\t%d\n", id, r.Status)
+				}
+			}
+			fmt.Fprintf(out, "checked=%d drift=%d errors=%d\n", checked, drifted, failed)
+			if drifted > 0 || failed > 0 {
+				return fmt.Errorf("response check failed (%d with drift, %d errors)", drifted, failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&pathParams, "path-param", nil, "Path parameter value: name=value (repeatable)")
+	cmd.Flags().StringArrayVar(&queryParams, "query-param", nil, "Required query parameter value: name=value (repeatable)")
+	cmd.Flags().StringArrayVar(&only, "only", nil, "Only check this operation: group/operation (repeatable)")
+	return cmd
+}
+
+// paramValues parses name=value pairs given with --<flag>.
+func paramValues(flag string, pairs []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, kv := range pairs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid --%s %q (expected name=value)", flag, kv)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+	"github.com/tarrence/mercury-cli/internal/output"
+	"github.com/tarrence/mercury-cli/internal/webhooks"
+)
+
+// addWebhookCommands adds the local development commands to the generated
+// webhooks group.
+func addWebhookCommands(root *cobra.Command, specDocs []*openapi.SpecDoc) {
+	for _, c := range root.Commands() {
+		if c.Name() == "webhooks" {
+			c.AddCommand(newWebhooksListenCmd())
+			c.AddCommand(newWebhooksReplayCmd())
+			c.AddCommand(newWebhooksTriggerCmd(specDocs))
+			return
+		}
+	}
+}
+
+// webhookSecret returns the --secret flag value, or MERCURY_WEBHOOK_SECRET.
+func webhookSecret(secret string) string {
+	if secret != "" {
+		return secret
+	}
+	return os.Getenv("MERCURY_WEBHOOK_SECRET")
+}
+
+func newWebhooksListenCmd() *cobra.Command {
+	var (
+		host           string
+		port           int
+		secret         string
+		header         string
+		tol            time.Duration
+		legacy         bool
+		forward        string
+		forwardTimeout time.Duration
+		logPath        string
+	)
+	cmd := &cobra.Command{
+		Use:   "listen",
+		Short: "Receive webhook deliveries locally, verify and print them",
+		Long: `Run a local HTTP receiver for webhook deliveries. Each delivery's signature is
+verified with --secret (or MERCURY_WEBHOOK_SECRET) and the event is printed
+through the usual output flags (--ndjson, --output table|csv, --query, ...).
+
+Verified deliveries can be forwarded to a local URL; the receiver answers with
+the forward's status, so a failing handler is redelivered. With --log they are
+appended to an NDJSON file for "mercury webhooks replay".
+
+Expose the port with a tunnel and register its URL with "webhooks create-webhook".`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rt, err := cligen.RuntimeFrom(cmd)
+			if err != nil {
+				return err
+			}
+			if port < 0 || port > 65535 {
+				return fmt.Errorf("--port: must be between 0 and 65535")
+			}
+			if tol < 0 {
+				return fmt.Errorf("--tolerance: must not be negative")
+			}
+			if forwardTimeout <= 0 {
+				return fmt.Errorf("--forward-timeout: must be positive")
+			}
+			p := rt.Printer
+			secret = webhookSecret(secret)
+			if secret == "" {
+				fmt.Fprintln(p.Err(), "warning: no --secret given; deliveries are accepted without verifying signatures")
+			} else if legacy {
+				fmt.Fprintln(p.Err(), "warning: --allow-legacy-signatures accepts signatures without a timestamp, which cannot be checked for replays")
+			}
+
+			var rows *output.RowWriter
+			if p.WritesRows() {
+				rows = p.NewRowWriter()
+			}
+			rc := &webhooks.Receiver{
+				Secret:          secret,
+				SignatureHeader: header,
+				Tolerance:       tol,
+				AllowLegacy:     legacy,
+				LogPath:         logPath,
+				Forward:         forward,
+				Client:          &http.Client{Timeout: forwardTimeout},
+				OnDelivery: func(d webhooks.Delivery, status int, forwardErr error) error {
+					if err := printDelivery(p, rows, d); err != nil {
+						return err
+					}
+					switch {
+					case forwardErr != nil:
+						fmt.Fprintf(p.Err(), "forward to %s failed: %v\n", forward, forwardErr)
+					case forward != "":
+						fmt.Fprintf(p.Err(), "forwarded %s to %s: %d\n", describeDelivery(d), forward, status)
+					}
+					return nil
+				},
+				OnReject: func(r *http.Request, err error) {
+					fmt.Fprintf(p.Err(), "rejected delivery from %s: %v\n", r.RemoteAddr, err)
+				},
+			}
+
+			ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				return fmt.Errorf("webhooks listen: %w", err)
+			}
+			fmt.Fprintf(p.Err(), "Listening for webhooks on http://%s\n", ln.Addr())
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			srv := &http.Server{Handler: rc, ReadHeaderTimeout: 10 * time.Second}
+			errc := make(chan error, 1)
+			go func() { errc <- srv.Serve(ln) }()
+
+			select {
+			case err := <-errc:
+				return fmt.Errorf("webhooks listen: %w", err)
+			case <-ctx.Done():
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("webhooks listen: %w", err)
+			}
+			if rows != nil {
+				return rows.Close()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&host, "host", "127.0.0.1", "Address to listen on")
+	cmd.Flags().IntVar(&port, "port", 9000, "Port to listen on (0 picks a free port)")
+	cmd.Flags().StringVar(&secret, "secret", "", "Webhook signing secret (or set MERCURY_WEBHOOK_SECRET)")
+	cmd.Flags().StringVar(&header, "signature-header", webhooks.SignatureHeader, "Header carrying the signature")
+	cmd.Flags().DurationVar(&tol, "tolerance", webhooks.DefaultTolerance, "Maximum age of a signed timestamp (0 disables the check)")
+	cmd.Flags().BoolVar(&legacy, "allow-legacy-signatures", false, "Also accept a bare hex HMAC of the body (optionally \"sha256=\"-prefixed), which has no timestamp to check")
+	cmd.Flags().StringVar(&forward, "forward", "", "POST verified deliveries to this URL")
+	cmd.Flags().DurationVar(&forwardTimeout, "forward-timeout", webhooks.DefaultSendTimeout, "Give up on a forward that has not answered after this long (the sender then gets a 502)")
+	cmd.Flags().StringVar(&logPath, "log", "", "Append verified deliveries to this NDJSON file")
+	return cmd
+}
+
+// printDelivery prints the event: a row for csv/tsv, a line for --ndjson and a
+// document otherwise.
+func printDelivery(p *output.Printer, rows *output.RowWriter, d webhooks.Delivery) error {
+	if rows == nil && (!p.NDJSONEnabled() || p.Format() == output.FormatTable) {
+		return p.PrintBody(d.Body)
+	}
+	var ev any
+	if err := json.Unmarshal(d.Body, &ev); err != nil {
+		return err
+	}
+	if rows != nil {
+		return rows.WriteItems([]any{ev})
+	}
+	return p.PrintItem(ev)
+}
+
+func describeDelivery(d webhooks.Delivery) string {
+	desc := d.EventType()
+	if desc == "" {
+		desc = "event"
+	}
+	if id := d.EventID(); id != "" {
+		desc += " " + id
+	}
+	return desc
+}
+
+func newWebhooksReplayCmd() *cobra.Command {
+	var (
+		to         string
+		secret     string
+		header     string
+		eventTypes []string
+		ids        []string
+	)
+	cmd := &cobra.Command{
+		Use:   "replay <log.ndjson>",
+		Short: "Re-send deliveries recorded by webhooks listen --log",
+		Long: `Re-send deliveries from an NDJSON log written by "webhooks listen --log" to a
+URL, oldest first. With --secret each delivery is signed again with a current
+timestamp; otherwise the recorded signature headers are sent as they were.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if to == "" {
+				return fmt.Errorf("--to is required")
+			}
+			deliveries, err := webhooks.ReadLog(args[0])
+			if err != nil {
+				return err
+			}
+			secret = webhookSecret(secret)
+			sent, failed := 0, 0
+			for _, d := range deliveries {
+				if len(eventTypes) > 0 && !slices.Contains(eventTypes, d.EventType()) {
+					continue
+				}
+				if len(ids) > 0 && !slices.Contains(ids, d.EventID()) {
+					continue
+				}
+				var override map[string]string
+				if secret != "" {
+					override = map[string]string{header: webhooks.Sign(secret, d.Body, time.Now())}
+				}
+				sent++
+				status, err := webhooks.Send(cmd.Context(), nil, to, d, override)
+				switch {
+				case err != nil:
+					failed++
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", describeDelivery(d), err)
+				case status < 200 || status >= 300:
+					failed++
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: HTTP %d\n", describeDelivery(d), status)
+				default:
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: HTTP %d\n", describeDelivery(d), status)
+				}
+			}
+			if sent == 0 {
+				return fmt.Errorf("no deliveries in %s match", args[0])
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d deliveries failed", failed, sent)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&to, "to", "", "URL to send the deliveries to")
+	cmd.Flags().StringVar(&secret, "secret", "", "Re-sign deliveries with this secret (or set MERCURY_WEBHOOK_SECRET)")
+	cmd.Flags().StringVar(&header, "signature-header", webhooks.SignatureHeader, "Header carrying the signature")
+	cmd.Flags().StringSliceVar(&eventTypes, "event-type", nil, "Only replay these event types (e.g. transaction.created)")
+	cmd.Flags().StringSliceVar(&ids, "id", nil, "Only replay events with these IDs")
+	return cmd
+}
+
+// webhookEventSpec returns the spec declaring the webhook event types.
+func webhookEventSpec(specDocs []*openapi.SpecDoc) *openapi.Spec {
+	for _, doc := range specDocs {
+		if len(webhooks.EventTypes(doc.Spec)) > 0 {
+			return doc.Spec
+		}
+	}
+	return nil
+}
+
+func newWebhooksTriggerCmd(specDocs []*openapi.SpecDoc) *cobra.Command {
+	var (
+		to     string
+		secret string
+		header string
+		file   string
+	)
+	spec := webhookEventSpec(specDocs)
+	var eventTypes []string
+	if spec != nil {
+		eventTypes = webhooks.EventTypes(spec)
+	}
+	cmd := &cobra.Command{
+		Use:   "trigger [event-type]",
+		Short: "Send a synthesized, signed webhook event to a local URL",
+		Long: `Synthesize an event of the given type from the webhook event schemas in the
+embedded specs, sign it with --secret (or MERCURY_WEBHOOK_SECRET) and POST it to
+--to, the way a delivery from Mercury would arrive. Use --file to send a fixture
+payload instead. The event is printed; without --to it is only printed, along
+with its signature header on stderr.
+
+Event types: ` + strings.Join(eventTypes, ", "),
+		Args:          cobra.MaximumNArgs(1),
+		ValidArgs:     eventTypes,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rt, err := cligen.RuntimeFrom(cmd)
+			if err != nil {
+				return err
+			}
+			var body []byte
+			switch {
+			case file != "" && len(args) > 0:
+				return fmt.Errorf("give an event type or --file, not both")
+			case file != "":
+				if body, err = os.ReadFile(file); err != nil {
+					return err
+				}
+				if !json.Valid(body) {
+					return fmt.Errorf("--file: %s is not valid JSON", file)
+				}
+			case len(args) == 0:
+				return fmt.Errorf("an event type or --file is required (one of: %s)", strings.Join(eventTypes, ", "))
+			case spec == nil:
+				return fmt.Errorf("no webhook event schemas in the embedded specs")
+			default:
+				now := time.Now()
+				body, err = webhooks.SynthesizeEvent(spec, args[0], strconv.FormatInt(now.UnixNano(), 10), now)
+				if err != nil {
+					return err
+				}
+			}
+
+			p := rt.Printer
+			d := webhooks.Delivery{ReceivedAt: time.Now().UTC(), Headers: map[string]string{}, Body: body}
+			secret = webhookSecret(secret)
+			if secret != "" {
+				d.Headers[header] = webhooks.Sign(secret, body, d.ReceivedAt)
+			}
+			if err := p.PrintBody(body); err != nil {
+				return err
+			}
+			if to == "" {
+				if sig := d.Headers[header]; sig != "" {
+					fmt.Fprintf(p.Err(), "%s: %s\n", header, sig)
+				}
+				return nil
+			}
+			if secret == "" {
+				fmt.Fprintln(p.Err(), "warning: no --secret given; sending the event unsigned")
+			}
+			status, err := webhooks.Send(cmd.Context(), nil, to, d, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %w", describeDelivery(d), err)
+			}
+			if status < 200 || status >= 300 {
+				return fmt.Errorf("%s: HTTP %d", describeDelivery(d), status)
+			}
+			fmt.Fprintf(p.Err(), "%s: HTTP %d\n", describeDelivery(d), status)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&to, "to", "", "URL to send the event to")
+	cmd.Flags().StringVar(&secret, "secret", "", "Webhook signing secret (or set MERCURY_WEBHOOK_SECRET)")
+	cmd.Flags().StringVar(&header, "signature-header", webhooks.SignatureHeader, "Header carrying the signature")
+	cmd.Flags().StringVar(&file, "file", "", "Send this JSON payload instead of a synthesized event")
+	return cmd
+}
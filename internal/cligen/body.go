@@ -2,15 +2,19 @@ package cligen
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+	"github.com/tarrence/mercury-cli/internal/snippet"
 )
 
 type bodyFlags struct {
@@ -21,25 +25,55 @@ type bodyFlags struct {
 	data        *string
 	contentType *string
 	form        *[]string
+
+	// fields are typed flags generated from the JSON body schema; objects hold the
+	// required-property constraints for the objects those flags populate.
+	fields  []*bodyField
+	objects []bodyObject
+
+	// spec and schema describe the JSON body, used for client-side validation.
+	spec           *openapi.Spec
+	schema         *openapi.Schema
+	skipValidation *bool
+
+	// idempotencyKey is set when the JSON body has a top-level idempotencyKey property.
+	idempotencyKey bool
 }
 
-func bindBodyFlags(cmd *cobra.Command, required bool, supportedContentTypes []string) *bodyFlags {
+func bindBodyFlags(cmd *cobra.Command, spec *openapi.Spec, rb *openapi.RequestBody, taken func(string) bool) *bodyFlags {
+	cts := make([]string, 0, len(rb.Content))
+	for ct := range rb.Content {
+		cts = append(cts, ct)
+	}
+	sort.Strings(cts)
+
 	b := &bodyFlags{
-		required:              required,
-		supportedContentTypes: append([]string(nil), supportedContentTypes...),
+		required:              rb.Required,
+		supportedContentTypes: cts,
 		data:                  new(string),
 		contentType:           new(string),
 		form:                  new([]string),
+		skipValidation:        new(bool),
 	}
 
 	cmd.Flags().StringVar(b.data, "data", "", "Request body data: '@file.json', '-' for stdin, or inline string")
 	cmd.Flags().StringVar(b.contentType, "content-type", "", "Override request Content-Type")
 	cmd.Flags().StringArrayVar(b.form, "form", nil, "Form field: key=value or key=@file (repeatable)")
 
+	if ct := b.defaultDataContentType(); strings.HasPrefix(ct, "application/json") {
+		b.spec = spec
+		b.schema = rb.Content[ct].Schema
+		cmd.Flags().BoolVar(b.skipValidation, "skip-validation", false, "Send the JSON body without validating it against the OpenAPI schema")
+		b.fields, b.objects = bindBodyFieldFlags(cmd, spec, b.schema, taken)
+		b.idempotencyKey = schemaHasProperty(spec, b.schema, idempotencyKeyField)
+	}
+
 	return b
 }
 
-func (b *bodyFlags) build(cmd *cobra.Command) (body []byte, contentType string, err error) {
+// build encodes the request body from the flags. When keys is set and the JSON
+// body takes an idempotencyKey, a key is added unless the user gave one.
+func (b *bodyFlags) build(cmd *cobra.Command, keys *idempotencyKeys) (body []byte, contentType string, err error) {
 	if b == nil || cmd == nil {
 		return nil, "", nil
 	}
@@ -61,13 +95,20 @@ func (b *bodyFlags) build(cmd *cobra.Command) (body []byte, contentType string,
 
 	hasForm := formChanged && len(*b.form) > 0
 	hasData := dataChanged && strings.TrimSpace(*b.data) != ""
+	hasFields := b.fieldsChanged(cmd)
 
-	if b.required && !hasForm && !hasData {
+	if b.required && !hasForm && !hasData && !hasFields {
+		if len(b.fields) > 0 {
+			return nil, "", fmt.Errorf("request body required; provide --data, --form or body field flags")
+		}
 		return nil, "", fmt.Errorf("request body required; provide --data or --form")
 	}
-	if !hasForm && !hasData {
+	if !hasForm && !hasData && !hasFields {
 		return nil, "", nil
 	}
+	if hasForm && hasFields {
+		return nil, "", fmt.Errorf("body field flags cannot be combined with --form")
+	}
 
 	if hasForm {
 		if selectedCT == "" {
@@ -77,7 +118,7 @@ func (b *bodyFlags) build(cmd *cobra.Command) (body []byte, contentType string,
 			}
 		}
 	}
-	if hasData {
+	if hasData || hasFields {
 		if selectedCT == "" {
 			selectedCT = b.defaultDataContentType()
 			if selectedCT == "" {
@@ -88,13 +129,24 @@ func (b *bodyFlags) build(cmd *cobra.Command) (body []byte, contentType string,
 
 	switch {
 	case strings.HasPrefix(selectedCT, "application/json"):
-		if !hasData {
-			return nil, "", fmt.Errorf("JSON request body requires --data")
+		var raw []byte
+		if hasFields {
+			raw, err = b.buildJSON(cmd, hasData, keys)
+		} else {
+			if !hasData {
+				return nil, "", fmt.Errorf("JSON request body requires --data")
+			}
+			raw, err = readDataArg(*b.data)
+			if err == nil {
+				raw, err = b.addIdempotencyKey(raw, keys)
+			}
 		}
-		raw, err := readDataArg(*b.data)
 		if err != nil {
 			return nil, "", err
 		}
+		if err := b.validate(raw); err != nil {
+			return nil, "", err
+		}
 		return raw, selectedCT, nil
 
 	case strings.HasPrefix(selectedCT, "application/x-www-form-urlencoded"):
@@ -158,10 +210,126 @@ func (b *bodyFlags) build(cmd *cobra.Command) (body []byte, contentType string,
 		return buf.Bytes(), w.FormDataContentType(), nil
 
 	default:
+		if hasFields {
+			return nil, "", fmt.Errorf("body field flags require a JSON content-type (got %q)", selectedCT)
+		}
 		return nil, "", fmt.Errorf("unsupported content-type %q", selectedCT)
 	}
 }
 
+// multipartFields returns the --form entries of a multipart body, with files kept
+// as paths, for rendering request snippets. It returns nil for other bodies.
+func (b *bodyFlags) multipartFields(contentType string) []snippet.FormField {
+	if b == nil || !strings.HasPrefix(contentType, "multipart/form-data") {
+		return nil
+	}
+	fields := make([]snippet.FormField, 0, len(*b.form))
+	for _, entry := range *b.form {
+		k, v, _ := strings.Cut(entry, "=")
+		if path, ok := strings.CutPrefix(v, "@"); ok {
+			fields = append(fields, snippet.FormField{Name: k, Value: path, File: true})
+		} else {
+			fields = append(fields, snippet.FormField{Name: k, Value: v})
+		}
+	}
+	return fields
+}
+
+func (b *bodyFlags) fieldsChanged(cmd *cobra.Command) bool {
+	for _, f := range b.fields {
+		if f.changed(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildJSON assembles a JSON object body from --data (as the base, if given) and
+// the typed body field flags, which override values from --data.
+func (b *bodyFlags) buildJSON(cmd *cobra.Command, hasData bool, keys *idempotencyKeys) ([]byte, error) {
+	obj := map[string]any{}
+	if hasData {
+		raw, err := readDataArg(*b.data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+			return nil, fmt.Errorf("--data must be a JSON object when combined with body field flags")
+		}
+	}
+
+	check := !*b.skipValidation
+	for _, f := range b.fields {
+		if !f.changed(cmd) {
+			continue
+		}
+		v, err := f.value(check)
+		if err != nil {
+			return nil, err
+		}
+		if err := setPath(obj, f.path, v); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := b.setIdempotencyKey(obj, keys); err != nil {
+		return nil, err
+	}
+	if !check {
+		return json.Marshal(obj)
+	}
+
+	var missing []string
+	for _, o := range b.objects {
+		v, ok := lookupPath(obj, o.path)
+		m, isObj := v.(map[string]any)
+		if !ok || !isObj {
+			continue
+		}
+		for _, r := range o.required {
+			if _, ok := m[r]; !ok {
+				missing = append(missing, b.describeField(append(append([]string(nil), o.path...), r)))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required body field(s): %s", strings.Join(missing, ", "))
+	}
+
+	return json.Marshal(obj)
+}
+
+// validate checks a JSON body against the operation's request schema unless
+// --skip-validation is set.
+func (b *bodyFlags) validate(raw []byte) error {
+	if b.schema == nil || *b.skipValidation {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("request body is not valid JSON: %w (use --skip-validation to send anyway)", err)
+	}
+	errs := b.spec.Validate(b.schema, v)
+	if len(errs) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, "  "+e.Error())
+	}
+	return fmt.Errorf("request body failed validation (use --skip-validation to send anyway):\n%s", strings.Join(lines, "\n"))
+}
+
+// describeField names a body property by its flag when one exists, else by its JSON path.
+func (b *bodyFlags) describeField(path []string) string {
+	joined := strings.Join(path, ".")
+	for _, f := range b.fields {
+		if strings.Join(f.path, ".") == joined {
+			return "--" + f.flagNames[0]
+		}
+	}
+	return joined
+}
+
 func readDataArg(arg string) ([]byte, error) {
 	arg = strings.TrimSpace(arg)
 	switch {
@@ -0,0 +1,386 @@
+package cligen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// maxBodyFlagDepth bounds how far nested objects are expanded into dotted flags.
+// Deeper objects are accepted as a JSON value on the parent flag.
+const maxBodyFlagDepth = 4
+
+// bodyFlagPrefix names the flag of a body property whose own name is already a flag.
+const bodyFlagPrefix = "body-"
+
+// bodyField is a flag generated from a property of the JSON request body schema.
+type bodyField struct {
+	path      []string
+	flagNames []string
+	kind      paramKind
+
+	// itemType is the schema type of array elements (kindStringArray only).
+	itemType string
+	enum     []string
+
+	s  *string
+	i  *int
+	b  *bool
+	f  *float64
+	sa *[]string
+}
+
+// bodyObject records the required properties of an object reachable through body flags.
+type bodyObject struct {
+	path     []string
+	required []string
+}
+
+// bindBodyFieldFlags walks the flattened JSON request body schema and registers one
+// flag per leaf property. A property whose name is already taken (by a parameter,
+// built-in flag or inherited persistent flag) gets a --body-<name> flag instead; if
+// that is taken too, the command's help says the property can only be set via --data.
+func bindBodyFieldFlags(cmd *cobra.Command, spec *openapi.Spec, schema *openapi.Schema, taken func(string) bool) ([]*bodyField, []bodyObject) {
+	if spec == nil || schema == nil {
+		return nil, nil
+	}
+	root := spec.FlattenSchema(schema)
+	if root == nil || !strings.EqualFold(root.Type, "object") || len(root.Properties) == 0 {
+		return nil, nil
+	}
+
+	var fields []*bodyField
+	var objects []bodyObject
+
+	var walk func(s *openapi.Schema, path []string, depth int)
+	walk = func(s *openapi.Schema, path []string, depth int) {
+		objects = append(objects, bodyObject{path: path, required: append([]string(nil), s.Required...)})
+
+		names := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prop := s.Properties[name]
+			ps := spec.FlattenSchema(&prop)
+			if ps == nil {
+				continue
+			}
+			propPath := append(append([]string(nil), path...), name)
+
+			if strings.EqualFold(ps.Type, "object") && len(ps.Properties) > 0 && depth < maxBodyFlagDepth {
+				walk(ps, propPath, depth+1)
+				continue
+			}
+
+			f := newBodyField(spec, ps, propPath)
+			if f == nil {
+				continue
+			}
+			f.register(cmd, ps, contains(s.Required, name), taken)
+			if len(f.flagNames) > 0 {
+				fields = append(fields, f)
+			}
+		}
+	}
+	walk(root, nil, 0)
+	return fields, objects
+}
+
+func newBodyField(spec *openapi.Spec, s *openapi.Schema, path []string) *bodyField {
+	segs := make([]string, 0, len(path))
+	for _, p := range path {
+		k := kebabCase(p)
+		if k == "" {
+			return nil
+		}
+		segs = append(segs, k)
+	}
+	primary := strings.Join(segs, ".")
+	raw := strings.Join(path, ".")
+
+	f := &bodyField{
+		path:      path,
+		flagNames: []string{primary},
+		s:         new(string),
+		i:         new(int),
+		b:         new(bool),
+		f:         new(float64),
+		sa:        new([]string),
+	}
+	if raw != primary {
+		f.flagNames = append(f.flagNames, raw)
+	}
+
+	switch strings.ToLower(s.Type) {
+	case "string":
+		f.kind = kindString
+		f.enum = enumStrings(s.Enum)
+	case "integer":
+		f.kind = kindInt
+	case "number":
+		f.kind = kindFloat
+	case "boolean":
+		f.kind = kindBool
+	case "array":
+		f.kind = kindStringArray
+		if s.Items != nil {
+			if item := spec.FlattenSchema(s.Items); item != nil {
+				f.itemType = strings.ToLower(item.Type)
+				f.enum = enumStrings(item.Enum)
+			}
+		}
+	default:
+		// Free-form objects, oneOf/anyOf and untyped schemas take a JSON value.
+		f.kind = kindJSON
+		f.enum = enumStrings(s.Enum)
+	}
+	return f
+}
+
+func (f *bodyField) register(cmd *cobra.Command, s *openapi.Schema, required bool, taken func(string) bool) {
+	free := func(n string) bool { return !taken(n) && cmd.Flags().Lookup(n) == nil }
+
+	// A property whose name is already a flag is offered as --body-<name>.
+	candidates := f.flagNames
+	if !free(candidates[0]) {
+		candidates = make([]string, len(f.flagNames))
+		for i, n := range f.flagNames {
+			candidates[i] = bodyFlagPrefix + n
+		}
+	}
+	var names []string
+	for _, n := range candidates {
+		if free(n) {
+			names = append(names, n)
+		}
+	}
+	// The primary name must be available; otherwise the property is left to --data.
+	if len(names) == 0 || names[0] != candidates[0] {
+		noteDataOnlyField(cmd, f.path)
+		f.flagNames = nil
+		return
+	}
+	f.flagNames = names
+
+	desc := bodyFieldHelp(s, f, required)
+	for i, n := range names {
+		usage := desc
+		if i > 0 {
+			usage = "alias for --" + names[0]
+		}
+		switch f.kind {
+		case kindInt:
+			cmd.Flags().IntVar(f.i, n, 0, usage)
+		case kindBool:
+			cmd.Flags().BoolVar(f.b, n, false, usage)
+		case kindFloat:
+			cmd.Flags().Float64Var(f.f, n, 0, usage)
+		case kindStringArray:
+			cmd.Flags().StringArrayVar(f.sa, n, nil, usage)
+		default:
+			cmd.Flags().StringVar(f.s, n, "", usage)
+		}
+		if i > 0 {
+			_ = cmd.Flags().MarkHidden(n)
+		}
+	}
+	completeEnum(cmd, names, f.enum)
+}
+
+// noteDataOnlyField adds a line to cmd's help for a body property that has no flag.
+func noteDataOnlyField(cmd *cobra.Command, path []string) {
+	cmd.Long = strings.TrimRight(cmd.Long, "\n") + "\n\nBody field " + strings.Join(path, ".") + " has no flag; set it with --data."
+}
+
+func bodyFieldHelp(s *openapi.Schema, f *bodyField, required bool) string {
+	desc := strings.TrimSpace(s.Description)
+	if desc == "" {
+		desc = "Body field " + strings.Join(f.path, ".")
+	}
+
+	var hints []string
+	switch f.kind {
+	case kindStringArray:
+		typ := f.itemType
+		if typ == "" {
+			typ = "string"
+		}
+		hints = append(hints, typ+"[], repeatable")
+	case kindJSON:
+		hints = append(hints, "JSON")
+	default:
+		if t := strings.TrimSpace(s.Type); t != "" {
+			if s.Format != "" {
+				t += " (" + strings.TrimSpace(s.Format) + ")"
+			}
+			hints = append(hints, t)
+		}
+	}
+	if len(f.enum) > 0 {
+		hints = append(hints, "one of: "+strings.Join(f.enum, ", "))
+	}
+	if required {
+		hints = append(hints, "required")
+	}
+	if len(hints) == 0 {
+		return desc
+	}
+	return desc + " [" + strings.Join(hints, "; ") + "]"
+}
+
+func (f *bodyField) changed(cmd *cobra.Command) bool {
+	for _, n := range f.flagNames {
+		if cmd.Flags().Changed(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// value converts the flag value to the JSON value for the body, validating enums
+// when checkEnums is set.
+func (f *bodyField) value(checkEnums bool) (any, error) {
+	name := "--" + f.flagNames[0]
+	enum := f.enum
+	if !checkEnums {
+		enum = nil
+	}
+	switch f.kind {
+	case kindString:
+		if err := checkEnum(name, enum, *f.s); err != nil {
+			return nil, err
+		}
+		return *f.s, nil
+	case kindInt:
+		return *f.i, nil
+	case kindFloat:
+		return *f.f, nil
+	case kindBool:
+		return *f.b, nil
+	case kindStringArray:
+		out := make([]any, 0, len(*f.sa))
+		for _, raw := range *f.sa {
+			if err := checkEnum(name, enum, raw); err != nil {
+				return nil, err
+			}
+			v, err := convertScalar(name, f.itemType, raw)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	default:
+		if err := checkEnum(name, enum, *f.s); err != nil {
+			return nil, err
+		}
+		var v any
+		if err := json.Unmarshal([]byte(*f.s), &v); err != nil {
+			return nil, fmt.Errorf("invalid %s: expected JSON value: %w", name, err)
+		}
+		return v, nil
+	}
+}
+
+func convertScalar(flag string, typ string, raw string) (any, error) {
+	switch typ {
+	case "", "string":
+		return raw, nil
+	case "integer":
+		i, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: expected integer", flag, raw)
+		}
+		return i, nil
+	case "number":
+		n, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: expected number", flag, raw)
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: expected boolean", flag, raw)
+		}
+		return b, nil
+	default:
+		var v any
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: expected JSON %s", flag, raw, typ)
+		}
+		return v, nil
+	}
+}
+
+func checkEnum(flag string, enum []string, v string) error {
+	if len(enum) == 0 || contains(enum, v) {
+		return nil
+	}
+	return fmt.Errorf("invalid %s value %q (expected one of: %s)", flag, v, strings.Join(enum, ", "))
+}
+
+func enumStrings(enum []any) []string {
+	out := make([]string, 0, len(enum))
+	for _, e := range enum {
+		if e == nil {
+			continue
+		}
+		out = append(out, fmt.Sprint(e))
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// setPath assigns v at path inside obj, creating intermediate objects as needed.
+func setPath(obj map[string]any, path []string, v any) error {
+	cur := obj
+	for i, key := range path[:len(path)-1] {
+		next, ok := cur[key]
+		if !ok || next == nil {
+			m := map[string]any{}
+			cur[key] = m
+			cur = m
+			continue
+		}
+		m, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("cannot set %s: %s is %T, not an object", strings.Join(path, "."), strings.Join(path[:i+1], "."), next)
+		}
+		cur = m
+	}
+	cur[path[len(path)-1]] = v
+	return nil
+}
+
+// lookupPath returns the value at path inside obj.
+func lookupPath(obj map[string]any, path []string) (any, bool) {
+	var cur any = obj
+	for _, key := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
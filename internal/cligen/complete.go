@@ -0,0 +1,420 @@
+package cligen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/mercuryhttp"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+const (
+	// idCacheTTL is how long listed IDs are reused before being fetched again.
+	idCacheTTL = 2 * time.Minute
+	// completionTimeout bounds the request made to complete an ID.
+	completionTimeout = 5 * time.Second
+)
+
+// nameFields are the item properties that name a listed resource, in the order
+// they are preferred for describing it.
+var nameFields = []string{"nickname", "name", "legalBusinessName", "counterpartyName", "description", "email", "fileName"}
+
+// listSource is a GET operation whose response lists resources with IDs.
+type listSource struct {
+	op genOp
+	// itemField is the response array holding the items; empty when the
+	// response itself is the array.
+	itemField string
+	// itemName and idName are the component names of the item schema and of
+	// its id property's schema, when they are references.
+	itemName string
+	idName   string
+}
+
+// listSources finds the operations that list resources with an id property.
+func listSources(ops []genOp) []listSource {
+	var out []listSource
+	for _, g := range ops {
+		if g.method != http.MethodGet {
+			continue
+		}
+		resp := jsonResponseSchema(g.spec, g.op, "200")
+		if resp == nil {
+			continue
+		}
+		add := func(field string, items *openapi.Schema) {
+			if items == nil {
+				return
+			}
+			item := g.spec.FlattenSchema(items)
+			if item == nil {
+				return
+			}
+			id, ok := item.Properties["id"]
+			if !ok {
+				return
+			}
+			out = append(out, listSource{op: g, itemField: field, itemName: schemaRefName(items), idName: schemaRefName(&id)})
+		}
+		top := g.spec.FlattenSchema(resp)
+		if top == nil {
+			continue
+		}
+		// DerefSchema keeps items' $ref, which names the item schema.
+		if strings.EqualFold(top.Type, "array") {
+			add("", g.spec.DerefSchema(resp).Items)
+			continue
+		}
+		for _, name := range top.PropertyNames() {
+			prop := top.Properties[name]
+			if ps := g.spec.DerefSchema(&prop); strings.EqualFold(ps.Type, "array") {
+				add(name, ps.Items)
+			}
+		}
+	}
+	return out
+}
+
+// schemaRefName returns the component name s refers to, directly or through a
+// single allOf.
+func schemaRefName(s *openapi.Schema) string {
+	for s != nil {
+		if s.Ref != "" {
+			return s.Ref[strings.LastIndexByte(s.Ref, '/')+1:]
+		}
+		if len(s.AllOf) != 1 {
+			return ""
+		}
+		s = s.AllOf[0]
+	}
+	return ""
+}
+
+// score rates how likely src lists the values of path parameter param:
+// matching id schemas (ApiWebhookEndpointId for webhookEndpointId), item
+// schemas (Account for accountId) and field or path names (accounts) count.
+func (src listSource) score(param string) int {
+	resource := strings.ToLower(strings.TrimSuffix(param, "Id"))
+	score := 0
+	if strings.EqualFold(strings.TrimPrefix(src.idName, "Api"), param) {
+		score += 3
+	}
+	item := strings.ToLower(src.itemName)
+	for _, suffix := range []string{"responsedata", "response", "data", "info"} {
+		item = strings.TrimSuffix(item, suffix)
+	}
+	switch {
+	case item == "":
+	case item == resource:
+		score += 3
+	case strings.HasPrefix(item, resource) || strings.HasSuffix(item, resource):
+		score += 2
+	}
+	if f := strings.ToLower(src.itemField); f == resource || f == resource+"s" {
+		score += 2
+	}
+	segs := strings.Split(strings.Trim(src.op.path, "/"), "/")
+	for i := len(segs) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(segs[i], "{") {
+			if s := strings.ToLower(segs[i]); s == resource || s == resource+"s" {
+				score += 2
+			}
+			break
+		}
+	}
+	return score
+}
+
+// listsIn returns the list operations declared by spec.
+func listsIn(lists []listSource, spec *openapi.Spec) []listSource {
+	var out []listSource
+	for _, src := range lists {
+		if src.op.spec == spec {
+			out = append(out, src)
+		}
+	}
+	return out
+}
+
+// pathSources returns the list operation for each of pathParams, or nil when
+// none of them has one.
+func pathSources(lists []listSource, pathParams []string) []*listSource {
+	sources := make([]*listSource, len(pathParams))
+	found := false
+	for i, p := range pathParams {
+		if sources[i] = idSourceFor(lists, p, pathParams[:i]); sources[i] != nil {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return sources
+}
+
+// idSourceFor picks the list operation to take param's values from. Its own
+// path parameters must be among bound, the parameters before param; each one
+// it uses scores a point, so listing within an account beats listing all.
+func idSourceFor(lists []listSource, param string, bound []string) *listSource {
+	var best *listSource
+	bestScore := 0
+	for i := range lists {
+		src := &lists[i]
+		score := src.score(param)
+		if score < 3 {
+			continue
+		}
+		usable := true
+		for _, p := range extractPathParams(src.op.path) {
+			if !contains(bound, p) {
+				usable = false
+				break
+			}
+			score++
+		}
+		if usable && score > bestScore {
+			best, bestScore = src, score
+		}
+	}
+	return best
+}
+
+// idItem is a listed resource: its ID and the names it can be recognized by.
+type idItem struct {
+	ID     string   `json:"id"`
+	Names  []string `json:"names,omitempty"`
+	Amount *float64 `json:"amount,omitempty"`
+}
+
+// description is shown beside the ID in completions.
+func (it idItem) description() string {
+	var parts []string
+	if len(it.Names) > 0 {
+		parts = append(parts, it.Names[0])
+	}
+	if it.Amount != nil {
+		parts = append(parts, strconv.FormatFloat(*it.Amount, 'f', 2, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+// endpoint returns the URL of src with its path parameters set from values.
+func (src *listSource) endpoint(rt *Runtime, values map[string]string) (string, error) {
+	expanded := src.op.path
+	for _, name := range extractPathParams(src.op.path) {
+		expanded = strings.ReplaceAll(expanded, "{"+name+"}", url.PathEscape(values[name]))
+	}
+	baseURL, err := resolveBaseURL(rt, src.op.spec, src.op.op)
+	if err != nil {
+		return "", err
+	}
+	if baseURL == "" {
+		return "", fmt.Errorf("no server URL found for %s %s (%s)", src.op.method, src.op.path, src.op.specDocName)
+	}
+	return joinBaseAndPath(baseURL, expanded)
+}
+
+// idList is the first page of a list operation's items. More is set when the
+// response says there are further pages.
+type idList struct {
+	Items []idItem `json:"items"`
+	More  bool     `json:"more,omitempty"`
+}
+
+// list returns the items listed at endpoint, reusing a recent result from
+// rt.CacheDir.
+func (src *listSource) list(ctx context.Context, rt *Runtime, token, endpoint string) (*idList, error) {
+	cachePath := ""
+	if rt.CacheDir != "" {
+		sum := sha256.Sum256([]byte(rt.Env + "\n" + endpoint + "\n" + src.itemField + "\n" + token))
+		cachePath = filepath.Join(rt.CacheDir, "ids", hex.EncodeToString(sum[:12])+".json")
+		if list, ok := readIDCache(cachePath); ok {
+			return list, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		mercuryhttp.ApplyAuth(req, token, rt.Auth)
+	}
+	res, err := rt.Client.Do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status < 200 || res.Status >= 300 {
+		return nil, fmt.Errorf("%s %s: HTTP %d", src.op.method, src.op.path, res.Status)
+	}
+	list, err := src.items(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if cachePath != "" {
+		writeIDCache(cachePath, list)
+	}
+	return list, nil
+}
+
+// items extracts the IDs and names from a list response body, and whether
+// the response points to a next page in any of the styles fetchAll follows.
+func (src *listSource) items(body []byte) (*idList, error) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	list := &idList{}
+	raw, _ := v.([]any)
+	if src.itemField != "" {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unexpected JSON response type %T", v)
+		}
+		raw, _ = obj[src.itemField].([]any)
+		list.More = cursorNextToken(obj) != "" || stringField(obj, "next_page_token") != "" ||
+			intFromAny(obj["total"]) > len(raw)
+	}
+	for _, r := range raw {
+		it, _ := r.(map[string]any)
+		id := scalarString(it["id"])
+		if id == "" {
+			continue
+		}
+		item := idItem{ID: id}
+		for _, f := range nameFields {
+			if s, ok := it[f].(string); ok && strings.TrimSpace(s) != "" {
+				item.Names = append(item.Names, strings.TrimSpace(s))
+			}
+		}
+		if amount, ok := it["amount"].(float64); ok {
+			item.Amount = &amount
+		}
+		list.Items = append(list.Items, item)
+	}
+	return list, nil
+}
+
+func scalarString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+type idCacheFile struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	idList
+}
+
+func readIDCache(path string) (*idList, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var f idCacheFile
+	if json.Unmarshal(b, &f) != nil || time.Since(f.FetchedAt) > idCacheTTL {
+		return nil, false
+	}
+	return &f.idList, true
+}
+
+// writeIDCache saves list; failures only cost a later refetch.
+func writeIDCache(path string, list *idList) {
+	b, err := json.Marshal(idCacheFile{FetchedAt: time.Now(), idList: *list})
+	if err != nil {
+		return
+	}
+	writeCacheFile(path, b)
+}
+
+// writeCacheFile replaces path with b, creating its directory, so that
+// concurrent readers never see a partial file. Errors are ignored.
+func writeCacheFile(path string, b []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cache-*")
+	if err != nil {
+		return
+	}
+	_, werr := tmp.Write(b)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil || os.Rename(tmp.Name(), path) != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// completePathArgs completes each path argument with the IDs its list
+// operation returns, described by their names. sources[i] is the list
+// operation for the i-th path parameter, or nil.
+func completePathArgs(pathParams []string, sources []*listSource) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		if len(args) >= len(sources) || sources[len(args)] == nil || cmd.Context() == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var rt *Runtime
+		var err error
+		if load, ok := cmd.Context().Value(runtimeLoaderKey{}).(func(*cobra.Command) (*Runtime, error)); ok {
+			rt, err = load(cmd)
+		} else {
+			rt, err = RuntimeFrom(cmd)
+		}
+		if err != nil {
+			cobra.CompDebugln(err.Error(), true)
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		values := map[string]string{}
+		for i, a := range args {
+			values[pathParams[i]] = a
+		}
+		ctx, cancel := context.WithTimeout(cmd.Context(), completionTimeout)
+		defer cancel()
+		list, err := func() (*idList, error) {
+			token, err := rt.ResolveToken(ctx)
+			if err != nil {
+				return nil, err
+			}
+			endpoint, err := sources[len(args)].endpoint(rt, values)
+			if err != nil {
+				return nil, err
+			}
+			return sources[len(args)].list(ctx, rt, token, endpoint)
+		}()
+		if err != nil {
+			cobra.CompDebugln(err.Error(), true)
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var out []cobra.Completion
+		for _, it := range list.Items {
+			if strings.HasPrefix(it.ID, toComplete) {
+				out = append(out, cobra.CompletionWithDesc(it.ID, it.description()))
+			}
+		}
+		return out, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeEnum completes the named flags with a schema's enum values.
+func completeEnum(cmd *cobra.Command, names []string, enum []string) {
+	if len(enum) == 0 {
+		return
+	}
+	for _, n := range names {
+		_ = cmd.RegisterFlagCompletionFunc(n, cobra.FixedCompletions(enum, cobra.ShellCompDirectiveNoFileComp))
+	}
+}
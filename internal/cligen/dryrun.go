@@ -0,0 +1,82 @@
+package cligen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tarrence/mercury-cli/internal/output"
+	"github.com/tarrence/mercury-cli/internal/snippet"
+)
+
+// errDryRun stops an operation after its first request has been printed.
+var errDryRun = errors.New("dry run")
+
+// dryRunDone turns errDryRun into success.
+func dryRunDone(err error) error {
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// dryRunRequest is the --dry-run description of a request.
+type dryRunRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Query   map[string][]string `json:"query,omitempty"`
+	Headers map[string]string   `json:"headers"`
+	Body    any                 `json:"body,omitempty"`
+}
+
+// printDryRun prints req with credentials redacted. JSON bodies are embedded as
+// JSON, other text bodies as strings, and binary bodies by size only.
+func printDryRun(p *output.Printer, req *http.Request, body []byte) error {
+	d := dryRunRequest{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: map[string]string{},
+	}
+	if q := req.URL.Query(); len(q) > 0 {
+		d.Query = q
+	}
+	for k, vv := range req.Header {
+		v := strings.Join(vv, ", ")
+		if strings.EqualFold(k, "Authorization") || strings.EqualFold(k, "Proxy-Authorization") {
+			scheme, _, _ := strings.Cut(v, " ")
+			v = scheme + " <redacted>"
+		}
+		d.Headers[k] = v
+	}
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		d.Body = json.RawMessage(body)
+	case utf8.Valid(body):
+		d.Body = string(body)
+	default:
+		d.Body = fmt.Sprintf("<%d bytes>", len(body))
+	}
+	return p.PrintJSON(d)
+}
+
+// printSnippet prints req as a curl, HTTPie or Go snippet. The token is replaced
+// by a reference to $MERCURY_TOKEN.
+func printSnippet(p *output.Printer, format string, req *http.Request, body []byte, form []snippet.FormField) error {
+	s, err := snippet.Render(format, snippet.Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   body,
+		Form:   form,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(p.Out(), s)
+	return err
+}
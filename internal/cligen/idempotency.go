@@ -0,0 +1,191 @@
+package cligen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/idempotency"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// idempotencyKeyField is the JSON body property Mercury deduplicates payments on.
+const idempotencyKeyField = "idempotencyKey"
+
+// idempotencyPlan says where an operation takes an idempotency key.
+type idempotencyPlan struct {
+	// bodyField is set when the JSON body has a top-level idempotencyKey property.
+	bodyField bool
+	// header is the name of an Idempotency-Key header parameter, if any.
+	header string
+}
+
+// detectIdempotencyPlan finds how a POST or PATCH operation accepts an
+// idempotency key. It returns nil for other methods and for operations that
+// take none.
+func detectIdempotencyPlan(method string, params []openapi.Parameter, body *bodyFlags) *idempotencyPlan {
+	if method != http.MethodPost && method != http.MethodPatch {
+		return nil
+	}
+	plan := &idempotencyPlan{bodyField: body.hasIdempotencyKey()}
+	for _, p := range params {
+		if strings.EqualFold(p.In, "header") && strings.EqualFold(p.Name, "Idempotency-Key") {
+			plan.header = p.Name
+		}
+	}
+	if !plan.bodyField && plan.header == "" {
+		return nil
+	}
+	return plan
+}
+
+// describeFlags notes in the help of the key's flag that it is optional.
+func (p *idempotencyPlan) describeFlags(cmd *cobra.Command) {
+	names := []string{kebabCase(p.header)}
+	if p.bodyField {
+		names = append(names, kebabCase(idempotencyKeyField))
+	}
+	for _, n := range names {
+		f := cmd.Flags().Lookup(n)
+		if f == nil {
+			continue
+		}
+		f.Usage = strings.Replace(f.Usage, "; required]", "; generated when omitted]", 1)
+	}
+}
+
+// hasIdempotencyKey reports whether the JSON body schema has an idempotencyKey property.
+func (b *bodyFlags) hasIdempotencyKey() bool {
+	return b != nil && b.idempotencyKey
+}
+
+// schemaHasProperty reports whether the flattened object schema has property name.
+func schemaHasProperty(spec *openapi.Spec, schema *openapi.Schema, name string) bool {
+	root := spec.FlattenSchema(schema)
+	if root == nil {
+		return false
+	}
+	_, ok := root.Properties[name]
+	return ok
+}
+
+// idempotencyKeys hands out the idempotency key for one request: the key of an
+// earlier unfinished attempt at the same request when the journal has one, else
+// a new key. Keys given explicitly by the user are left alone.
+type idempotencyKeys struct {
+	journal *idempotency.Journal
+	// record is false when the request is only printed (--dry-run, --as-*).
+	record bool
+	warn   io.Writer
+
+	method string
+	url    string
+
+	// attached is set once the request carries a key; fingerprint is set when
+	// that key is in the journal.
+	attached    bool
+	fingerprint string
+
+	// pending is a newly generated key, journaled under pendingFingerprint by
+	// commit.
+	pending            *idempotency.Entry
+	pendingFingerprint string
+}
+
+// key returns the key for a request whose body, without any key, is body.
+func (k *idempotencyKeys) key(body []byte) (string, error) {
+	k.attached = true
+	if k.journal == nil {
+		return idempotency.NewKey()
+	}
+	fp := idempotency.Fingerprint(k.method, k.url, body)
+	e, ok, err := k.journal.Lookup(fp)
+	if err != nil {
+		return "", fmt.Errorf("idempotency journal: %w", err)
+	}
+	if ok {
+		fmt.Fprintf(k.warn, "Reusing idempotency key %s from an unfinished attempt at %s (%s).\n", e.Key, e.Request, e.Created.Local().Format("2006-01-02 15:04"))
+		k.fingerprint = fp
+		return e.Key, nil
+	}
+	key, err := idempotency.NewKey()
+	if err != nil {
+		return "", err
+	}
+	if k.record {
+		k.pending = &idempotency.Entry{Key: key, Request: k.method + " " + k.url}
+		k.pendingFingerprint = fp
+	}
+	return key, nil
+}
+
+// commit journals a newly generated key. It is called once the request has
+// passed local checks and is about to be sent, so that a request that never
+// went out leaves no entry for a corrected re-run to reuse.
+func (k *idempotencyKeys) commit() error {
+	if k.pending == nil {
+		return nil
+	}
+	if err := k.journal.Add(k.pendingFingerprint, *k.pending); err != nil {
+		return fmt.Errorf("idempotency journal: %w", err)
+	}
+	k.fingerprint, k.pending = k.pendingFingerprint, nil
+	return nil
+}
+
+// done forgets the journal entry once the server has answered definitively.
+// 429 and 5xx responses leave it in place: the request may have been applied,
+// so a re-run must send the same key.
+func (k *idempotencyKeys) done(status int) error {
+	if k.fingerprint == "" || !k.record || status == http.StatusTooManyRequests || status >= 500 {
+		return nil
+	}
+	if err := k.journal.Remove(k.fingerprint); err != nil {
+		return fmt.Errorf("idempotency journal: %w", err)
+	}
+	return nil
+}
+
+// addIdempotencyKey sets the idempotencyKey property of a JSON object body
+// unless the user gave one. Bodies that are not objects are returned unchanged
+// for validation to report.
+func (b *bodyFlags) addIdempotencyKey(raw []byte, keys *idempotencyKeys) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return raw, nil
+	}
+	added, err := b.setIdempotencyKey(obj, keys)
+	if err != nil || !added {
+		return raw, err
+	}
+	return json.Marshal(obj)
+}
+
+// setIdempotencyKey is addIdempotencyKey for a decoded body. It reports whether
+// it added a key.
+func (b *bodyFlags) setIdempotencyKey(obj map[string]any, keys *idempotencyKeys) (bool, error) {
+	if keys == nil || !b.hasIdempotencyKey() {
+		return false, nil
+	}
+	if v, ok := obj[idempotencyKeyField].(string); ok && v != "" {
+		keys.attached = true
+		return false, nil
+	}
+	delete(obj, idempotencyKeyField)
+	canonical, err := json.Marshal(obj)
+	if err != nil {
+		return false, err
+	}
+	key, err := keys.key(canonical)
+	if err != nil {
+		return false, err
+	}
+	obj[idempotencyKeyField] = key
+	return true, nil
+}
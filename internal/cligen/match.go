@@ -0,0 +1,119 @@
+package cligen
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URLMatch is the operation that serves a concrete request URL.
+type URLMatch struct {
+	Operation
+	// Env is the environment whose server URL matched ("prod" or "sandbox").
+	// It is empty when only the path matched, in which case BaseURL is set to the
+	// request's scheme, host and server path prefix.
+	Env     string
+	BaseURL string
+	// PathArgs are the values of the path template parameters, in order.
+	PathArgs []string
+}
+
+// MatchURL finds the operation for method and rawURL. Operations on the same
+// host win over path-only matches, and templates with more literal segments win
+// over less specific ones (/accounts/search over /accounts/{id}).
+func MatchURL(ops []Operation, method, rawURL string) (*URLMatch, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", rawURL)
+	}
+	method = strings.ToUpper(method)
+
+	var best *URLMatch
+	bestScore := -1
+	for _, op := range ops {
+		if op.Method != method {
+			continue
+		}
+		for _, env := range []string{"prod", "sandbox"} {
+			tmpl, err := op.URL(env, "")
+			if err != nil {
+				continue
+			}
+			tu, err := url.Parse(tmpl)
+			if err != nil {
+				continue
+			}
+			args, literals, ok := matchPathTemplate(tu.Path, u.EscapedPath())
+			if !ok {
+				continue
+			}
+			score := literals * 2
+			m := &URLMatch{Operation: op, PathArgs: args}
+			if strings.EqualFold(tu.Host, u.Host) {
+				score += 1000
+				m.Env = env
+			} else {
+				m.BaseURL = u.Scheme + "://" + u.Host + strings.TrimSuffix(tu.Path, op.Path)
+			}
+			if env == "prod" {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = m, score
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no operation matches %s %s", method, u.Path)
+	}
+	return best, nil
+}
+
+// matchPathTemplate matches an escaped request path against a path template such
+// as /account/{accountId}/transactions, returning the unescaped parameter values
+// and the number of literal segments.
+func matchPathTemplate(template, path string) ([]string, int, bool) {
+	ts := strings.Split(strings.Trim(template, "/"), "/")
+	ps := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ts) != len(ps) {
+		return nil, 0, false
+	}
+	var args []string
+	literals := 0
+	for i, t := range ts {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			v, err := url.PathUnescape(ps[i])
+			if err != nil || v == "" {
+				return nil, 0, false
+			}
+			args = append(args, v)
+			continue
+		}
+		if t != ps[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return args, literals, true
+}
+
+// ParamFlag returns the flag generated for the operation's parameter name in
+// "query" or "header" (header names match case-insensitively).
+func (o Operation) ParamFlag(in, name string) (string, bool) {
+	params, err := o.Spec.OperationParameters(o.Op)
+	if err != nil {
+		return "", false
+	}
+	for _, p := range params {
+		if !strings.EqualFold(p.In, in) {
+			continue
+		}
+		if p.Name == name || (strings.EqualFold(in, "header") && strings.EqualFold(p.Name, name)) {
+			return kebabCase(p.Name), true
+		}
+	}
+	return "", false
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/tarrence/mercury-cli/internal/mercuryhttp"
 	"github.com/tarrence/mercury-cli/internal/openapi"
+	"github.com/tarrence/mercury-cli/internal/output"
 )
 
 type genOp struct {
@@ -31,6 +32,58 @@ type genOp struct {
 }
 
 func AddOpenAPICommands(root *cobra.Command, docs []*openapi.SpecDoc) error {
+	ops, err := collectOperations(docs)
+	if err != nil {
+		return err
+	}
+
+	// Generated flags must not shadow persistent flags defined on the root command.
+	inheritedFlag := func(name string) bool {
+		return name == "help" || root.PersistentFlags().Lookup(name) != nil
+	}
+
+	lists := listSources(ops)
+	groupCmds := map[string]*cobra.Command{}
+	seen := map[string]map[string]genOp{} // group -> cmdName -> op
+
+	for _, g := range ops {
+		group := groupCmds[g.groupName]
+		if group == nil {
+			short := strings.TrimSpace(g.tagDescription)
+			if short == "" {
+				short = g.tag
+			}
+			group = &cobra.Command{
+				Use:           g.groupName,
+				Short:         short,
+				SilenceUsage:  true,
+				SilenceErrors: true,
+			}
+			groupCmds[g.groupName] = group
+			root.AddCommand(group)
+			seen[g.groupName] = map[string]genOp{}
+		}
+
+		if _, ok := seen[g.groupName][g.cmdName]; ok {
+			prev := seen[g.groupName][g.cmdName]
+			return fmt.Errorf("duplicate command name %q in group %q (%s %s conflicts with %s %s)",
+				g.cmdName, g.groupName, g.method, g.path, prev.method, prev.path)
+		}
+		seen[g.groupName][g.cmdName] = g
+
+		opCmd, err := buildOperationCmd(g, listsIn(lists, g.spec), inheritedFlag)
+		if err != nil {
+			return err
+		}
+		group.AddCommand(opCmd)
+	}
+
+	return nil
+}
+
+// collectOperations walks every operation in docs and returns them sorted by
+// group, command name, method and path.
+func collectOperations(docs []*openapi.SpecDoc) ([]genOp, error) {
 	var ops []genOp
 	for _, doc := range docs {
 		if doc == nil || doc.Spec == nil {
@@ -66,7 +119,7 @@ func AddOpenAPICommands(root *cobra.Command, docs []*openapi.SpecDoc) error {
 					continue
 				}
 				if strings.TrimSpace(op.OperationID) == "" {
-					return fmt.Errorf("%s %s %s missing operationId", doc.Filename, method, p)
+					return nil, fmt.Errorf("%s %s %s missing operationId", doc.Filename, method, p)
 				}
 
 				tag := "misc"
@@ -105,46 +158,12 @@ func AddOpenAPICommands(root *cobra.Command, docs []*openapi.SpecDoc) error {
 		}
 		return ops[i].path < ops[j].path
 	})
-
-	groupCmds := map[string]*cobra.Command{}
-	seen := map[string]map[string]genOp{} // group -> cmdName -> op
-
-	for _, g := range ops {
-		group := groupCmds[g.groupName]
-		if group == nil {
-			short := strings.TrimSpace(g.tagDescription)
-			if short == "" {
-				short = g.tag
-			}
-			group = &cobra.Command{
-				Use:           g.groupName,
-				Short:         short,
-				SilenceUsage:  true,
-				SilenceErrors: true,
-			}
-			groupCmds[g.groupName] = group
-			root.AddCommand(group)
-			seen[g.groupName] = map[string]genOp{}
-		}
-
-		if _, ok := seen[g.groupName][g.cmdName]; ok {
-			prev := seen[g.groupName][g.cmdName]
-			return fmt.Errorf("duplicate command name %q in group %q (%s %s conflicts with %s %s)",
-				g.cmdName, g.groupName, g.method, g.path, prev.method, prev.path)
-		}
-		seen[g.groupName][g.cmdName] = g
-
-		opCmd, err := buildOperationCmd(g)
-		if err != nil {
-			return err
-		}
-		group.AddCommand(opCmd)
-	}
-
-	return nil
+	return ops, nil
 }
 
-func buildOperationCmd(g genOp) (*cobra.Command, error) {
+// buildOperationCmd builds the command for g. lists are the list operations of
+// g's spec, used to complete and resolve resource IDs.
+func buildOperationCmd(g genOp, lists []listSource, inheritedFlag func(string) bool) (*cobra.Command, error) {
 	spec := g.spec
 	op := g.op
 
@@ -168,30 +187,42 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 		SilenceErrors: true,
 	}
 
-	queryBindings, err := bindParams(cmd, spec, op.Parameters, "query")
+	params, err := spec.OperationParameters(op)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", g.method, g.path, err)
+	}
+	queryBindings, err := bindParams(cmd, spec, params, "query")
 	if err != nil {
 		return nil, err
 	}
-	headerBindings, err := bindParams(cmd, spec, op.Parameters, "header")
+	headerBindings, err := bindParams(cmd, spec, params, "header")
 	if err != nil {
 		return nil, err
 	}
 
 	var body *bodyFlags
 	if op.RequestBody != nil {
-		if op.RequestBody.Ref != "" {
-			return nil, fmt.Errorf("unsupported requestBody $ref %q", op.RequestBody.Ref)
+		rb, err := spec.ResolveRequestBody(op.RequestBody)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: requestBody: %w", g.method, g.path, err)
 		}
-		if len(op.RequestBody.Content) > 0 {
-			cts := make([]string, 0, len(op.RequestBody.Content))
-			for ct := range op.RequestBody.Content {
-				cts = append(cts, ct)
-			}
-			sort.Strings(cts)
-			body = bindBodyFlags(cmd, op.RequestBody.Required, cts)
+		if len(rb.Content) > 0 {
+			body = bindBodyFlags(cmd, spec, rb, inheritedFlag)
 		}
 	}
 
+	// Resource IDs are completed from, and may be given by a name found by, the
+	// matching list operations.
+	sources := pathSources(lists, pathParams)
+	if sources != nil {
+		cmd.ValidArgsFunction = completePathArgs(pathParams, sources)
+	}
+	idFlags := idFlags(lists, pathParams, queryBindings, body)
+
+	idemPlan := detectIdempotencyPlan(g.method, params, body)
+	if idemPlan != nil {
+		idemPlan.describeFlags(cmd)
+	}
 	pagPlan := detectPaginationPlan(spec, op)
 	allFlag := new(bool)
 	maxPages := new(int)
@@ -202,6 +233,8 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 		cmd.Flags().IntVar(sleepMS, "sleep-ms", 0, "Sleep between pages when using --all")
 	}
 
+	shape := tableShape(spec, op, pagPlan)
+
 	requiresAuth := spec.OperationRequiresAuth(op)
 	method := g.method
 	pathTemplate := g.path
@@ -216,22 +249,30 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 		if err != nil {
 			return err
 		}
-		if requiresAuth && strings.TrimSpace(rt.Token) == "" {
+		rt.Printer.SetShape(shape)
+		token, err := rt.ResolveToken(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if requiresAuth && token == "" && !rt.DryRun && rt.Snippet == "" && !rt.Client.Replaying() {
 			// The error body is likely the most useful output; print a clear hint too.
 			fmt.Fprintf(rt.Printer.Err(), "Missing token for %s/%s %s %s. Set MERCURY_TOKEN or pass --token.\n", tag, cmdName, method, pathTemplate)
 			return fmt.Errorf("missing token")
 		}
 
-		baseURL := strings.TrimSpace(rt.BaseURL)
+		baseURL, err := resolveBaseURL(rt, spec, op)
+		if err != nil {
+			return err
+		}
 		if baseURL == "" {
-			baseURL = strings.TrimSpace(spec.ServerURLForOperation(op))
-			if baseURL == "" {
-				return fmt.Errorf("no server URL found for %s %s (%s)", method, pathTemplate, specDocName)
-			}
-			baseURL, err = applyEnvToServerURL(baseURL, rt.Env)
-			if err != nil {
-				return err
-			}
+			return fmt.Errorf("no server URL found for %s %s (%s)", method, pathTemplate, specDocName)
+		}
+
+		// Outside GETs the path names the resource acted on, as in the account
+		// money is sent from, so like body fields it must be named exactly.
+		args, err = resolveNames(cmd, rt, token, pathParams, sources, method != http.MethodGet, idFlags, args)
+		if err != nil {
+			return err
 		}
 
 		expandedPath := pathTemplate
@@ -264,10 +305,23 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 				endpoint = u.String()
 			}
 
+			// Requests that take an idempotency key get one, so that retries and
+			// re-runs after an unknown outcome are deduplicated by the server.
+			var keys *idempotencyKeys
+			if idemPlan != nil {
+				keys = &idempotencyKeys{
+					journal: rt.Idempotency,
+					record:  !rt.DryRun && rt.Snippet == "",
+					warn:    rt.Printer.Err(),
+					method:  method,
+					url:     endpoint,
+				}
+			}
+
 			var reqBody []byte
 			ct := ""
 			if body != nil {
-				reqBody, ct, err = body.build(cmd)
+				reqBody, ct, err = body.build(cmd, keys)
 				if err != nil {
 					return nil, err
 				}
@@ -297,21 +351,65 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 					req.Header.Add(k, v)
 				}
 			}
+			if keys != nil && idemPlan.header != "" {
+				if req.Header.Get(idemPlan.header) != "" {
+					keys.attached = true
+				} else {
+					key, err := keys.key(reqBody)
+					if err != nil {
+						return nil, err
+					}
+					req.Header.Set(idemPlan.header, key)
+				}
+			}
+			if keys != nil && keys.attached {
+				req = mercuryhttp.WithIdempotencyKey(req)
+			}
 
 			// Apply auth when a token is present, even if the spec does not mark the operation as secured.
 			// The spec security metadata isn't always complete (e.g., some onboarding endpoints).
-			if strings.TrimSpace(rt.Token) != "" {
-				mercuryhttp.ApplyAuth(req, rt.Token, rt.Auth)
+			if token != "" {
+				mercuryhttp.ApplyAuth(req, token, rt.Auth)
+			}
+
+			// --dry-run and --as-* print the request instead of sending it;
+			// errDryRun also stops --all after the first page.
+			if rt.DryRun || rt.Snippet != "" {
+				rt.Client.Prepare(req)
+				if rt.Snippet != "" {
+					err = printSnippet(rt.Printer, rt.Snippet, req, reqBody, body.multipartFields(ct))
+				} else {
+					err = printDryRun(rt.Printer, req, reqBody)
+				}
+				if err != nil {
+					return nil, err
+				}
+				return nil, errDryRun
 			}
 
+			if keys != nil {
+				if err := keys.commit(); err != nil {
+					return nil, err
+				}
+			}
 			res, err := rt.Client.Do(req, reqBody)
 			if err != nil {
 				return nil, err
 			}
+			if keys != nil {
+				if err := keys.done(res.Status); err != nil {
+					return nil, err
+				}
+			}
 			if res.Status >= 400 {
 				_ = rt.Printer.PrintHTTPError(res.Status, res.Headers, res.Body)
 				return nil, fmt.Errorf("HTTP %d", res.Status)
 			}
+			if rt.ValidateResponse {
+				if issues := validateResponse(spec, op, res); len(issues) > 0 {
+					reportResponseDrift(rt.Printer.Err(), method, req.URL.Path, res.Status, issues)
+				}
+			}
 			return res, nil
 		}
 
@@ -320,9 +418,38 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 				return fmt.Errorf("--all is only supported for GET operations")
 			}
 			sleep := time.Duration(*sleepMS) * time.Millisecond
-			pres, err := fetchAll(pagPlan, q, *maxPages, sleep, do)
+
+			// CSV/TSV rows are written as each page arrives instead of buffering every item.
+			if rt.Printer.WritesRows() {
+				rw := rt.Printer.NewRowWriter()
+				var kept []any
+				write := rw.WriteItems
+				if rt.Capture != nil {
+					write = func(items []any) error {
+						kept = append(kept, items...)
+						return rw.WriteItems(items)
+					}
+				}
+				pres, err := fetchAll(pagPlan, q, *maxPages, sleep, do, write)
+				if err != nil {
+					return dryRunDone(err)
+				}
+				if err := rw.Close(); err != nil {
+					return err
+				}
+				if rt.Capture != nil {
+					b, err := json.Marshal(map[string]any{pagPlan.itemField: kept})
+					if err != nil {
+						return err
+					}
+					rt.capture(b)
+				}
+				return rt.Printer.PrintHTTP(pres.LastStatus, pres.LastHeaders, nil)
+			}
+
+			pres, err := fetchAll(pagPlan, q, *maxPages, sleep, do, nil)
 			if err != nil {
-				return err
+				return dryRunDone(err)
 			}
 
 			// Print status/headers (if enabled) once for the final successful page.
@@ -330,38 +457,47 @@ func buildOperationCmd(g genOp) (*cobra.Command, error) {
 				return err
 			}
 
-			if rt.Printer.NDJSONEnabled() {
-				for _, item := range pres.Items {
-					line, err := json.Marshal(item)
+			combined := func() ([]byte, error) {
+				outObj := pres.LastObject
+				if outObj == nil {
+					outObj = map[string]any{}
+				}
+				outObj[pagPlan.itemField] = pres.Items
+				if pagPlan.mode == paginateOffset && pagPlan.totalField != "" && pres.FirstTotal != nil {
+					outObj[pagPlan.totalField] = pres.FirstTotal
+				}
+				return json.Marshal(outObj)
+			}
+
+			if rt.Printer.NDJSONEnabled() && rt.Printer.Format() != output.FormatTable {
+				if rt.Capture != nil {
+					b, err := combined()
 					if err != nil {
 						return err
 					}
-					if _, err := rt.Printer.Out().Write(append(line, '\n')); err != nil {
+					rt.capture(b)
+				}
+				for _, item := range pres.Items {
+					if err := rt.Printer.PrintItem(item); err != nil {
 						return err
 					}
 				}
 				return nil
 			}
 
-			outObj := pres.LastObject
-			if outObj == nil {
-				outObj = map[string]any{}
-			}
-			outObj[pagPlan.itemField] = pres.Items
-			if pagPlan.mode == paginateOffset && pagPlan.totalField != "" && pres.FirstTotal != nil {
-				outObj[pagPlan.totalField] = pres.FirstTotal
-			}
-			b, err := json.Marshal(outObj)
+			b, err := combined()
 			if err != nil {
 				return err
 			}
+			rt.capture(b)
 			return rt.Printer.PrintBody(b)
 		}
 
 		res, err := do(q)
 		if err != nil {
-			return err
+			return dryRunDone(err)
 		}
+		rt.capture(res.Body)
 		return rt.Printer.PrintHTTP(res.Status, res.Headers, res.Body)
 	}
 
@@ -387,8 +523,8 @@ func jsonResponseSchema(spec *openapi.Spec, op *openapi.Operation, statusCode st
 	if spec == nil || op == nil {
 		return nil
 	}
-	resp, ok := op.Responses[statusCode]
-	if !ok {
+	resp, err := spec.OperationResponse(op, statusCode)
+	if err != nil || resp == nil {
 		return nil
 	}
 	for ct, mt := range resp.Content {
@@ -0,0 +1,178 @@
+package cligen
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+func loadFixtureDocs(t *testing.T, names ...string) []*openapi.SpecDoc {
+	t.Helper()
+	var docs []*openapi.SpecDoc
+	for _, name := range names {
+		b, err := os.ReadFile("../openapi/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var spec openapi.Spec
+		if err := json.Unmarshal(b, &spec); err != nil {
+			t.Fatalf("parse %s: %v", name, err)
+		}
+		docs = append(docs, &openapi.SpecDoc{Name: name, Filename: name, Spec: &spec})
+	}
+	return docs
+}
+
+func findCmd(t *testing.T, root *cobra.Command, args ...string) *cobra.Command {
+	t.Helper()
+	c, _, err := root.Find(args)
+	if err != nil || c == root {
+		t.Fatalf("command %v not found: %v", args, err)
+	}
+	return c
+}
+
+func TestAddOpenAPICommandsResolvesRefs(t *testing.T) {
+	docs := loadFixtureDocs(t, "refs.json")
+	root := &cobra.Command{Use: "test"}
+	if err := AddOpenAPICommands(root, docs); err != nil {
+		t.Fatalf("AddOpenAPICommands: %v", err)
+	}
+
+	list := findCmd(t, root, "widgets", "list-widgets")
+	for _, name := range []string{"limit", "start-after", "order", "all"} {
+		if list.Flags().Lookup(name) == nil {
+			t.Fatalf("expected --%s on list-widgets", name)
+		}
+	}
+
+	create := findCmd(t, root, "widgets", "create-widget")
+	if create.Flags().Lookup("data") == nil {
+		t.Fatalf("expected --data on create-widget")
+	}
+}
+
+func TestBodyFieldFlagFallback(t *testing.T) {
+	docs := loadFixtureDocs(t, "refs.json")
+	root := &cobra.Command{Use: "test"}
+	root.PersistentFlags().Bool("name", false, "")
+	root.PersistentFlags().Bool("id", false, "")
+	root.PersistentFlags().Bool("body-id", false, "")
+	if err := AddOpenAPICommands(root, docs); err != nil {
+		t.Fatalf("AddOpenAPICommands: %v", err)
+	}
+
+	create := findCmd(t, root, "widgets", "create-widget")
+	if create.Flags().Lookup("body-name") == nil {
+		t.Fatalf("expected --body-name for the body's name on create-widget")
+	}
+	if create.LocalFlags().Lookup("body-id") != nil {
+		t.Fatalf("expected no local --body-id on create-widget")
+	}
+	if !strings.Contains(create.Long, "Body field id has no flag; set it with --data.") {
+		t.Fatalf("expected help to point id at --data, got %q", create.Long)
+	}
+}
+
+func TestAddOpenAPICommandsRejectsDanglingRef(t *testing.T) {
+	docs := loadFixtureDocs(t, "refs.json")
+	docs[0].Spec.Paths["/widgets"].Get.Parameters = append(docs[0].Spec.Paths["/widgets"].Get.Parameters,
+		openapi.Parameter{Ref: "#/components/parameters/Missing"})
+	root := &cobra.Command{Use: "test"}
+	if err := AddOpenAPICommands(root, docs); err == nil {
+		t.Fatalf("expected error for dangling parameter $ref")
+	}
+}
+
+func TestIDSourceFor(t *testing.T) {
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := collectOperations(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lists := listSources(ops)
+	for _, tc := range []struct {
+		param string
+		bound []string
+		want  string
+	}{
+		{"accountId", nil, "get-accounts"},
+		{"recipientId", nil, "get-recipients"},
+		{"transactionId", nil, "list-transactions"},
+		{"transactionId", []string{"accountId"}, "list-account-transactions"},
+		{"webhookEndpointId", nil, "get-webhooks"},
+		{"safeRequestId", nil, "get-safe-requests"},
+		{"statementId", nil, ""},
+		{"requestId", nil, ""},
+	} {
+		got := ""
+		if src := idSourceFor(lists, tc.param, tc.bound); src != nil {
+			got = src.op.cmdName
+		}
+		if got != tc.want {
+			t.Fatalf("idSourceFor(%s, %v) = %q, want %q", tc.param, tc.bound, got, tc.want)
+		}
+	}
+
+	for field, want := range map[string]string{
+		"recipientId":          "get-recipients",
+		"destinationAccountId": "get-accounts",
+		"categoryId":           "list-categories",
+		"resourceId":           "",
+		"accountNumber":        "",
+	} {
+		got := ""
+		if src := idSourceForField(lists, field, nil); src != nil {
+			got = src.op.cmdName
+		}
+		if got != want {
+			t.Fatalf("idSourceForField(%s) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestListItemsMore(t *testing.T) {
+	src := &listSource{itemField: "accounts"}
+	for body, want := range map[string]bool{
+		`{"accounts":[{"id":"a"}]}`:                         false,
+		`{"accounts":[{"id":"a"}],"total":1}`:               false,
+		`{"accounts":[{"id":"a"}],"total":3}`:               true,
+		`{"accounts":[{"id":"a"}],"page":{"nextPage":"b"}}`: true,
+		`{"accounts":[{"id":"a"}],"next_page_token":"tok"}`: true,
+	} {
+		list, err := src.items([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != 1 || list.More != want {
+			t.Fatalf("items(%s) = %+v, want one item and More=%v", body, list, want)
+		}
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	op := &openapi.Operation{Parameters: []openapi.Parameter{
+		{Name: "start", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Example: "2024-01-01"}},
+		{Name: "kind", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Enum: []any{"a", "b"}}},
+		{Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer", Example: 10.0}},
+		{Name: "org", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+	}}
+	o := Operation{Spec: &openapi.Spec{}, Op: op}
+	if _, missing, err := checkQuery(o, nil); err != nil || missing != "org" {
+		t.Fatalf("checkQuery without org = %q, %v", missing, err)
+	}
+	q, missing, err := checkQuery(o, map[string]string{"org": "o1", "kind": "b"})
+	if err != nil || missing != "" {
+		t.Fatalf("checkQuery = %q, %v", missing, err)
+	}
+	if got := q.Encode(); got != "kind=b&org=o1&start=2024-01-01" {
+		t.Fatalf("query %q", got)
+	}
+}
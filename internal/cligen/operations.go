@@ -0,0 +1,110 @@
+package cligen
+
+import (
+	"fmt"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// Operation describes a generated command and the OpenAPI operation behind it.
+type Operation struct {
+	SpecName string
+	Spec     *openapi.Spec
+	Op       *openapi.Operation
+
+	Method string
+	Path   string
+
+	// Group and Name are the generated command names: mercury <Group> <Name>.
+	Group string
+	Name  string
+}
+
+// PathParams returns the path template parameter names in order.
+func (o Operation) PathParams() []string {
+	return extractPathParams(o.Path)
+}
+
+// URL returns the operation's endpoint on baseURL, or on its declared server for
+// env when baseURL is empty. The path template is left unexpanded.
+func (o Operation) URL(env string, baseURL string) (string, error) {
+	baseURL, err := resolveBaseURL(&Runtime{Env: env, BaseURL: baseURL}, o.Spec, o.Op)
+	if err != nil {
+		return "", err
+	}
+	if baseURL == "" {
+		return "", fmt.Errorf("no server URL found for %s %s (%s)", o.Method, o.Path, o.SpecName)
+	}
+	return joinBaseAndPath(baseURL, o.Path)
+}
+
+// ListOperations returns every operation that AddOpenAPICommands would generate,
+// in the same order.
+func ListOperations(docs []*openapi.SpecDoc) ([]Operation, error) {
+	ops, err := collectOperations(docs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Operation, 0, len(ops))
+	for _, g := range ops {
+		out = append(out, Operation{
+			SpecName: g.specDocName,
+			Spec:     g.spec,
+			Op:       g.op,
+			Method:   g.method,
+			Path:     g.path,
+			Group:    g.groupName,
+			Name:     g.cmdName,
+		})
+	}
+	return out, nil
+}
+
+// Pagination describes how an operation's list responses are paged, as followed
+// by --all.
+type Pagination struct {
+	// Mode is "cursor", "offset" or "page_token".
+	Mode string
+	// QueryParam is the request parameter that selects the page.
+	QueryParam string
+	// ItemField is the response array holding the page's items.
+	ItemField string
+	// NextField is the response field carrying the next page token
+	// ("page.nextPage" for cursor paging); empty for offset paging.
+	NextField string
+	// TotalField is the response field with the item count for offset paging.
+	TotalField string
+}
+
+// Pagination returns the operation's paging style, or nil when --all does not
+// apply to it.
+func (o Operation) Pagination() *Pagination {
+	plan := detectPaginationPlan(o.Spec, o.Op)
+	if plan == nil {
+		return nil
+	}
+	p := &Pagination{
+		QueryParam: plan.queryParam,
+		ItemField:  plan.itemField,
+		NextField:  plan.nextTokenField,
+		TotalField: plan.totalField,
+	}
+	switch plan.mode {
+	case paginateCursor:
+		p.Mode = "cursor"
+	case paginateOffset:
+		p.Mode = "offset"
+	case paginatePageToken:
+		p.Mode = "page_token"
+	default:
+		return nil
+	}
+	return p
+}
+
+// MatchPath matches an escaped request path against the operation's path
+// template, returning the path argument values and the number of literal
+// segments matched.
+func (o Operation) MatchPath(path string) ([]string, int, bool) {
+	return matchPathTemplate(o.Path, path)
+}
@@ -54,8 +54,12 @@ func detectPaginationPlan(spec *openapi.Spec, op *openapi.Operation) *pagination
 		return nil
 	}
 
+	params, err := spec.OperationParameters(op)
+	if err != nil {
+		return nil
+	}
 	hasQuery := func(name string) bool {
-		for _, p := range op.Parameters {
+		for _, p := range params {
 			if strings.EqualFold(p.In, "query") && p.Name == name {
 				return true
 			}
@@ -125,7 +129,9 @@ func detectPaginationPlan(spec *openapi.Spec, op *openapi.Operation) *pagination
 	return nil
 }
 
-func fetchAll(plan *paginationPlan, initialQuery url.Values, maxPages int, sleep time.Duration, do func(url.Values) (*mercuryhttp.Result, error)) (*paginationResult, error) {
+// fetchAll follows pages until the last one. Items are accumulated in the result,
+// or handed to onItems page by page when it is non-nil.
+func fetchAll(plan *paginationPlan, initialQuery url.Values, maxPages int, sleep time.Duration, do func(url.Values) (*mercuryhttp.Result, error), onItems func([]any) error) (*paginationResult, error) {
 	if plan == nil || plan.mode == paginateNone {
 		return nil, fmt.Errorf("missing pagination plan")
 	}
@@ -179,7 +185,13 @@ func fetchAll(plan *paginationPlan, initialQuery url.Values, maxPages int, sleep
 			return nil, fmt.Errorf("response field %q is %T, expected array", plan.itemField, itemsVal)
 		}
 
-		res.Items = append(res.Items, items...)
+		if onItems != nil {
+			if err := onItems(items); err != nil {
+				return nil, err
+			}
+		} else {
+			res.Items = append(res.Items, items...)
+		}
 		res.LastObject = obj
 
 		switch plan.mode {
@@ -18,6 +18,7 @@ const (
 	kindBool
 	kindFloat
 	kindStringArray
+	kindJSON
 )
 
 type paramBinding struct {
@@ -37,8 +38,8 @@ func bindParams(cmd *cobra.Command, spec *openapi.Spec, params []openapi.Paramet
 	var out []*paramBinding
 	for _, p := range params {
 		if p.Ref != "" {
-			// None of the vendored specs currently use parameter $ref.
-			return nil, fmt.Errorf("unsupported parameter $ref %q", p.Ref)
+			// Callers pass parameters resolved via Spec.OperationParameters.
+			return nil, fmt.Errorf("unresolved parameter $ref %q", p.Ref)
 		}
 		if strings.ToLower(p.In) != strings.ToLower(where) {
 			continue
@@ -110,12 +111,25 @@ func bindParams(cmd *cobra.Command, spec *openapi.Spec, params []openapi.Paramet
 		if p.Required {
 			_ = cmd.MarkFlagRequired(primary)
 		}
+		completeEnum(cmd, binding.flagNames, paramEnum(spec, &p))
 
 		out = append(out, binding)
 	}
 	return out, nil
 }
 
+// paramEnum returns the values p accepts, or those of its items for arrays.
+func paramEnum(spec *openapi.Spec, p *openapi.Parameter) []string {
+	s := spec.DerefSchema(p.Schema)
+	if s != nil && s.Type == "array" {
+		s = spec.DerefSchema(s.Items)
+	}
+	if s == nil {
+		return nil
+	}
+	return enumStrings(s.Enum)
+}
+
 func buildParamHelp(spec *openapi.Spec, p *openapi.Parameter, where string, kind paramKind) string {
 	if p == nil {
 		return ""
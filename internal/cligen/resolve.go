@@ -0,0 +1,282 @@
+package cligen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// resolveTTL is how long a name resolved to an ID is reused before it is looked
+// up again.
+const resolveTTL = time.Hour
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// idFlag is a query or body flag holding resource IDs, which like path
+// arguments may be given by name.
+type idFlag struct {
+	name string
+	// field is the parameter or property name, e.g. destinationAccountId.
+	field   string
+	src     *listSource
+	changed func(*cobra.Command) bool
+	// exact refuses prefixes: body fields say where money goes, and a prefix
+	// that is unique today may pick the wrong resource.
+	exact bool
+	// s holds the value, or sa the values of a repeatable flag.
+	s  *string
+	sa *[]string
+}
+
+// idFlags finds the string flags of an operation whose values come from a list
+// operation, e.g. --account-id or --destination-account-id.
+func idFlags(lists []listSource, pathParams []string, query []*paramBinding, body *bodyFlags) []idFlag {
+	var out []idFlag
+	for _, b := range query {
+		if b.kind != kindString && b.kind != kindStringArray {
+			continue
+		}
+		if src := idSourceForField(lists, b.param.Name, pathParams); src != nil {
+			f := idFlag{name: b.flagNames[0], field: b.param.Name, src: src, changed: b.changed, s: b.s}
+			if b.kind == kindStringArray {
+				f.s, f.sa = nil, b.sa
+			}
+			out = append(out, f)
+		}
+	}
+	if body == nil {
+		return out
+	}
+	for _, f := range body.fields {
+		if len(f.flagNames) == 0 || (f.kind != kindString && f.kind != kindStringArray) {
+			continue
+		}
+		if src := idSourceForField(lists, f.path[len(f.path)-1], pathParams); src != nil {
+			field := f.path[len(f.path)-1]
+			idf := idFlag{name: f.flagNames[0], field: field, src: src, changed: f.changed, s: f.s, exact: true}
+			if f.kind == kindStringArray {
+				idf.s, idf.sa = nil, f.sa
+			}
+			out = append(out, idf)
+		}
+	}
+	return out
+}
+
+// idSourceForField is idSourceFor for a field name, falling back to its
+// trailing words so that sourceAccountId is listed like accountId.
+func idSourceForField(lists []listSource, name string, bound []string) *listSource {
+	if !strings.HasSuffix(name, "Id") {
+		return nil
+	}
+	if src := idSourceFor(lists, name, bound); src != nil {
+		return src
+	}
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) && name[i:] != "Id" {
+			if src := idSourceFor(lists, strings.ToLower(name[i:i+1])+name[i+1:], bound); src != nil {
+				return src
+			}
+		}
+	}
+	return nil
+}
+
+// resolveNames replaces path arguments and ID flag values given as a name or
+// a unique prefix with the ID they refer to; with exactArgs, path arguments
+// must be an exact name. It does nothing unless rt.ResolveNames is set, and
+// requests that are only printed are left as typed.
+func resolveNames(cmd *cobra.Command, rt *Runtime, token string, pathParams []string, sources []*listSource, exactArgs bool, flags []idFlag, args []string) ([]string, error) {
+	if !rt.ResolveNames || rt.DryRun || rt.Snippet != "" {
+		return args, nil
+	}
+	r := &nameResolver{rt: rt, token: token}
+	defer r.save()
+
+	args = append([]string(nil), args...)
+	values := map[string]string{}
+	for i, name := range pathParams {
+		if i < len(sources) && sources[i] != nil {
+			id, err := r.resolve(cmd.Context(), sources[i], values, name, resourceName(name), args[i], exactArgs)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = id
+		}
+		values[name] = args[i]
+	}
+	for _, f := range flags {
+		if !f.changed(cmd) {
+			continue
+		}
+		vals := []*string{f.s}
+		if f.sa != nil {
+			vals = nil
+			for i := range *f.sa {
+				vals = append(vals, &(*f.sa)[i])
+			}
+		}
+		for _, v := range vals {
+			id, err := r.resolve(cmd.Context(), f.src, values, "--"+f.name, resourceName(f.field), *v, f.exact)
+			if err != nil {
+				return nil, err
+			}
+			*v = id
+		}
+	}
+	return args, nil
+}
+
+// nameResolver resolves names with the list operations, caching what it
+// resolved per profile under rt.CacheDir.
+type nameResolver struct {
+	rt    *Runtime
+	token string
+
+	path    string
+	cache   map[string]resolvedName
+	changed bool
+}
+
+type resolvedName struct {
+	ID         string    `json:"id"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// resolve returns the ID arg refers to: arg itself when it is a UUID, else the
+// ID of the one resource whose ID or name equals arg or, unless exact is set,
+// starts with it. Several matches are an error, and so is none unless the list
+// has further pages, where arg may be an ID.
+//
+// what names the argument in errors (accountId, --recipient-id) and resource
+// the kind of resource it refers to (account, recipient).
+func (r *nameResolver) resolve(ctx context.Context, src *listSource, values map[string]string, what, resource, arg string, exact bool) (string, error) {
+	if arg == "" || uuidPattern.MatchString(arg) {
+		return arg, nil
+	}
+	endpoint, err := src.endpoint(r.rt, values)
+	if err != nil {
+		return "", err
+	}
+	key := endpoint + "\n" + arg
+	r.load()
+	if e, ok := r.cache[key]; ok && time.Since(e.ResolvedAt) < resolveTTL {
+		return e.ID, nil
+	}
+
+	list, err := src.list(ctx, r.rt, r.token, endpoint)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s %q: %w", what, arg, err)
+	}
+	matches, prefixed := matchName(list.Items, arg)
+	byPrefix := len(matches) == 0 && !exact
+	if byPrefix {
+		matches = prefixed
+	}
+	switch {
+	case len(matches) > 1:
+		return "", fmt.Errorf("%s %q is ambiguous; it matches %s", what, arg, describeItems(matches))
+	case len(matches) == 0 && exact && len(prefixed) > 0:
+		return "", fmt.Errorf("%s takes an exact %s ID or name; %q only starts %s", what, resource, arg, describeItems(prefixed))
+	case len(matches) == 0 && list.More:
+		// Only the first page was searched; arg may be an ID on a later one.
+		return arg, nil
+	case len(matches) == 0:
+		return "", fmt.Errorf("%s: no %s named %q", what, resource, arg)
+	}
+	id := matches[0].ID
+	if id != arg {
+		fmt.Fprintf(r.rt.Printer.Err(), "Resolved %s %q to %s\n", what, arg, id)
+		if !byPrefix {
+			// Exact names only: a prefix that is unique now may not stay so.
+			r.cache[key] = resolvedName{ID: id, ResolvedAt: time.Now()}
+			r.changed = true
+		}
+	}
+	return id, nil
+}
+
+func (r *nameResolver) load() {
+	if r.cache != nil {
+		return
+	}
+	r.cache = map[string]resolvedName{}
+	if r.rt.CacheDir == "" {
+		return
+	}
+	sum := sha256.Sum256([]byte(r.rt.Profile + "\n" + r.rt.Env + "\n" + r.token))
+	r.path = filepath.Join(r.rt.CacheDir, "names", hex.EncodeToString(sum[:12])+".json")
+	if b, err := os.ReadFile(r.path); err == nil {
+		_ = json.Unmarshal(b, &r.cache)
+	}
+}
+
+// save writes the cache back, dropping expired entries; failures only cost a
+// later lookup.
+func (r *nameResolver) save() {
+	if !r.changed || r.path == "" {
+		return
+	}
+	for k, e := range r.cache {
+		if time.Since(e.ResolvedAt) >= resolveTTL {
+			delete(r.cache, k)
+		}
+	}
+	b, err := json.Marshal(r.cache)
+	if err != nil {
+		return
+	}
+	writeCacheFile(r.path, b)
+}
+
+// matchName returns the item whose ID is arg, else those with a name equal to
+// arg ignoring case, as exact; and the others whose ID or a name starts with
+// arg as prefixed.
+func matchName(items []idItem, arg string) (exact, prefixed []idItem) {
+	for _, it := range items {
+		if it.ID == arg {
+			return []idItem{it}, nil
+		}
+	}
+	lower := strings.ToLower(arg)
+	for _, it := range items {
+		switch {
+		case slices.ContainsFunc(it.Names, func(n string) bool { return strings.EqualFold(n, arg) }):
+			exact = append(exact, it)
+		case strings.HasPrefix(strings.ToLower(it.ID), lower) ||
+			slices.ContainsFunc(it.Names, func(n string) bool { return strings.HasPrefix(strings.ToLower(n), lower) }):
+			prefixed = append(prefixed, it)
+		}
+	}
+	return exact, prefixed
+}
+
+// describeItems lists items as "id (name)" for errors.
+func describeItems(items []idItem) string {
+	var list []string
+	for _, it := range items {
+		if d := it.description(); d != "" {
+			list = append(list, fmt.Sprintf("%s (%s)", it.ID, d))
+		} else {
+			list = append(list, it.ID)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// resourceName turns an ID field name into words: destinationAccountId is
+// "destination account".
+func resourceName(field string) string {
+	return strings.ReplaceAll(kebabCase(strings.TrimSuffix(field, "Id")), "-", " ")
+}
@@ -0,0 +1,178 @@
+package cligen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tarrence/mercury-cli/internal/mercuryhttp"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// responseSchemaForStatus returns the JSON schema declared for status, falling back
+// to the 2XX range and then the default response.
+func responseSchemaForStatus(spec *openapi.Spec, op *openapi.Operation, status int) *openapi.Schema {
+	for _, code := range []string{strconv.Itoa(status), "2XX", "2xx", "default"} {
+		if s := jsonResponseSchema(spec, op, code); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// validateResponse checks a successful JSON response body against the operation's
+// response schema. Non-2xx, empty and non-JSON bodies are not checked.
+func validateResponse(spec *openapi.Spec, op *openapi.Operation, res *mercuryhttp.Result) openapi.ValidationErrors {
+	if res == nil || res.Status < 200 || res.Status >= 300 || len(res.Body) == 0 {
+		return nil
+	}
+	if ct := res.Headers.Get("Content-Type"); ct != "" && !strings.Contains(ct, "json") {
+		return nil
+	}
+	schema := responseSchemaForStatus(spec, op, res.Status)
+	if schema == nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(res.Body, &v); err != nil {
+		return openapi.ValidationErrors{{Message: "response body is not valid JSON: " + err.Error()}}
+	}
+	return spec.Validate(schema, v)
+}
+
+func reportResponseDrift(w io.Writer, method string, path string, status int, issues openapi.ValidationErrors) {
+	fmt.Fprintf(w, "response does not match spec (%s %s -> %d):\n", method, path, status)
+	for _, e := range issues {
+		fmt.Fprintf(w, "  %s\n", e.Error())
+	}
+}
+
+// CheckResult is the outcome of checking one operation's live response against the spec.
+type CheckResult struct {
+	Operation Operation
+	Status    int
+	Issues    openapi.ValidationErrors
+	// Skipped explains why the operation was not called.
+	Skipped string
+	Err     error
+}
+
+// CheckOperationResponse calls a GET operation with the given path parameter values
+// and validates the response body against its declared schema. Required query
+// parameters come from queryValues, else from the example, default or first enum
+// value their schema declares. Operations that are not GETs, or whose required
+// parameters cannot all be filled, are skipped.
+func CheckOperationResponse(ctx context.Context, rt *Runtime, o Operation, pathValues, queryValues map[string]string) CheckResult {
+	res := CheckResult{Operation: o}
+	if o.Method != http.MethodGet {
+		res.Skipped = "not a GET operation"
+		return res
+	}
+	token, err := rt.ResolveToken(ctx)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if token == "" && o.Spec.OperationRequiresAuth(o.Op) {
+		res.Skipped = "no token"
+		return res
+	}
+
+	expanded := o.Path
+	for _, name := range o.PathParams() {
+		v, ok := pathValues[name]
+		if !ok {
+			res.Skipped = "missing path parameter " + name
+			return res
+		}
+		expanded = strings.ReplaceAll(expanded, "{"+name+"}", url.PathEscape(v))
+	}
+	query, missing, err := checkQuery(o, queryValues)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if missing != "" {
+		res.Skipped = "missing required query parameter " + missing
+		return res
+	}
+
+	baseURL, err := resolveBaseURL(rt, o.Spec, o.Op)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if baseURL == "" {
+		res.Err = fmt.Errorf("no server URL found for %s %s (%s)", o.Method, o.Path, o.SpecName)
+		return res
+	}
+	endpoint, err := joinBaseAndPath(baseURL, expanded)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, o.Method, endpoint, nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if token != "" {
+		mercuryhttp.ApplyAuth(req, token, rt.Auth)
+	}
+	hr, err := rt.Client.Do(req, nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Status = hr.Status
+	if hr.Status < 200 || hr.Status >= 300 {
+		res.Err = fmt.Errorf("HTTP %d", hr.Status)
+		return res
+	}
+	res.Issues = validateResponse(o.Spec, o.Op, hr)
+	return res
+}
+
+// checkQuery fills the required query parameters of o, returning the name of
+// the first one that has neither a given value nor one declared by its schema.
+func checkQuery(o Operation, given map[string]string) (url.Values, string, error) {
+	params, err := o.Spec.OperationParameters(o.Op)
+	if err != nil {
+		return nil, "", err
+	}
+	q := url.Values{}
+	for _, p := range params {
+		if p.In != "query" || !p.Required {
+			continue
+		}
+		if v, ok := given[p.Name]; ok {
+			q.Set(p.Name, v)
+			continue
+		}
+		v := ""
+		if schema := o.Spec.FlattenSchema(p.Schema); schema != nil {
+			switch {
+			case schema.Example != nil:
+				v = scalarString(schema.Example)
+			case schema.Default != nil:
+				v = scalarString(schema.Default)
+			case len(schema.Enum) > 0:
+				v = scalarString(schema.Enum[0])
+			}
+		}
+		if v == "" {
+			return nil, p.Name, nil
+		}
+		q.Set(p.Name, v)
+	}
+	return q, "", nil
+}
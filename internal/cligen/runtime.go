@@ -3,8 +3,10 @@ package cligen
 import (
 	"context"
 	"errors"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/tarrence/mercury-cli/internal/idempotency"
 	"github.com/tarrence/mercury-cli/internal/mercuryhttp"
 	"github.com/tarrence/mercury-cli/internal/output"
 )
@@ -16,8 +18,40 @@ type Runtime struct {
 	Token string
 	Auth  string // bearer|basic
 
+	// TokenSource, when set, is consulted once by ResolveToken if Token is empty
+	// (e.g. a config profile's token_command).
+	TokenSource func(ctx context.Context) (string, error)
+
+	// ValidateResponse reports 2xx bodies that do not match the response schema.
+	ValidateResponse bool
+
+	// DryRun prints each request instead of sending it.
+	DryRun bool
+	// Snippet, when set, prints each request as a snippet in this format (see
+	// snippet.Formats) instead of sending it.
+	Snippet string
+
+	// Idempotency journals the keys generated for POST requests so that re-runs
+	// after an unknown outcome reuse them. When nil, keys are not persisted.
+	Idempotency *idempotency.Journal
+
+	// CacheDir holds short-lived caches such as the IDs offered by shell
+	// completion and the names resolved to IDs. When empty, nothing is cached.
+	CacheDir string
+	// Profile names the config profile in use; resolved names are cached per
+	// profile.
+	Profile string
+	// ResolveNames lets ID arguments and flags be given as a resource name,
+	// looked up with the matching list operation before the request is sent.
+	ResolveNames bool
+
 	Client  *mercuryhttp.Client
 	Printer *output.Printer
+
+	// Capture, when set, receives each successful response body before it is
+	// printed; with --all it receives the combined document. The shell uses it
+	// for $last.
+	Capture func(body []byte)
 }
 
 type runtimeKey struct{}
@@ -26,6 +60,14 @@ func WithRuntime(ctx context.Context, rt *Runtime) context.Context {
 	return context.WithValue(ctx, runtimeKey{}, rt)
 }
 
+type runtimeLoaderKey struct{}
+
+// WithRuntimeLoader defers building the Runtime to load, for commands whose
+// flags are parsed after PersistentPreRun, such as shell completion requests.
+func WithRuntimeLoader(ctx context.Context, load func(cmd *cobra.Command) (*Runtime, error)) context.Context {
+	return context.WithValue(ctx, runtimeLoaderKey{}, load)
+}
+
 func RuntimeFrom(cmd *cobra.Command) (*Runtime, error) {
 	v := cmd.Context().Value(runtimeKey{})
 	if v == nil {
@@ -43,3 +85,24 @@ func RuntimeFrom(cmd *cobra.Command) (*Runtime, error) {
 	}
 	return rt, nil
 }
+
+// ResolveToken returns Token, falling back to TokenSource on first use. The
+// resolved token is cached on the runtime.
+func (rt *Runtime) ResolveToken(ctx context.Context) (string, error) {
+	if strings.TrimSpace(rt.Token) != "" || rt.TokenSource == nil {
+		return strings.TrimSpace(rt.Token), nil
+	}
+	tok, err := rt.TokenSource(ctx)
+	if err != nil {
+		return "", err
+	}
+	rt.Token = strings.TrimSpace(tok)
+	rt.TokenSource = nil
+	return rt.Token, nil
+}
+
+func (rt *Runtime) capture(body []byte) {
+	if rt.Capture != nil && len(body) > 0 {
+		rt.Capture(body)
+	}
+}
@@ -0,0 +1,99 @@
+package cligen
+
+import (
+	"strings"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
+	"github.com/tarrence/mercury-cli/internal/output"
+)
+
+// tableShape derives where the rows of an operation's 200 response are and which
+// columns to show by default from its response schema.
+func tableShape(spec *openapi.Spec, op *openapi.Operation, plan *paginationPlan) output.Shape {
+	var shape output.Shape
+	schema := spec.FlattenSchema(jsonResponseSchema(spec, op, "200"))
+	if schema == nil {
+		if plan != nil {
+			shape.ItemField = plan.itemField
+		}
+		return shape
+	}
+
+	var items *openapi.Schema
+	switch {
+	case strings.EqualFold(schema.Type, "array"):
+		items = schema.Items
+	case plan != nil:
+		shape.ItemField = plan.itemField
+		items = arrayItems(spec, schema, plan.itemField)
+	default:
+		// A list response wrapped in an object with a single array property.
+		var name string
+		for k := range schema.Properties {
+			if hasArrayProp(spec, schema, k) {
+				if name != "" {
+					return shape
+				}
+				name = k
+			}
+		}
+		if name == "" {
+			return shape
+		}
+		shape.ItemField = name
+		items = arrayItems(spec, schema, name)
+	}
+
+	items = spec.FlattenSchema(items)
+	if items == nil || len(items.Properties) == 0 {
+		return shape
+	}
+	shape.Fields = leafFields(spec, items, "", 1)
+	names := items.PropertyNames()
+	shape.Columns = output.DefaultColumns(names, func(name string) bool {
+		prop := items.Properties[name]
+		f := spec.FlattenSchema(&prop)
+		if f == nil {
+			return false
+		}
+		switch strings.ToLower(f.Type) {
+		case "object", "array":
+			return false
+		}
+		return len(f.Properties) == 0
+	})
+	return shape
+}
+
+func arrayItems(spec *openapi.Spec, schema *openapi.Schema, name string) *openapi.Schema {
+	prop, ok := schema.Properties[name]
+	if !ok {
+		return nil
+	}
+	f := spec.FlattenSchema(&prop)
+	if f == nil {
+		return nil
+	}
+	return f.Items
+}
+
+// leafFields lists the dotted paths of schema's scalar and array properties in
+// schema order, descending into nested objects as far as CSV output flattens them.
+// depth is the number of path segments of the fields being listed.
+func leafFields(spec *openapi.Spec, schema *openapi.Schema, prefix string, depth int) []string {
+	var out []string
+	for _, name := range schema.PropertyNames() {
+		prop := schema.Properties[name]
+		f := spec.FlattenSchema(&prop)
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if f != nil && len(f.Properties) > 0 && depth < output.MaxFlattenDepth {
+			out = append(out, leafFields(spec, f, path, depth+1)...)
+			continue
+		}
+		out = append(out, path)
+	}
+	return out
+}
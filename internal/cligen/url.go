@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
 )
 
 func extractPathParams(path string) []string {
@@ -54,3 +56,16 @@ func joinBaseAndPath(baseURL string, path string) (string, error) {
 	u.Path = strings.TrimRight(u.Path, "/") + path
 	return u.String(), nil
 }
+
+// resolveBaseURL returns the --base-url override, or the operation's server URL
+// adjusted for the runtime environment. An empty result means the spec declares no server.
+func resolveBaseURL(rt *Runtime, spec *openapi.Spec, op *openapi.Operation) (string, error) {
+	if baseURL := strings.TrimSpace(rt.BaseURL); baseURL != "" {
+		return baseURL, nil
+	}
+	baseURL := strings.TrimSpace(spec.ServerURLForOperation(op))
+	if baseURL == "" {
+		return "", nil
+	}
+	return applyEnvToServerURL(baseURL, rt.Env)
+}
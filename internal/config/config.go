@@ -0,0 +1,451 @@
+// Package config reads and writes the mercury CLI config file.
+//
+// The file uses a small subset of TOML:
+//
+//	current_profile = "opco"
+//
+//	[profiles.opco]
+//	env = "prod"
+//	token_env = "MERCURY_OPCO_TOKEN"
+//
+//	[profiles.holdco]
+//	env = "sandbox"
+//	token_command = "op read op://vault/mercury/holdco"
+//	timeout = "60s"
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile holds per-organization defaults. Empty fields are unset.
+type Profile struct {
+	Env     string
+	Auth    string
+	BaseURL string
+	Timeout string
+	Output  string
+
+	// Token sources, tried in order: TokenEnv, TokenCommand, Token.
+	TokenEnv     string
+	TokenCommand string
+	Token        string
+
+	// CredentialHelper is a program used by 'mercury auth login' to store the
+	// token instead of the encrypted credentials file.
+	CredentialHelper string
+}
+
+// File is the parsed config file.
+type File struct {
+	CurrentProfile string
+	Profiles       map[string]*Profile
+}
+
+type profileKey struct {
+	name  string
+	field func(*Profile) *string
+	check func(string) error
+}
+
+var profileKeys = []profileKey{
+	{"env", func(p *Profile) *string { return &p.Env }, oneOf("prod", "sandbox")},
+	{"auth", func(p *Profile) *string { return &p.Auth }, oneOf("bearer", "basic")},
+	{"base_url", func(p *Profile) *string { return &p.BaseURL }, nil},
+	{"timeout", func(p *Profile) *string { return &p.Timeout }, checkDuration},
+	{"output", func(p *Profile) *string { return &p.Output }, checkOutput},
+	{"token_env", func(p *Profile) *string { return &p.TokenEnv }, nil},
+	{"token_command", func(p *Profile) *string { return &p.TokenCommand }, nil},
+	{"token", func(p *Profile) *string { return &p.Token }, nil},
+	{"credential_helper", func(p *Profile) *string { return &p.CredentialHelper }, nil},
+}
+
+// OutputFormats lists the accepted values for the output key.
+var OutputFormats = []string{"pretty", "compact", "ndjson", "table", "csv", "tsv"}
+
+// Keys returns the profile keys accepted by Get and Set, in file order.
+func Keys() []string {
+	out := make([]string, 0, len(profileKeys))
+	for _, k := range profileKeys {
+		out = append(out, k.name)
+	}
+	return out
+}
+
+func lookupKey(name string) (profileKey, bool) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), "-", "_")
+	for _, k := range profileKeys {
+		if k.name == name {
+			return k, true
+		}
+	}
+	return profileKey{}, false
+}
+
+// Get returns the value of key and whether the key is known.
+func (p *Profile) Get(key string) (string, bool) {
+	k, ok := lookupKey(key)
+	if !ok {
+		return "", false
+	}
+	return *k.field(p), true
+}
+
+// Set validates and assigns value to key. An empty value unsets the key.
+func (p *Profile) Set(key string, value string) error {
+	k, ok := lookupKey(key)
+	if !ok {
+		return fmt.Errorf("unknown config key %q (expected one of: %s)", key, strings.Join(Keys(), ", "))
+	}
+	if value != "" && k.check != nil {
+		if err := k.check(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", k.name, err)
+		}
+	}
+	*k.field(p) = value
+	return nil
+}
+
+// Duration parses the timeout key. A bare integer is a number of seconds.
+func (p *Profile) Duration() (time.Duration, error) {
+	if n, err := strconv.Atoi(p.Timeout); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(p.Timeout)
+}
+
+// HasTokenSource reports whether the profile configures any way to obtain a token.
+func (p *Profile) HasTokenSource() bool {
+	return p.TokenEnv != "" || p.TokenCommand != "" || p.Token != ""
+}
+
+// ReadToken resolves the profile's token from its configured source.
+func (p *Profile) ReadToken(ctx context.Context) (string, error) {
+	switch {
+	case p.TokenEnv != "":
+		v := strings.TrimSpace(os.Getenv(p.TokenEnv))
+		if v == "" {
+			return "", fmt.Errorf("token_env: $%s is not set", p.TokenEnv)
+		}
+		return v, nil
+	case p.TokenCommand != "":
+		var c *exec.Cmd
+		if runtime.GOOS == "windows" {
+			c = exec.CommandContext(ctx, "cmd", "/C", p.TokenCommand)
+		} else {
+			c = exec.CommandContext(ctx, "sh", "-c", p.TokenCommand)
+		}
+		var stderr bytes.Buffer
+		c.Stderr = &stderr
+		out, err := c.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("token_command: %w: %s", err, msg)
+			}
+			return "", fmt.Errorf("token_command: %w", err)
+		}
+		v := strings.TrimSpace(string(out))
+		if v == "" {
+			return "", errors.New("token_command: produced no output")
+		}
+		return v, nil
+	default:
+		return p.Token, nil
+	}
+}
+
+// DefaultPath returns the config file location: $MERCURY_CONFIG, else
+// $XDG_CONFIG_HOME/mercury/config.toml, else ~/.config/mercury/config.toml.
+func DefaultPath() (string, error) {
+	if p := os.Getenv("MERCURY_CONFIG"); p != "" {
+		return p, nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "mercury", "config.toml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locate config file: %w", err)
+	}
+	return filepath.Join(home, ".config", "mercury", "config.toml"), nil
+}
+
+// Load reads the config file at path. A missing file yields an empty config.
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &File{Profiles: map[string]*Profile{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Parse decodes config file contents.
+func Parse(b []byte) (*File, error) {
+	f := &File{Profiles: map[string]*Profile{}}
+	var cur *Profile
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			header, err := parseTableHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if len(header) != 2 || header[0] != "profiles" || header[1] == "" {
+				return nil, fmt.Errorf("line %d: unsupported table %q (expected [profiles.<name>])", lineNo, line)
+			}
+			cur = f.Profiles[header[1]]
+			if cur == nil {
+				cur = &Profile{}
+				f.Profiles[header[1]] = cur
+			}
+			continue
+		}
+
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = unquoteKey(strings.TrimSpace(key))
+		value, err := parseValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		if cur == nil {
+			if key != "current_profile" {
+				return nil, fmt.Errorf("line %d: unknown top-level key %q", lineNo, key)
+			}
+			f.CurrentProfile = value
+			continue
+		}
+		k, ok := lookupKey(key)
+		if !ok || k.name != key {
+			return nil, fmt.Errorf("line %d: unknown profile key %q", lineNo, key)
+		}
+		*k.field(cur) = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Save writes the config to path (0600, parent directory 0700). Comments and
+// formatting from the original file are not preserved.
+func (f *File) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, f.Encode(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Encode renders the config in the file format understood by Parse.
+func (f *File) Encode() []byte {
+	var buf bytes.Buffer
+	if f.CurrentProfile != "" {
+		fmt.Fprintf(&buf, "current_profile = %s\n", strconv.Quote(f.CurrentProfile))
+	}
+	for _, name := range f.ProfileNames() {
+		p := f.Profiles[name]
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, "[profiles.%s]\n", quoteKey(name))
+		for _, k := range profileKeys {
+			if v := *k.field(p); v != "" {
+				fmt.Fprintf(&buf, "%s = %s\n", k.name, strconv.Quote(v))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// ProfileNames returns the profile names in sorted order.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select picks the active profile: name if non-empty, else current_profile, else
+// a profile named "default". It returns "" and nil when no profile applies. An
+// explicitly requested name that does not exist is an error.
+func (f *File) Select(name string) (string, *Profile, error) {
+	if name != "" {
+		p, ok := f.Profiles[name]
+		if !ok {
+			return "", nil, fmt.Errorf("profile %q not found in config", name)
+		}
+		return name, p, nil
+	}
+	if f.CurrentProfile != "" {
+		if p, ok := f.Profiles[f.CurrentProfile]; ok {
+			return f.CurrentProfile, p, nil
+		}
+	}
+	if p, ok := f.Profiles["default"]; ok {
+		return "default", p, nil
+	}
+	return "", nil, nil
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(v string) error {
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q (expected %s)", v, strings.Join(allowed, " or "))
+	}
+}
+
+func checkDuration(v string) error {
+	p := Profile{Timeout: v}
+	if _, err := p.Duration(); err != nil {
+		return fmt.Errorf("%q is not a duration (e.g. 30s)", v)
+	}
+	return nil
+}
+
+func checkOutput(v string) error {
+	return oneOf(OutputFormats...)(v)
+}
+
+func parseTableHeader(line string) ([]string, error) {
+	if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+		return nil, fmt.Errorf("invalid table header %q", line)
+	}
+	inner := strings.TrimSpace(line[1 : len(line)-1])
+	var parts []string
+	for inner != "" {
+		if inner[0] == '"' {
+			end := closingQuote(inner)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted key in %q", line)
+			}
+			s, err := strconv.Unquote(inner[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted key in %q", line)
+			}
+			parts = append(parts, s)
+			inner = strings.TrimSpace(inner[end+1:])
+		} else {
+			i := strings.IndexByte(inner, '.')
+			if i < 0 {
+				i = len(inner)
+			}
+			parts = append(parts, strings.TrimSpace(inner[:i]))
+			inner = inner[i:]
+		}
+		if inner == "" {
+			break
+		}
+		if inner[0] != '.' {
+			return nil, fmt.Errorf("invalid table header %q", line)
+		}
+		inner = strings.TrimSpace(inner[1:])
+	}
+	return parts, nil
+}
+
+func parseValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := closingQuote(raw)
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after string: %q", rest)
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		return raw[1 : end+1], nil
+	default:
+		// Bare integers and booleans; strip trailing comments.
+		if i := strings.IndexByte(raw, '#'); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		if raw == "" {
+			return "", errors.New("missing value")
+		}
+		if _, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return raw, nil
+		}
+		if raw == "true" || raw == "false" {
+			return raw, nil
+		}
+		return "", fmt.Errorf("unsupported value %q (quote strings)", raw)
+	}
+}
+
+// closingQuote returns the index of the quote closing the basic string at s[0].
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteKey(k string) string {
+	if strings.HasPrefix(k, `"`) {
+		if s, err := strconv.Unquote(k); err == nil {
+			return s
+		}
+	}
+	return k
+}
+
+func quoteKey(k string) string {
+	for _, r := range k {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return strconv.Quote(k)
+		}
+	}
+	return k
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `# mercury config
+current_profile = "opco"
+
+[profiles.opco]
+env = "prod"
+token_env = "OPCO_TOKEN" # inline comment
+timeout = 45
+
+[profiles."holdco.llc"]
+env = 'sandbox'
+auth = "basic"
+token_command = "echo \"tok\""
+`
+
+func TestParseAndEncode(t *testing.T) {
+	f, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if f.CurrentProfile != "opco" {
+		t.Fatalf("current_profile = %q", f.CurrentProfile)
+	}
+	opco := f.Profiles["opco"]
+	if opco == nil || opco.Env != "prod" || opco.TokenEnv != "OPCO_TOKEN" {
+		t.Fatalf("unexpected opco profile: %+v", opco)
+	}
+	if d, err := opco.Duration(); err != nil || d != 45*time.Second {
+		t.Fatalf("timeout = %v, %v", d, err)
+	}
+	holdco := f.Profiles["holdco.llc"]
+	if holdco == nil || holdco.Env != "sandbox" || holdco.Auth != "basic" || holdco.TokenCommand != `echo "tok"` {
+		t.Fatalf("unexpected holdco profile: %+v", holdco)
+	}
+
+	again, err := Parse(f.Encode())
+	if err != nil {
+		t.Fatalf("re-parse encoded config: %v\n%s", err, f.Encode())
+	}
+	if *again.Profiles["holdco.llc"] != *holdco || *again.Profiles["opco"] != *opco || again.CurrentProfile != "opco" {
+		t.Fatalf("round trip mismatch:\n%s", f.Encode())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"[accounts]\n",
+		"[profiles.a]\ncolour = \"red\"\n",
+		"token = \"x\"\n",
+		"[profiles.a]\nenv = prod\n",
+		"[profiles.a]\nenv = \"prod\n",
+	} {
+		if _, err := Parse([]byte(in)); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	f, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _, _ := f.Select(""); name != "opco" {
+		t.Fatalf("expected current_profile to be selected, got %q", name)
+	}
+	if name, _, _ := f.Select("holdco.llc"); name != "holdco.llc" {
+		t.Fatalf("expected explicit profile, got %q", name)
+	}
+	if _, _, err := f.Select("nope"); err == nil {
+		t.Fatalf("expected error for unknown profile")
+	}
+}
+
+func TestSetValidates(t *testing.T) {
+	var p Profile
+	if err := p.Set("env", "staging"); err == nil {
+		t.Fatalf("expected invalid env error")
+	}
+	if err := p.Set("timeout", "soon"); err == nil {
+		t.Fatalf("expected invalid timeout error")
+	}
+	if err := p.Set("base-url", "http://localhost:8080"); err != nil || p.BaseURL != "http://localhost:8080" {
+		t.Fatalf("Set base-url: %v (%+v)", err, p)
+	}
+	if err := p.Set("nope", "x"); err == nil || !strings.Contains(err.Error(), "unknown config key") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestReadTokenCommand(t *testing.T) {
+	p := Profile{TokenCommand: "echo secret-token"}
+	tok, err := p.ReadToken(context.Background())
+	if err != nil || tok != "secret-token" {
+		t.Fatalf("ReadToken = %q, %v", tok, err)
+	}
+}
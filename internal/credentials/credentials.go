@@ -0,0 +1,40 @@
+// Package credentials stores Mercury API tokens outside of shell rc files: either
+// in a passphrase-encrypted local file or through an external credential helper.
+package credentials
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when no credential is stored for a profile.
+var ErrNotFound = errors.New("no stored credential")
+
+// Credential is what is stored per profile. Tokens obtained through OAuth also
+// carry what is needed to refresh them.
+type Credential struct {
+	Token string `json:"token"`
+
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitzero"`
+	ClientID     string    `json:"client_id,omitempty"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	TokenURL     string    `json:"token_url,omitempty"`
+}
+
+// Refreshable reports whether the credential can be renewed with its refresh token.
+func (c Credential) Refreshable() bool {
+	return c.RefreshToken != "" && c.TokenURL != ""
+}
+
+// Store persists one credential per profile name.
+type Store interface {
+	// Get returns the credential for profile, or ErrNotFound.
+	Get(profile string) (Credential, error)
+	// Set stores cred for profile, replacing any existing credential.
+	Set(profile string, cred Credential) error
+	// Delete removes the credential for profile. Deleting a missing credential is not an error.
+	Delete(profile string) error
+	// Describe names the backing store for status output.
+	Describe() string
+}
@@ -0,0 +1,114 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func staticPass(p string) func() (string, error) {
+	return func() (string, error) { return p, nil }
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "credentials.enc")
+	s := NewFileStore(path, staticPass("hunter2"))
+
+	if _, err := s.Get("default"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get on missing file: %v", err)
+	}
+	if err := s.Set("default", Credential{Token: "tok-a"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set("holdco", Credential{Token: "tok-b"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Fatalf("mode = %v, want 0600", fi.Mode().Perm())
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "tok-a") {
+		t.Fatalf("token stored in plaintext:\n%s", b)
+	}
+
+	fresh := NewFileStore(path, staticPass("hunter2"))
+	if c, err := fresh.Get("holdco"); err != nil || c.Token != "tok-b" {
+		t.Fatalf("Get holdco = %+v, %v", c, err)
+	}
+
+	if err := fresh.Delete("default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fresh.Get("default"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Delete, got %v", err)
+	}
+	if err := fresh.Delete("holdco"); err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Exists() {
+		t.Fatalf("expected empty store to be removed")
+	}
+}
+
+func TestFileStoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	if err := NewFileStore(path, staticPass("right")).Set("default", Credential{Token: "tok"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewFileStore(path, staticPass("wrong")).Get("default")
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("expected wrong passphrase error, got %v", err)
+	}
+}
+
+func TestHelperStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script uses sh")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "helper.sh")
+	// Stores one file per profile in $dir.
+	body := `#!/bin/sh
+while IFS= read -r line && [ -n "$line" ]; do
+  case "$line" in
+    profile=*) profile="${line#profile=}" ;;
+    token=*) token="${line#token=}" ;;
+  esac
+done
+f="` + dir + `/$profile.tok"
+case "$1" in
+  get) [ -f "$f" ] && printf 'token=%s\n' "$(cat "$f")" ;;
+  store) printf '%s' "$token" > "$f" ;;
+  erase) rm -f "$f" ;;
+esac
+exit 0
+`
+	if err := os.WriteFile(script, []byte(body), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHelperStore(script)
+	if _, err := h.Get("opco"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before store: %v", err)
+	}
+	if err := h.Set("opco", Credential{Token: "helper-tok"}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := h.Get("opco"); err != nil || c.Token != "helper-tok" {
+		t.Fatalf("Get = %+v, %v", c, err)
+	}
+	if err := h.Delete("opco"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Get("opco"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after erase: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	fileVersion = 1
+	kdfName     = "pbkdf2-sha256"
+	// kdfIterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+	kdfIterations = 600_000
+	saltSize      = 16
+	keySize       = 32
+)
+
+// fileAAD binds ciphertexts to this file format.
+var fileAAD = []byte("mercury-cli credentials v1")
+
+// encryptedFile is the on-disk JSON envelope. The plaintext is a JSON object
+// mapping profile names to credentials.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FileStore keeps credentials in a single AES-256-GCM encrypted file whose key is
+// derived from a passphrase. The file is written with mode 0600.
+type FileStore struct {
+	path       string
+	passphrase func() (string, error)
+
+	// cachedPass holds the passphrase after it has been obtained once.
+	cachedPass *string
+}
+
+// NewFileStore returns a store backed by path. passphrase is called lazily, only
+// when the file has to be decrypted or created, and its result is reused.
+func NewFileStore(path string, passphrase func() (string, error)) *FileStore {
+	return &FileStore{path: path, passphrase: passphrase}
+}
+
+func (s *FileStore) Describe() string { return "encrypted file " + s.path }
+
+// Exists reports whether the credential file has been created.
+func (s *FileStore) Exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+func (s *FileStore) Get(profile string) (Credential, error) {
+	creds, err := s.load()
+	if err != nil {
+		return Credential{}, err
+	}
+	c, ok := creds[profile]
+	if !ok {
+		return Credential{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *FileStore) Set(profile string, cred Credential) error {
+	creds, err := s.load()
+	if err != nil {
+		return err
+	}
+	creds[profile] = cred
+	return s.save(creds)
+}
+
+func (s *FileStore) Delete(profile string) error {
+	if !s.Exists() {
+		return nil
+	}
+	creds, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := creds[profile]; !ok {
+		return nil
+	}
+	delete(creds, profile)
+	if len(creds) == 0 {
+		return os.Remove(s.path)
+	}
+	return s.save(creds)
+}
+
+func (s *FileStore) pass() (string, error) {
+	if s.cachedPass != nil {
+		return *s.cachedPass, nil
+	}
+	if s.passphrase == nil {
+		return "", errors.New("credential store passphrase not available")
+	}
+	p, err := s.passphrase()
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("empty credential store passphrase")
+	}
+	s.cachedPass = &p
+	return p, nil
+}
+
+func (s *FileStore) load() (map[string]Credential, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]Credential{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ef encryptedFile
+	if err := json.Unmarshal(b, &ef); err != nil {
+		return nil, fmt.Errorf("read credential store %s: %w", s.path, err)
+	}
+	if ef.Version != fileVersion || ef.KDF != kdfName || ef.Iterations <= 0 {
+		return nil, fmt.Errorf("credential store %s: unsupported format (version %d, kdf %q)", s.path, ef.Version, ef.KDF)
+	}
+
+	pass, err := s.pass()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(pass, ef.Salt, ef.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, ef.Nonce, ef.Ciphertext, fileAAD)
+	if err != nil {
+		s.cachedPass = nil
+		return nil, fmt.Errorf("credential store %s: wrong passphrase or corrupted file", s.path)
+	}
+
+	creds := map[string]Credential{}
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return nil, fmt.Errorf("credential store %s: %w", s.path, err)
+	}
+	return creds, nil
+}
+
+func (s *FileStore) save(creds map[string]Credential) error {
+	pass, err := s.pass()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(pass, salt, kdfIterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(encryptedFile{
+		Version:    fileVersion,
+		KDF:        kdfName,
+		Iterations: kdfIterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plain, fileAAD),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(out, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func newGCM(pass string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, pass, salt, iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,137 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// HelperStore delegates storage to an external program, following the shape of
+// git's credential.helper protocol. The helper command is run through the shell
+// with one of "get", "store" or "erase" appended, and receives key=value lines on
+// stdin terminated by a blank line:
+//
+//	profile=<name>
+//	token=<token>                 (store only)
+//	refresh_token=<token>         (store only, OAuth logins)
+//	expiry=<RFC 3339 time>        (store only, OAuth logins)
+//	client_id=, client_secret=, token_url=   (store only, OAuth logins)
+//
+// For "get" the helper prints the stored key=value lines back; a missing token=
+// line means no credential is stored.
+type HelperStore struct {
+	command string
+}
+
+// NewHelperStore returns a store that runs command for every operation.
+func NewHelperStore(command string) *HelperStore {
+	return &HelperStore{command: command}
+}
+
+func (h *HelperStore) Describe() string {
+	if f := strings.Fields(h.command); len(f) > 0 {
+		return "credential helper " + f[0]
+	}
+	return "credential helper"
+}
+
+func (h *HelperStore) Get(profile string) (Credential, error) {
+	out, err := h.run("get", [][2]string{{"profile", profile}})
+	if err != nil {
+		return Credential{}, err
+	}
+	kv := parseKeyValues(out)
+	if kv["token"] == "" {
+		return Credential{}, ErrNotFound
+	}
+	c := Credential{
+		Token:        kv["token"],
+		RefreshToken: kv["refresh_token"],
+		ClientID:     kv["client_id"],
+		ClientSecret: kv["client_secret"],
+		TokenURL:     kv["token_url"],
+	}
+	if v := kv["expiry"]; v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Credential{}, fmt.Errorf("credential helper get: invalid expiry %q", v)
+		}
+		c.Expiry = t
+	}
+	return c, nil
+}
+
+func (h *HelperStore) Set(profile string, cred Credential) error {
+	attrs := [][2]string{
+		{"profile", profile},
+		{"token", cred.Token},
+		{"refresh_token", cred.RefreshToken},
+		{"client_id", cred.ClientID},
+		{"client_secret", cred.ClientSecret},
+		{"token_url", cred.TokenURL},
+	}
+	if !cred.Expiry.IsZero() {
+		attrs = append(attrs, [2]string{"expiry", cred.Expiry.UTC().Format(time.RFC3339)})
+	}
+	_, err := h.run("store", attrs)
+	return err
+}
+
+func (h *HelperStore) Delete(profile string) error {
+	_, err := h.run("erase", [][2]string{{"profile", profile}})
+	return err
+}
+
+// run invokes the helper with attrs on stdin. Empty values other than profile are omitted.
+func (h *HelperStore) run(action string, attrs [][2]string) ([]byte, error) {
+	var in bytes.Buffer
+	for _, kv := range attrs {
+		k, v := kv[0], kv[1]
+		if v == "" && k != "profile" {
+			continue
+		}
+		if strings.ContainsAny(v, "\n\x00") {
+			return nil, fmt.Errorf("credential helper: %s contains a newline", k)
+		}
+		fmt.Fprintf(&in, "%s=%s\n", k, v)
+	}
+	in.WriteString("\n")
+
+	line := h.command + " " + action
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", line)
+	} else {
+		c = exec.Command("sh", "-c", line)
+	}
+	c.Stdin = &in
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("credential helper %s: %w: %s", action, err, msg)
+		}
+		return nil, fmt.Errorf("credential helper %s: %w", action, err)
+	}
+	return out, nil
+}
+
+func parseKeyValues(b []byte) map[string]string {
+	out := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,202 @@
+// Package idempotency keeps a local journal of the idempotency keys attached to
+// non-idempotent requests, so that re-running a command whose outcome is unknown
+// (a timeout, a 5xx, a crash) sends the same key and cannot apply twice.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/lockfile"
+)
+
+// TTL is how long an unfinished entry is reused. It stays well inside the
+// window in which the API deduplicates keys.
+const TTL = 24 * time.Hour
+
+const fileVersion = 1
+
+const (
+	// lockTimeout bounds the wait for another process updating the journal.
+	lockTimeout = 10 * time.Second
+	// staleLock is how old the lock file may get before it is assumed to belong
+	// to a process that died while holding it.
+	staleLock = 30 * time.Second
+)
+
+// Entry is one request whose outcome is not known yet.
+type Entry struct {
+	Key     string    `json:"key"`
+	Request string    `json:"request"`
+	Created time.Time `json:"created"`
+}
+
+type journalFile struct {
+	Version int              `json:"version"`
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Journal stores entries in a JSON file keyed by request fingerprint. Entries
+// are added before a request is sent and removed once the server has given a
+// definitive answer, so only requests that may or may not have been applied
+// keep their key. Updates hold a lock file next to the journal, so concurrent
+// processes do not lose each other's entries.
+type Journal struct {
+	path string
+	now  func() time.Time
+}
+
+// NewJournal returns a journal backed by path. The file is created on first use.
+func NewJournal(path string) *Journal {
+	return &Journal{path: path, now: time.Now}
+}
+
+// Path returns the journal file location.
+func (j *Journal) Path() string { return j.path }
+
+// Fingerprint identifies a request by its method, URL and body.
+func Fingerprint(method, url string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, url)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewKey returns a random UUIDv4.
+func NewKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// Lookup returns the unexpired entry for fingerprint.
+func (j *Journal) Lookup(fingerprint string) (Entry, bool, error) {
+	f, err := j.load()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	e, ok := f.Entries[fingerprint]
+	if !ok || j.expired(e) {
+		return Entry{}, false, nil
+	}
+	return e, true, nil
+}
+
+// Add records e for fingerprint, replacing any earlier entry and dropping
+// expired ones.
+func (j *Journal) Add(fingerprint string, e Entry) error {
+	if e.Created.IsZero() {
+		e.Created = j.now()
+	}
+	return j.update(func(f *journalFile) bool {
+		f.Entries[fingerprint] = e
+		return true
+	})
+}
+
+// Remove forgets fingerprint. Removing a missing entry is not an error.
+func (j *Journal) Remove(fingerprint string) error {
+	return j.update(func(f *journalFile) bool {
+		if _, ok := f.Entries[fingerprint]; !ok {
+			return false
+		}
+		delete(f.Entries, fingerprint)
+		return true
+	})
+}
+
+// update applies change to the journal under the lock, saving it when change
+// reports a modification.
+func (j *Journal) update(change func(f *journalFile) bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+	unlock, err := lockfile.Acquire(ctx, j.path+".lock", staleLock)
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", j.path, err)
+	}
+	defer unlock()
+	f, err := j.load()
+	if err != nil {
+		return err
+	}
+	if !change(f) {
+		return nil
+	}
+	return j.save(f)
+}
+
+func (j *Journal) expired(e Entry) bool {
+	return j.now().Sub(e.Created) > TTL
+}
+
+func (j *Journal) load() (*journalFile, error) {
+	f := &journalFile{Version: fileVersion, Entries: map[string]Entry{}}
+	b, err := os.ReadFile(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", j.path, err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("%s: unsupported journal version %d", j.path, f.Version)
+	}
+	if f.Entries == nil {
+		f.Entries = map[string]Entry{}
+	}
+	return f, nil
+}
+
+// save writes the journal through a temporary file so a crash never leaves a
+// truncated journal behind.
+func (j *Journal) save(f *journalFile) error {
+	for fp, e := range f.Entries {
+		if j.expired(e) {
+			delete(f.Entries, fp)
+		}
+	}
+	if len(f.Entries) == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".idempotency-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournalRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "idempotency.json")
+	j := NewJournal(path)
+	fp := Fingerprint("POST", "https://api.mercury.com/api/v1/transfer", []byte(`{"amount":1}`))
+
+	if _, ok, err := j.Lookup(fp); err != nil || ok {
+		t.Fatalf("Lookup on missing file: ok=%v err=%v", ok, err)
+	}
+	if err := j.Add(fp, Entry{Key: "k1", Request: "POST /transfer"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	e, ok, err := j.Lookup(fp)
+	if err != nil || !ok || e.Key != "k1" || e.Created.IsZero() {
+		t.Fatalf("Lookup = %+v, %v, %v", e, ok, err)
+	}
+	if err := j.Remove(fp); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected empty journal to be removed, stat err = %v", err)
+	}
+	if err := j.Remove(fp); err != nil {
+		t.Fatalf("Remove missing: %v", err)
+	}
+}
+
+func TestJournalExpiry(t *testing.T) {
+	j := NewJournal(filepath.Join(t.TempDir(), "idempotency.json"))
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	j.now = func() time.Time { return now }
+
+	if err := j.Add("old", Entry{Key: "k-old"}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(TTL + time.Minute)
+	if _, ok, _ := j.Lookup("old"); ok {
+		t.Fatalf("expected expired entry to be ignored")
+	}
+	if err := j.Add("new", Entry{Key: "k-new"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := j.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Entries["old"]; ok || len(f.Entries) != 1 {
+		t.Fatalf("expected expired entry to be pruned, got %v", f.Entries)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("POST", "https://x/transfer", []byte(`{"amount":1}`))
+	if a != Fingerprint("POST", "https://x/transfer", []byte(`{"amount":1}`)) {
+		t.Fatalf("fingerprint is not stable")
+	}
+	for _, b := range []string{
+		Fingerprint("POST", "https://x/transfer", []byte(`{"amount":2}`)),
+		Fingerprint("POST", "https://y/transfer", []byte(`{"amount":1}`)),
+		Fingerprint("PATCH", "https://x/transfer", []byte(`{"amount":1}`)),
+	} {
+		if a == b {
+			t.Fatalf("different requests share fingerprint %s", a)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	k, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(k) {
+		t.Fatalf("NewKey = %q, want a UUIDv4", k)
+	}
+	if k2, _ := NewKey(); k2 == k {
+		t.Fatalf("NewKey returned %q twice", k)
+	}
+}
+
+func TestJournalConcurrentAdds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Separate journals stand in for separate processes.
+			if err := NewJournal(path).Add(fmt.Sprint("fp", i), Entry{Key: fmt.Sprint("k", i)}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	j := NewJournal(path)
+	for i := 0; i < 10; i++ {
+		if e, ok, err := j.Lookup(fmt.Sprint("fp", i)); err != nil || !ok || e.Key != fmt.Sprint("k", i) {
+			t.Fatalf("entry %d lost: %+v %v %v", i, e, ok, err)
+		}
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("lock left behind: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Package lockfile provides a lock shared by processes on the same machine
+// through a file created with O_EXCL, which works on every platform the CLI
+// ships for.
+package lockfile
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often a held lock is retried.
+const pollInterval = 5 * time.Millisecond
+
+// Acquire takes the lock at path, waiting until it is free or ctx is done. A
+// lock file older than stale is assumed to belong to a process that died while
+// holding it and is broken. The returned release removes the lock only while
+// it is still this caller's.
+func Acquire(ctx context.Context, path string, stale time.Duration) (release func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, werr := f.Write(token)
+			cerr := f.Close()
+			if werr != nil || cerr != nil {
+				_ = os.Remove(path)
+				return nil, errors.Join(werr, cerr)
+			}
+			return func() { releaseOwned(path, token) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > stale {
+			breakStale(path, fi, token)
+			continue
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// breakStale moves the stale lock fi aside under a name of its own, so that of
+// several processes breaking it only one succeeds. If another process took a
+// fresh lock between the check and the rename, that lock is put back.
+func breakStale(path string, fi fs.FileInfo, token []byte) {
+	aside := path + ".stale-" + hex.EncodeToString(token)
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if moved, err := os.Stat(aside); err == nil && !os.SameFile(fi, moved) {
+		_ = os.Link(aside, path)
+	}
+	_ = os.Remove(aside)
+}
+
+// releaseOwned removes the lock at path if it still holds token.
+func releaseOwned(path string, token []byte) {
+	if b, err := os.ReadFile(path); err == nil && bytes.Equal(b, token) {
+		_ = os.Remove(path)
+	}
+}
+
+func newToken() ([]byte, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(b[:])), nil
+}
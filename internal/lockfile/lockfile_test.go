@@ -0,0 +1,81 @@
+package lockfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireExcludes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "x.lock")
+	var wg sync.WaitGroup
+	inside, most := 0, 0
+	var mu sync.Mutex
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				release, err := Acquire(context.Background(), path, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				inside++
+				most = max(most, inside)
+				mu.Unlock()
+				time.Sleep(100 * time.Microsecond)
+				mu.Lock()
+				inside--
+				mu.Unlock()
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	if most != 1 {
+		t.Fatalf("%d holders at once", most)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lock left behind: %v", err)
+	}
+}
+
+func TestAcquireWaitsAndBreaksStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	release, err := Acquire(context.Background(), path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path, time.Minute); err != context.DeadlineExceeded {
+		t.Fatalf("expected to time out on a held lock, got %v", err)
+	}
+
+	// The holder died: its lock is old enough to be broken.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Acquire(context.Background(), path, time.Minute)
+	if err != nil {
+		t.Fatalf("stale lock not broken: %v", err)
+	}
+	// The first holder's release must not remove the new holder's lock.
+	release()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("release removed a lock it no longer owned: %v", err)
+	}
+	again()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lock left behind: %v", err)
+	}
+	if m, _ := filepath.Glob(path + ".stale-*"); len(m) != 0 {
+		t.Fatalf("broken lock left behind: %v", m)
+	}
+}
@@ -0,0 +1,279 @@
+package mercuryhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// A cassette is a recorded request/response pair stored as one JSON file per
+// distinct request. Requests are matched by method, path, query and a hash of
+// the redacted body; recording the same request again replaces its cassette.
+
+// sensitiveFields are JSON body properties, and form fields, whose values are
+// replaced before a body is written to a cassette. Names match case-insensitively.
+var sensitiveFields = map[string]bool{
+	"accountnumber": true,
+	"routingnumber": true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"client_secret": true,
+	"code":          true,
+	"code_verifier": true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+}
+
+// volatileFields change on every run without changing the request's meaning,
+// so they are left out of the match hash.
+var volatileFields = map[string]bool{"idempotencykey": true}
+
+const redacted = "<redacted>"
+
+type cassette struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	cassetteBody
+}
+
+type cassetteResponse struct {
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	cassetteBody
+}
+
+// cassetteBody keeps JSON bodies readable in the file; other bodies are stored
+// as text or, when not valid UTF-8, base64.
+type cassetteBody struct {
+	Encoding string          `json:"body_encoding,omitempty"` // json|text|base64
+	Body     json.RawMessage `json:"body,omitempty"`
+}
+
+func encodeBody(b []byte) cassetteBody {
+	switch {
+	case len(b) == 0:
+		return cassetteBody{}
+	case json.Valid(b):
+		return cassetteBody{Encoding: "json", Body: b}
+	case utf8.Valid(b):
+		s, _ := json.Marshal(string(b))
+		return cassetteBody{Encoding: "text", Body: s}
+	default:
+		s, _ := json.Marshal(base64.StdEncoding.EncodeToString(b))
+		return cassetteBody{Encoding: "base64", Body: s}
+	}
+}
+
+func (cb cassetteBody) decode() ([]byte, error) {
+	switch cb.Encoding {
+	case "":
+		return nil, nil
+	case "json":
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, cb.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "text", "base64":
+		var s string
+		if err := json.Unmarshal(cb.Body, &s); err != nil {
+			return nil, err
+		}
+		if cb.Encoding == "text" {
+			return []byte(s), nil
+		}
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unknown body_encoding %q", cb.Encoding)
+}
+
+// redactBody replaces sensitive values in JSON and form-encoded bodies. With
+// dropVolatile, volatile fields are removed as well. Other bodies are returned
+// unchanged.
+func redactBody(b []byte, contentType string, dropVolatile bool) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		vals, err := url.ParseQuery(string(b))
+		if err != nil {
+			return b
+		}
+		return []byte(redactValues(vals, dropVolatile).Encode())
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return b
+	}
+	out, err := json.Marshal(redactValue(v, dropVolatile))
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+// redactValues replaces sensitive form or query values in vals, and with
+// dropVolatile removes volatile ones.
+func redactValues(vals url.Values, dropVolatile bool) url.Values {
+	for k := range vals {
+		switch {
+		case dropVolatile && volatileFields[strings.ToLower(k)]:
+			delete(vals, k)
+		case sensitiveFields[strings.ToLower(k)]:
+			vals[k] = []string{redacted}
+		}
+	}
+	return vals
+}
+
+// redactURL returns u with sensitive query parameters and any password
+// replaced.
+func redactURL(u *url.URL) string {
+	c := *u
+	if _, ok := c.User.Password(); ok {
+		c.User = url.UserPassword(c.User.Username(), redacted)
+	}
+	if c.RawQuery != "" {
+		c.RawQuery = redactValues(c.Query(), false).Encode()
+	}
+	return c.String()
+}
+
+func redactValue(v any, dropVolatile bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			switch {
+			case dropVolatile && volatileFields[strings.ToLower(k)]:
+				delete(t, k)
+			case sensitiveFields[strings.ToLower(k)]:
+				if e != nil {
+					t[k] = redacted
+				}
+			default:
+				t[k] = redactValue(e, dropVolatile)
+			}
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = redactValue(e, dropVolatile)
+		}
+	}
+	return v
+}
+
+// redactHeaders copies h without credentials and cookies.
+func redactHeaders(h http.Header) map[string][]string {
+	out := map[string][]string{}
+	for k, vv := range h {
+		switch http.CanonicalHeaderKey(k) {
+		case "Authorization", "Proxy-Authorization", "Cookie":
+			out[k] = []string{redacted}
+		case "Set-Cookie":
+			continue
+		default:
+			out[k] = append([]string(nil), vv...)
+		}
+	}
+	return out
+}
+
+// cassetteName returns the file name of the cassette matching req. Sensitive
+// query and body values are redacted before they are hashed, and multipart
+// bodies are not part of the match: their boundary changes on every run.
+func cassetteName(req *http.Request, body []byte) string {
+	ct := req.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "multipart/") {
+		body = nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.EscapedPath(), redactValues(req.URL.Query(), true).Encode())
+	h.Write(redactBody(body, ct, true))
+	sum := hex.EncodeToString(h.Sum(nil))[:16]
+
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(req.URL.Path, "/"))
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	return strings.ToLower(req.Method) + "_" + slug + "_" + sum + ".json"
+}
+
+// errNoCassette is returned by replay when no cassette matches.
+var errNoCassette = errors.New("no recorded response")
+
+// replay returns the recorded response for req from dir.
+func replay(dir string, req *http.Request, body []byte) (*Result, string, error) {
+	path := filepath.Join(dir, cassetteName(req, body))
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, path, errNoCassette
+	}
+	if err != nil {
+		return nil, path, err
+	}
+	var c cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, path, fmt.Errorf("%s: %w", path, err)
+	}
+	respBody, err := c.Response.decode()
+	if err != nil {
+		return nil, path, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Result{Status: c.Response.Status, Headers: http.Header(c.Response.Headers), Body: respBody}, path, nil
+}
+
+// record writes the cassette for req and res to dir.
+func record(dir string, req *http.Request, body []byte, res *Result) (string, error) {
+	c := cassette{
+		Request: cassetteRequest{
+			Method:       req.Method,
+			URL:          redactURL(req.URL),
+			Headers:      redactHeaders(req.Header),
+			cassetteBody: encodeBody(redactBody(body, req.Header.Get("Content-Type"), false)),
+		},
+		Response: cassetteResponse{
+			Status:       res.Status,
+			Headers:      redactHeaders(res.Headers),
+			cassetteBody: encodeBody(redactBody(res.Body, res.Headers.Get("Content-Type"), false)),
+		},
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+		c.Request.cassetteBody = encodeBody([]byte(fmt.Sprintf("<%d bytes multipart body>", len(body))))
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, cassetteName(req, body))
+	return path, os.WriteFile(path, append(b, '\n'), 0o600)
+}
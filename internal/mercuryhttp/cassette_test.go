@@ -0,0 +1,111 @@
+package mercuryhttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func postJSON(t *testing.T, c *Client, url, body string) (*Result, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	return c.Do(req, []byte(body))
+}
+
+func TestRecordReplay(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		io.WriteString(w, `{"id":"rcp_1","electronicRoutingInfo":{"accountNumber":"123456789","routingNumber":"021000021"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	dir := filepath.Join(t.TempDir(), "cassettes")
+
+	rec := newTestClient(t, ClientOptions{Record: dir})
+	if _, err := postJSON(t, rec, srv.URL+"/api/v1/recipients?x=1&code=s3cr3t-code", `{"name":"Acme","idempotencyKey":"k1","accountNumber":"987"}`); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 || !strings.HasPrefix(filepath.Base(files[0]), "post_api_v1_recipients_") {
+		t.Fatalf("unexpected cassettes: %v", files)
+	}
+	b, _ := os.ReadFile(files[0])
+	for _, leak := range []string{"secret-token", "123456789", "021000021", "987", "session=abc", "s3cr3t-code"} {
+		if bytes.Contains(b, []byte(leak)) {
+			t.Fatalf("cassette contains %q:\n%s", leak, b)
+		}
+	}
+
+	if !bytes.Contains(b, []byte(`"url": "`+srv.URL+`/api/v1/recipients?code=%3Credacted%3E\u0026x=1"`)) {
+		t.Fatalf("cassette URL not redacted:\n%s", b)
+	}
+
+	// The idempotency key and sensitive values are not part of the match; the
+	// body and query otherwise are.
+	calls.Store(0)
+	strict := newTestClient(t, ClientOptions{Replay: dir, ReplayStrict: true})
+	res, err := postJSON(t, strict, srv.URL+"/api/v1/recipients?x=1&code=other", `{"idempotencyKey":"k2","name":"Acme","accountNumber":"987"}`)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if res.Status != http.StatusOK || !strings.Contains(string(res.Body), `"id":"rcp_1"`) || res.Headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected replayed result: %d %v %s", res.Status, res.Headers, res.Body)
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("replay sent %d requests", calls.Load())
+	}
+	if _, err := postJSON(t, strict, srv.URL+"/api/v1/recipients?x=1", `{"name":"Other","accountNumber":"987"}`); err == nil || !strings.Contains(err.Error(), "no recorded response for POST /api/v1/recipients?x=1") {
+		t.Fatalf("expected strict replay miss, got %v", err)
+	}
+	if _, err := postJSON(t, strict, srv.URL+"/api/v1/recipients?x=2", `{"name":"Acme","accountNumber":"987"}`); err == nil {
+		t.Fatalf("expected strict replay miss for a different query")
+	}
+
+	// Without strict mode, a miss goes to the network.
+	lenient := newTestClient(t, ClientOptions{Replay: dir})
+	if _, err := postJSON(t, lenient, srv.URL+"/api/v1/recipients", `{}`); err != nil || calls.Load() != 1 {
+		t.Fatalf("expected a miss to be sent: err=%v calls=%d", err, calls.Load())
+	}
+
+	// A cassette that cannot be written does not fail a request already sent.
+	notDir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var warn bytes.Buffer
+	broken := newTestClient(t, ClientOptions{Record: notDir, Out: &warn})
+	res, err = postJSON(t, broken, srv.URL+"/api/v1/recipients", `{}`)
+	if err != nil || res == nil || res.Status != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("expected the response despite the record failure: res=%v err=%v calls=%d", res, err, calls.Load())
+	}
+	if !strings.HasPrefix(warn.String(), "warning: record: ") {
+		t.Fatalf("expected a record warning, got %q", warn.String())
+	}
+}
+
+func TestCassetteBodies(t *testing.T) {
+	for _, b := range [][]byte{nil, []byte(`{"a":[1,2.50]}`), []byte("plain text\n"), {0xff, 0x00, 0x10}} {
+		got, err := encodeBody(b).decode()
+		if err != nil || !bytes.Equal(got, b) {
+			t.Fatalf("round trip of %q = %q, %v", b, got, err)
+		}
+	}
+
+	form := redactBody([]byte("grant_type=refresh_token&refresh_token=rt&client_id=c"), "application/x-www-form-urlencoded", false)
+	if string(form) != "client_id=c&grant_type=refresh_token&refresh_token=%3Credacted%3E" {
+		t.Fatalf("form body not redacted: %s", form)
+	}
+}
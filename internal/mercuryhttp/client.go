@@ -8,9 +8,10 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -21,11 +22,65 @@ type ClientOptions struct {
 	RetryNonIdempotent bool
 	UserAgent          string
 	Out                io.Writer
+
+	// RateLimiter, when set, paces every attempt and pauses on the API's rate
+	// limit headers.
+	RateLimiter *Limiter
+
+	// Record, when set, saves every response to a cassette file in this
+	// directory, with credentials and sensitive body fields redacted.
+	Record string
+	// Replay, when set, answers requests from the cassettes in this directory.
+	// Unmatched requests are sent over the network unless ReplayStrict is set, in
+	// which case they fail.
+	Replay       string
+	ReplayStrict bool
+
+	// Retry controls how 429/5xx responses and transient network errors are
+	// retried. Zero fields take the defaults of DefaultRetryPolicy.
+	Retry RetryPolicy
+
+	// RefreshToken, when set, is called once when a request sent with a bearer
+	// token gets a 401. It returns a new access token, or ErrNoRefresh when the
+	// current token cannot be refreshed, in which case the 401 is returned as is.
+	RefreshToken func(ctx context.Context) (string, error)
+}
+
+// RetryPolicy bounds retries. Responses are retried on 429 and 5xx, network
+// errors on timeouts and dropped connections; both only for idempotent methods
+// and requests carrying an idempotency key (responses also with
+// RetryNonIdempotent).
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; 1 disables retries.
+	MaxAttempts int
+	// BaseBackoff is the sleep before the first retry; it doubles per retry up to
+	// MaxBackoff. A Retry-After header takes precedence.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Budget caps the total time spent on a request including retries: no retry
+	// is started that would sleep past it. Zero means no cap.
+	Budget time.Duration
+	// AttemptTimeout bounds each attempt, separately from the client Timeout.
+	// Zero means no per-attempt timeout.
+	AttemptTimeout time.Duration
 }
 
+// DefaultRetryPolicy is used for zero RetryPolicy fields.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: 200 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// ErrNoRefresh is returned by ClientOptions.RefreshToken when there is nothing to refresh.
+var ErrNoRefresh = errors.New("token cannot be refreshed")
+
 type Client struct {
 	http *http.Client
 	opts ClientOptions
+
+	// refreshed replaces the bearer token of later requests once a refresh succeeded.
+	refreshed string
 }
 
 type Result struct {
@@ -41,6 +96,18 @@ func NewClient(opts ClientOptions) (*Client, error) {
 	if opts.Timeout <= 0 {
 		opts.Timeout = 30 * time.Second
 	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if opts.Retry.BaseBackoff <= 0 {
+		opts.Retry.BaseBackoff = DefaultRetryPolicy.BaseBackoff
+	}
+	if opts.Retry.MaxBackoff <= 0 {
+		opts.Retry.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if opts.Retry.MaxBackoff < opts.Retry.BaseBackoff {
+		opts.Retry.MaxBackoff = opts.Retry.BaseBackoff
+	}
 	return &Client{
 		http: &http.Client{
 			Timeout: opts.Timeout,
@@ -58,22 +125,58 @@ func (c *Client) Do(req *http.Request, reqBody []byte) (*Result, error) {
 		ctx = context.Background()
 	}
 
-	// Apply headers.
-	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", c.opts.UserAgent)
+	c.Prepare(req)
+
+	if c.opts.Debug || c.opts.Trace {
+		c.logRequest(req, reqBody)
 	}
-	if req.Header.Get("Accept") == "" {
-		req.Header.Set("Accept", "application/json")
+
+	if c.opts.Replay != "" {
+		res, path, err := replay(c.opts.Replay, req, reqBody)
+		switch {
+		case err == nil:
+			if c.opts.Debug || c.opts.Trace {
+				fmt.Fprintf(c.opts.Out, "* replayed %d from %s\n", res.Status, path)
+			}
+			return res, nil
+		case !errors.Is(err, errNoCassette):
+			return nil, fmt.Errorf("replay: %w", err)
+		case c.opts.ReplayStrict:
+			return nil, fmt.Errorf("replay: no recorded response for %s %s (expected %s)", req.Method, req.URL.RequestURI(), path)
+		}
 	}
 
+	res, err := c.send(ctx, req, reqBody)
+	if err != nil || c.opts.Record == "" {
+		return res, err
+	}
+	path, err := record(c.opts.Record, req, reqBody, res)
+	if err != nil {
+		// The request was sent: failing it now would invite a retry of, say,
+		// a payment that went through.
+		fmt.Fprintf(c.opts.Out, "warning: record: %v\n", err)
+		return res, nil
+	}
 	if c.opts.Debug || c.opts.Trace {
-		c.logRequest(req, reqBody)
+		fmt.Fprintf(c.opts.Out, "* recorded to %s\n", path)
 	}
+	return res, nil
+}
 
-	const maxAttempts = 5
-	var lastErr error
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if attempt > 1 {
+// Replaying reports whether responses may come from cassettes rather than the API.
+func (c *Client) Replaying() bool {
+	return c.opts.Replay != ""
+}
+
+// send performs req with retries.
+func (c *Client) send(ctx context.Context, req *http.Request, reqBody []byte) (*Result, error) {
+	policy := c.opts.Retry
+	retryable := isIdempotent(req.Method) || hasIdempotencyKey(req)
+	start := time.Now()
+	triedRefresh := false
+	sent := false
+	for attempt := 1; ; attempt++ {
+		if sent {
 			if req.GetBody != nil {
 				rc, err := req.GetBody()
 				if err == nil {
@@ -84,28 +187,61 @@ func (c *Client) Do(req *http.Request, reqBody []byte) (*Result, error) {
 			}
 		}
 
-		resp, err := c.http.Do(req)
-		if err != nil {
-			lastErr = err
-			break
+		if l := c.opts.RateLimiter; l != nil {
+			waited, err := l.Wait(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if waited > 0 && (c.opts.Debug || c.opts.Trace) {
+				fmt.Fprintf(c.opts.Out, "* rate limit: waited %s\n", waited.Round(time.Millisecond))
+			}
 		}
 
-		body, readErr := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		if readErr != nil {
-			return nil, readErr
+		sent = true
+		resp, body, err := c.attempt(ctx, req)
+		if err != nil {
+			if ctx.Err() != nil || !retryable || !isTransient(err) || attempt >= policy.MaxAttempts {
+				return nil, err
+			}
+			if !c.wait(ctx, policy, start, attempt, retryBackoff(policy, nil, attempt), err.Error()) {
+				return nil, err
+			}
+			continue
 		}
 
 		if c.opts.Debug || c.opts.Trace {
 			c.logResponse(resp, body)
 		}
+		if l := c.opts.RateLimiter; l != nil {
+			if err := l.Observe(ctx, resp); err != nil {
+				return nil, err
+			}
+		}
 
-		if shouldRetry(resp.StatusCode, req.Method, c.opts.RetryNonIdempotent) && attempt < maxAttempts {
-			sleep := retryBackoff(resp, attempt)
-			select {
-			case <-time.After(sleep):
+		// A refresh is not a retry: one is allowed whatever the retry budget,
+		// and resending with the new token does not use up an attempt.
+		if resp.StatusCode == http.StatusUnauthorized && c.opts.RefreshToken != nil && !triedRefresh && hasBearer(req) {
+			triedRefresh = true
+			tok, err := c.opts.RefreshToken(ctx)
+			switch {
+			case err == nil:
+				c.refreshed = tok
+				req.Header.Set("Authorization", "Bearer "+tok)
+				if c.opts.Debug || c.opts.Trace {
+					fmt.Fprintf(c.opts.Out, "* access token refreshed, retrying\n")
+				}
+				attempt--
 				continue
-			case <-ctx.Done():
+			case !errors.Is(err, ErrNoRefresh):
+				return nil, fmt.Errorf("refresh access token: %w", err)
+			}
+		}
+
+		if shouldRetry(resp.StatusCode, req.Method, c.opts.RetryNonIdempotent || hasIdempotencyKey(req)) && attempt < policy.MaxAttempts {
+			if c.wait(ctx, policy, start, attempt, retryBackoff(policy, resp, attempt), resp.Status) {
+				continue
+			}
+			if ctx.Err() != nil {
 				return nil, ctx.Err()
 			}
 		}
@@ -116,11 +252,87 @@ func (c *Client) Do(req *http.Request, reqBody []byte) (*Result, error) {
 			Body:    body,
 		}, nil
 	}
+}
+
+// attempt sends req once and reads the whole response body, under the
+// per-attempt timeout when one is set.
+func (c *Client) attempt(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	parent := ctx
+	t := c.opts.Retry.AttemptTimeout
+	if t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	// timedOut names the per-attempt timeout in errors it caused.
+	timedOut := func(err error) error {
+		if t > 0 && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("attempt timed out after %s: %w", t, err)
+		}
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, timedOut(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, nil, timedOut(err)
+	}
+	return resp, body, nil
+}
+
+// wait sleeps before the next attempt. It returns false, without sleeping, when
+// the sleep would exceed the retry budget, and when ctx is done.
+func (c *Client) wait(ctx context.Context, policy RetryPolicy, start time.Time, attempt int, sleep time.Duration, reason string) bool {
+	if policy.Budget > 0 && time.Since(start)+sleep > policy.Budget {
+		if c.opts.Debug || c.opts.Trace {
+			fmt.Fprintf(c.opts.Out, "* %s; retry budget of %s exhausted\n", reason, policy.Budget)
+		}
+		return false
+	}
+	if c.opts.Debug || c.opts.Trace {
+		fmt.Fprintf(c.opts.Out, "* %s; retrying in %s (attempt %d/%d)\n", reason, sleep.Round(time.Millisecond), attempt+1, policy.MaxAttempts)
+	}
+	select {
+	case <-time.After(sleep):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-	if lastErr == nil {
-		lastErr = errors.New("request failed")
+// Prepare sets the default headers Do adds to every request, so callers can
+// show a request exactly as it would be sent.
+func (c *Client) Prepare(req *http.Request) {
+	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if c.refreshed != "" && hasBearer(req) {
+		req.Header.Set("Authorization", "Bearer "+c.refreshed)
 	}
-	return nil, lastErr
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey marks req as carrying an idempotency key, in a header or in
+// its body, which makes 429/5xx retries safe for non-idempotent methods.
+func WithIdempotencyKey(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotencyKeyCtx{}, true))
+}
+
+func hasIdempotencyKey(req *http.Request) bool {
+	v, _ := req.Context().Value(idempotencyKeyCtx{}).(bool)
+	return v
+}
+
+func hasBearer(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ")
 }
 
 func applyAuth(req *http.Request, token string, scheme string) {
@@ -142,39 +354,55 @@ func ApplyAuth(req *http.Request, token string, scheme string) {
 	applyAuth(req, token, scheme)
 }
 
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
 func shouldRetry(status int, method string, retryNonIdempotent bool) bool {
 	if status == http.StatusTooManyRequests || status >= 500 {
-		switch strings.ToUpper(method) {
-		case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
-			return true
-		default:
-			return retryNonIdempotent
-		}
+		return isIdempotent(method) || retryNonIdempotent
+	}
+	return false
+}
+
+// isTransient reports whether a failed attempt may succeed when repeated:
+// timeouts, and connections refused, reset or closed before a response arrived.
+func isTransient(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
 	}
 	return false
 }
 
-func retryBackoff(resp *http.Response, attempt int) time.Duration {
+func retryBackoff(policy RetryPolicy, resp *http.Response, attempt int) time.Duration {
 	if resp != nil {
-		if ra := resp.Header.Get("Retry-After"); ra != "" {
-			// Retry-After can be an integer seconds or a HTTP date.
-			if secs, err := strconv.Atoi(strings.TrimSpace(ra)); err == nil && secs >= 0 {
-				return time.Duration(secs) * time.Second
-			}
-			if t, err := http.ParseTime(ra); err == nil {
-				d := time.Until(t)
-				if d > 0 {
-					return d
-				}
-			}
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return d
 		}
 	}
 
-	// Exponential backoff with jitter: 200ms * 2^(attempt-1), capped at 5s.
-	base := 200 * time.Millisecond
-	d := base * (1 << (attempt - 1))
-	if d > 5*time.Second {
-		d = 5 * time.Second
+	// Exponential backoff with jitter: BaseBackoff * 2^(attempt-1), capped at MaxBackoff.
+	d := policy.BaseBackoff
+	for i := 1; i < attempt && d < policy.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
 	}
 	// +/- 50% jitter
 	j := time.Duration(rand.Int63n(int64(d))) - d/2
@@ -0,0 +1,212 @@
+package mercuryhttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, opts ClientOptions) *Client {
+	t.Helper()
+	c, err := NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func doRequest(t *testing.T, c *Client, method, url string) (*Result, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Do(req, nil)
+}
+
+// dropFirst closes the connection without a response for the first n requests.
+func dropFirst(n int32, calls *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= n {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}
+}
+
+func TestRetriesTransientNetworkErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(dropFirst(2, &calls))
+	t.Cleanup(srv.Close)
+
+	var log bytes.Buffer
+	c := newTestClient(t, ClientOptions{Debug: true, Out: &log, Retry: RetryPolicy{BaseBackoff: time.Millisecond}})
+	res, err := doRequest(t, c, http.MethodGet, srv.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if res.Status != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("status=%d calls=%d, want 200 after 3 calls", res.Status, calls.Load())
+	}
+	if n := strings.Count(log.String(), "retrying in"); n != 2 {
+		t.Fatalf("expected 2 retries in the debug log, got %d:\n%s", n, log.String())
+	}
+
+	// POSTs without an idempotency key are not resent after a network error.
+	calls.Store(0)
+	if _, err := doRequest(t, c, http.MethodPost, srv.URL); err == nil {
+		t.Fatalf("expected the dropped POST to fail")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("POST sent %d times, want 1", calls.Load())
+	}
+
+	calls.Store(0)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if _, err := c.Do(WithIdempotencyKey(req), nil); err != nil || calls.Load() != 3 {
+		t.Fatalf("POST with idempotency key: err=%v calls=%d, want success after 3 calls", err, calls.Load())
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(dropFirst(10, &calls))
+	t.Cleanup(srv.Close)
+
+	c := newTestClient(t, ClientOptions{Retry: RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond}})
+	if _, err := doRequest(t, c, http.MethodGet, srv.URL); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", calls.Load())
+	}
+}
+
+func TestRefreshOn401(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	// With a single attempt there is no retry, but the refresh still happens.
+	refreshes := 0
+	c := newTestClient(t, ClientOptions{
+		Retry: RetryPolicy{MaxAttempts: 1},
+		RefreshToken: func(context.Context) (string, error) {
+			refreshes++
+			return "fresh", nil
+		},
+	})
+	body := []byte(`{"amount":1}`)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+	ApplyAuth(req, "expired", "bearer")
+	res, err := c.Do(req, body)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if res.Status != http.StatusOK || refreshes != 1 || len(bodies) != 2 || bodies[1] != string(body) {
+		t.Fatalf("status=%d refreshes=%d bodies=%q, want 200 after one refresh", res.Status, refreshes, bodies)
+	}
+
+	// Only one refresh is tried per request.
+	bodies = nil
+	c = newTestClient(t, ClientOptions{
+		Retry:        RetryPolicy{MaxAttempts: 1},
+		RefreshToken: func(context.Context) (string, error) { return "still-wrong", nil },
+	})
+	req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	ApplyAuth(req, "expired", "bearer")
+	res, err = c.Do(req, nil)
+	if err != nil || res.Status != http.StatusUnauthorized || len(bodies) != 2 {
+		t.Fatalf("res=%v err=%v calls=%d, want a 401 after one refresh", res, err, len(bodies))
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := newTestClient(t, ClientOptions{Retry: RetryPolicy{AttemptTimeout: 50 * time.Millisecond, BaseBackoff: time.Millisecond}})
+	res, err := doRequest(t, c, http.MethodGet, srv.URL)
+	if err != nil || res.Status != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("err=%v calls=%d, want success on the second attempt", err, calls.Load())
+	}
+
+	c = newTestClient(t, ClientOptions{Retry: RetryPolicy{MaxAttempts: 1, AttemptTimeout: 50 * time.Millisecond}})
+	calls.Store(0)
+	_, err = doRequest(t, c, http.MethodGet, srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "attempt timed out after 50ms") {
+		t.Fatalf("expected attempt timeout error, got %v", err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	var log bytes.Buffer
+	c := newTestClient(t, ClientOptions{Debug: true, Out: &log, Retry: RetryPolicy{
+		MaxAttempts: 10,
+		BaseBackoff: 40 * time.Millisecond,
+		MaxBackoff:  40 * time.Millisecond,
+		Budget:      100 * time.Millisecond,
+	}})
+	res, err := doRequest(t, c, http.MethodGet, srv.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if res.Status != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want the last 503", res.Status)
+	}
+	if n := calls.Load(); n < 2 || n > 5 {
+		t.Fatalf("calls = %d, want the budget to stop retries after 2-5 attempts", n)
+	}
+	if !strings.Contains(log.String(), "retry budget of 100ms exhausted") {
+		t.Fatalf("expected budget message in debug log:\n%s", log.String())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 9: 300 * time.Millisecond} {
+		d := retryBackoff(p, nil, attempt)
+		if d < want/2 || d > want*3/2 {
+			t.Fatalf("attempt %d: backoff %s outside %s +/- 50%%", attempt, d, want)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if d := retryBackoff(p, resp, 1); d != 3*time.Second {
+		t.Fatalf("Retry-After backoff = %s, want 3s", d)
+	}
+}
@@ -0,0 +1,242 @@
+package mercuryhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/lockfile"
+)
+
+// Rate is a request rate of N requests per Per.
+type Rate struct {
+	N   float64
+	Per time.Duration
+}
+
+func (r Rate) String() string {
+	return strconv.FormatFloat(r.N, 'f', -1, 64) + "/" + r.Per.String()
+}
+
+// ParseRate parses rates such as "10/s", "600/min", "1/2s" or "0.5/s". The
+// period is s, m (or min), h, or any Go duration.
+func ParseRate(s string) (Rate, error) {
+	n, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q (expected N/period, e.g. 10/s)", s)
+	}
+	r := Rate{}
+	v, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return Rate{}, fmt.Errorf("invalid rate %q: count must be a positive number", s)
+	}
+	r.N = v
+	switch per = strings.TrimSpace(per); per {
+	case "s", "sec", "second":
+		r.Per = time.Second
+	case "m", "min", "minute":
+		r.Per = time.Minute
+	case "h", "hour":
+		r.Per = time.Hour
+	default:
+		d, err := time.ParseDuration(per)
+		if err != nil || d <= 0 {
+			return Rate{}, fmt.Errorf("invalid rate %q: unknown period %q", s, per)
+		}
+		r.Per = d
+	}
+	return r, nil
+}
+
+// staleLock is how old a lock file may get before it is assumed to belong to a
+// process that died while holding it.
+const staleLock = 5 * time.Second
+
+// Limiter is a token bucket that holds N tokens and refills N per Per. When it
+// is shared, the bucket lives in a file guarded by a lock file, so concurrent
+// processes on the machine draw from the same bucket.
+//
+// Besides its own rate, the limiter pauses when the API says the limit is
+// reached: on a 429 with Retry-After, and when X-RateLimit-Remaining drops to 0
+// before X-RateLimit-Reset.
+type Limiter struct {
+	rate Rate
+	// dir holds the shared state and lock files; empty for an in-process bucket.
+	dir string
+
+	mu    sync.Mutex
+	state bucketState
+	now   func() time.Time
+}
+
+type bucketState struct {
+	Tokens      float64   `json:"tokens"`
+	Last        time.Time `json:"last"`
+	PausedUntil time.Time `json:"paused_until,omitzero"`
+}
+
+// NewLimiter returns an in-process limiter for r. The bucket starts full.
+func NewLimiter(r Rate) *Limiter {
+	return &Limiter{rate: r, now: time.Now, state: bucketState{Tokens: r.N}}
+}
+
+// NewSharedLimiter returns a limiter whose bucket is shared through files in dir
+// by every process using the same dir.
+func NewSharedLimiter(r Rate, dir string) *Limiter {
+	l := NewLimiter(r)
+	l.dir = dir
+	return l
+}
+
+// Wait blocks until a request may be sent and returns how long it waited.
+func (l *Limiter) Wait(ctx context.Context) (time.Duration, error) {
+	var waited time.Duration
+	for {
+		d, err := l.take(ctx)
+		if err != nil || d <= 0 {
+			return waited, err
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+			waited += d
+		case <-ctx.Done():
+			t.Stop()
+			return waited, ctx.Err()
+		}
+	}
+}
+
+// take consumes a token if one is available, else returns how long to wait
+// before trying again.
+func (l *Limiter) take(ctx context.Context) (time.Duration, error) {
+	var d time.Duration
+	err := l.update(ctx, func(s *bucketState, now time.Time) {
+		l.refill(s, now)
+		switch {
+		case now.Before(s.PausedUntil):
+			d = s.PausedUntil.Sub(now)
+		case s.Tokens >= 1:
+			s.Tokens--
+		default:
+			d = time.Duration((1 - s.Tokens) / l.rate.N * float64(l.rate.Per))
+			if d <= 0 {
+				d = time.Millisecond
+			}
+		}
+	})
+	return d, err
+}
+
+// Observe pauses the limiter according to the rate limit headers of resp.
+func (l *Limiter) Observe(ctx context.Context, resp *http.Response) error {
+	if resp == nil {
+		return nil
+	}
+	now := l.now()
+	var until time.Time
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			until = now.Add(d)
+		}
+	}
+	if rem := strings.TrimSpace(resp.Header.Get("X-RateLimit-Remaining")); rem == "0" {
+		if t, ok := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now); ok && t.After(until) {
+			until = t
+		}
+	}
+	if until.IsZero() {
+		return nil
+	}
+	return l.update(ctx, func(s *bucketState, now time.Time) {
+		l.refill(s, now)
+		if until.After(s.PausedUntil) {
+			s.PausedUntil = until
+		}
+		s.Tokens = 0
+	})
+}
+
+func (l *Limiter) refill(s *bucketState, now time.Time) {
+	if !s.Last.IsZero() && now.After(s.Last) {
+		s.Tokens += now.Sub(s.Last).Seconds() / l.rate.Per.Seconds() * l.rate.N
+	}
+	if s.Tokens > l.rate.N || s.Last.IsZero() {
+		s.Tokens = l.rate.N
+	}
+	s.Last = now
+}
+
+// update applies fn to the bucket, reading and writing it under the lock file
+// when the limiter is shared.
+func (l *Limiter) update(ctx context.Context, fn func(s *bucketState, now time.Time)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir == "" {
+		fn(&l.state, l.now())
+		return nil
+	}
+
+	unlock, err := lockfile.Acquire(ctx, filepath.Join(l.dir, "ratelimit.lock"), staleLock)
+	if err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	defer unlock()
+
+	path := filepath.Join(l.dir, "ratelimit.json")
+	var s bucketState
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		// A corrupt file is treated as a full bucket and rewritten.
+		_ = json.Unmarshal(b, &s)
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	fn(&s, l.now())
+	if b, err = json.Marshal(s); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	return nil
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// parseRateLimitReset reads X-RateLimit-Reset, which APIs send either as a Unix
+// timestamp or as seconds until the reset.
+func parseRateLimitReset(v string, now time.Time) (time.Time, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 {
+		return time.Time{}, false
+	}
+	if f > 1e9 {
+		return time.Unix(0, int64(f*float64(time.Second))), true
+	}
+	return now.Add(time.Duration(f * float64(time.Second))), true
+}
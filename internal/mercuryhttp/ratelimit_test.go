@@ -0,0 +1,146 @@
+package mercuryhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[string]Rate{
+		"10/s":    {10, time.Second},
+		"600/min": {600, time.Minute},
+		"100/h":   {100, time.Hour},
+		"1/2s":    {1, 2 * time.Second},
+		"0.5/s":   {0.5, time.Second},
+	} {
+		got, err := ParseRate(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseRate(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"10", "0/s", "-1/s", "x/s", "10/fortnight", "10/0s"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Fatalf("ParseRate(%q): expected error", in)
+		}
+	}
+}
+
+// fakeClock returns a clock for Limiter.now and a function advancing it.
+func fakeClock() (func() time.Time, func(time.Duration)) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func mustTake(t *testing.T, l *Limiter, want time.Duration) {
+	t.Helper()
+	got, err := l.take(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("take = %s, want %s", got, want)
+	}
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	l := NewLimiter(Rate{2, time.Second})
+	now, advance := fakeClock()
+	l.now = now
+
+	mustTake(t, l, 0)
+	mustTake(t, l, 0)
+	mustTake(t, l, 500*time.Millisecond)
+	advance(500 * time.Millisecond)
+	mustTake(t, l, 0)
+	// The bucket never holds more than N tokens.
+	advance(time.Hour)
+	mustTake(t, l, 0)
+	mustTake(t, l, 0)
+	mustTake(t, l, 500*time.Millisecond)
+}
+
+func TestLimiterObservesRateLimitHeaders(t *testing.T) {
+	l := NewLimiter(Rate{100, time.Second})
+	now, advance := fakeClock()
+	l.now = now
+	ctx := context.Background()
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"2"}}}
+	if err := l.Observe(ctx, resp); err != nil {
+		t.Fatal(err)
+	}
+	mustTake(t, l, 2*time.Second)
+	advance(2 * time.Second)
+	mustTake(t, l, 0)
+
+	reset := now().Add(3 * time.Second).Unix()
+	resp = &http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(reset, 10)},
+	}}
+	if err := l.Observe(ctx, resp); err != nil {
+		t.Fatal(err)
+	}
+	mustTake(t, l, 3*time.Second)
+
+	// Remaining requests above zero do not pause.
+	advance(3 * time.Second)
+	resp = &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Reset": {"30"}}}
+	if err := l.Observe(ctx, resp); err != nil {
+		t.Fatal(err)
+	}
+	mustTake(t, l, 0)
+}
+
+func TestSharedLimiter(t *testing.T) {
+	dir := t.TempDir()
+	now, advance := fakeClock()
+	a := NewSharedLimiter(Rate{2, time.Second}, dir)
+	b := NewSharedLimiter(Rate{2, time.Second}, dir)
+	a.now, b.now = now, now
+
+	mustTake(t, a, 0)
+	mustTake(t, b, 0)
+	mustTake(t, a, 500*time.Millisecond)
+	mustTake(t, b, 500*time.Millisecond)
+	advance(500 * time.Millisecond)
+	mustTake(t, b, 0)
+	mustTake(t, a, 500*time.Millisecond)
+
+	// A lock left by a process that died is broken; ours is released.
+	lock := filepath.Join(dir, "ratelimit.lock")
+	if err := os.WriteFile(lock, []byte("dead"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Second)
+	mustTake(t, a, 0)
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Fatalf("lock left behind: %v", err)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	c := newTestClient(t, ClientOptions{RateLimiter: NewLimiter(Rate{1, 50 * time.Millisecond})})
+	start := time.Now()
+	for range 3 {
+		if _, err := doRequest(t, c, http.MethodGet, srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("3 requests at 1/50ms took %s, want at least 100ms", elapsed)
+	}
+}
@@ -0,0 +1,568 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// DefaultItems is the number of items synthesized for list responses.
+const DefaultItems = 3
+
+// Options configure a Server.
+type Options struct {
+	// SeedDir holds fixtures named <operationId>.json. A fixture is returned as
+	// the operation's response body; for paginated operations it may also be a
+	// bare array of items, which is paged like synthesized items.
+	SeedDir string
+	// Items is the number of items synthesized for paginated list responses
+	// without a fixture. Zero means DefaultItems.
+	Items int
+	// Log, when set, receives one line per request.
+	Log io.Writer
+
+	// Stateful answers account, recipient and payment operations from a State
+	// instead of synthesized responses. Fixtures for getAccounts and
+	// getRecipients become its initial accounts and recipients.
+	Stateful bool
+	// StateFile persists the State as JSON and reloads it on start. It implies
+	// Stateful.
+	StateFile string
+	// ClockSpeed is how many simulated seconds pass per real second in the
+	// State. Zero means real time.
+	ClockSpeed float64
+
+	now func() time.Time
+}
+
+// Server answers every operation in the specs with a response synthesized from
+// its response schema. Requests are routed on the operation's path template
+// anywhere at the end of the request path, so any --base-url prefix works.
+type Server struct {
+	routes   []*route
+	items    int
+	fixtures map[string]any
+	log      io.Writer
+	state    *State
+}
+
+type route struct {
+	cligen.Operation
+	operationID string
+	serverPath  string
+
+	status      int
+	contentType string
+	schema      *openapi.Schema
+	paging      *cligen.Pagination
+}
+
+// NewServer builds a Server for the operations in docs.
+func NewServer(docs []*openapi.SpecDoc, opts Options) (*Server, error) {
+	ops, err := cligen.ListOperations(docs)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{items: opts.Items, log: opts.Log, fixtures: map[string]any{}}
+	if s.items <= 0 {
+		s.items = DefaultItems
+	}
+	for _, op := range ops {
+		r := &route{Operation: op, operationID: op.Op.OperationID, paging: op.Pagination()}
+		if u, err := url.Parse(op.Spec.ServerURLForOperation(op.Op)); err == nil {
+			r.serverPath = strings.TrimSuffix(u.Path, "/")
+		}
+		r.status, r.contentType, r.schema = successResponse(op.Spec, op.Op)
+		s.routes = append(s.routes, r)
+	}
+	if opts.SeedDir != "" {
+		if err := s.loadFixtures(opts.SeedDir); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Stateful || opts.StateFile != "" {
+		if s.state, err = s.newState(opts); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// newState starts the State from the getAccounts and getRecipients fixtures.
+func (s *Server) newState(opts Options) (*State, error) {
+	account := s.route("getAccount")
+	if account == nil {
+		return nil, fmt.Errorf("mock: the specs have no getAccount operation")
+	}
+	seed := func(operationID, field string) []any {
+		switch f := s.fixtures[operationID].(type) {
+		case []any:
+			return f
+		case map[string]any:
+			items, _ := f[field].([]any)
+			return items
+		}
+		return nil
+	}
+	return newState(opts.StateFile, opts.ClockSpeed, opts.now, account.Spec, account.schema,
+		seed("getAccounts", "accounts"), seed("getRecipients", "recipients"))
+}
+
+// State returns the server's State, or nil when it is not stateful.
+func (s *Server) State() *State { return s.state }
+
+func (s *Server) route(operationID string) *route {
+	for _, r := range s.routes {
+		if r.operationID == operationID {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Server) loadFixtures(dir string) error {
+	known := map[string]bool{}
+	for _, r := range s.routes {
+		known[r.operationID] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("mock: seed fixtures: %w", err)
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+		if !known[name] {
+			return fmt.Errorf("mock: seed fixture %s: no operation with operationId %q", e.Name(), name)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("mock: seed fixture %s: %w", e.Name(), err)
+		}
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("mock: seed fixture %s: %w", e.Name(), err)
+		}
+		s.fixtures[name] = v
+	}
+	return nil
+}
+
+// successResponse returns the operation's first declared 2xx response.
+func successResponse(spec *openapi.Spec, op *openapi.Operation) (int, string, *openapi.Schema) {
+	var codes []string
+	for code := range op.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = http.StatusOK
+		}
+		resp, err := spec.OperationResponse(op, code)
+		if err != nil || resp == nil {
+			continue
+		}
+		for ct, mt := range resp.Content {
+			if strings.HasPrefix(ct, "application/json") {
+				return status, "application/json", mt.Schema
+			}
+		}
+		for ct := range resp.Content {
+			return status, ct, nil
+		}
+		return status, "", nil
+	}
+	return http.StatusOK, "", nil
+}
+
+// match finds the route for method and the escaped request path. Templates with
+// more literal segments win, and a request under the operation's declared server
+// path wins over the same template under another prefix.
+func (s *Server) match(method, path string) (*route, []string) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	var best *route
+	var bestArgs []string
+	bestScore := -1
+	for _, r := range s.routes {
+		if r.Method != method {
+			continue
+		}
+		n := len(strings.Split(strings.Trim(r.Path, "/"), "/"))
+		if n > len(segs) {
+			continue
+		}
+		prefix := strings.Join(segs[:len(segs)-n], "/")
+		args, literals, ok := r.MatchPath(strings.Join(segs[len(segs)-n:], "/"))
+		if !ok {
+			continue
+		}
+		score := literals * 2
+		if prefix == strings.Trim(r.serverPath, "/") {
+			score++
+		}
+		if score > bestScore {
+			best, bestArgs, bestScore = r, args, score
+		}
+	}
+	return best, bestArgs
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.state != nil {
+		if _, ctl, ok := strings.Cut(req.URL.Path, "/_mock/"); ok {
+			s.control(w, req, ctl)
+			return
+		}
+	}
+	r, args := s.match(req.Method, req.URL.EscapedPath())
+	if r == nil {
+		s.logf("%s %s -> 404", req.Method, req.URL.RequestURI())
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no operation matches %s %s", req.Method, req.URL.Path))
+		return
+	}
+	body, handled, err := s.state.handle(r, args, req)
+	if !handled && err == nil {
+		body, err = s.respond(r, args, req)
+		if err != nil {
+			err = badRequest("%v", err)
+		}
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			status = apiErr.status
+		}
+		s.logf("%s %s -> %d (%s)", req.Method, req.URL.RequestURI(), status, r.operationID)
+		writeError(w, status, err.Error())
+		return
+	}
+	s.logf("%s %s -> %d (%s)", req.Method, req.URL.RequestURI(), r.status, r.operationID)
+	if r.contentType != "application/json" {
+		if r.contentType != "" {
+			w.Header().Set("Content-Type", r.contentType)
+		}
+		w.WriteHeader(r.status)
+		return
+	}
+	if body == nil && r.schema == nil {
+		w.WriteHeader(r.status)
+		return
+	}
+	writeJSON(w, r.status, body)
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.log != nil {
+		fmt.Fprintf(s.log, format+"\n", args...)
+	}
+}
+
+// control serves the State's endpoints under /_mock/: GET clock, POST
+// clock/advance?by=<duration> and GET state.
+func (s *Server) control(w http.ResponseWriter, req *http.Request, path string) {
+	switch {
+	case req.Method == http.MethodGet && path == "clock":
+		writeJSON(w, http.StatusOK, map[string]any{"now": s.state.Now()})
+	case req.Method == http.MethodPost && path == "clock/advance":
+		d, err := parseAdvance(req.URL.Query().Get("by"))
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "by must be a non-negative duration such as 36h or 2d")
+			return
+		}
+		now, err := s.state.Advance(d)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logf("clock advanced by %s to %s", d, now.Format(time.RFC3339))
+		writeJSON(w, http.StatusOK, map[string]any{"now": now})
+	case req.Method == http.MethodGet && path == "state":
+		writeJSON(w, http.StatusOK, s.state.Snapshot())
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no mock control endpoint %s %s", req.Method, path))
+	}
+}
+
+// parseAdvance parses a Go duration, or a whole number of days such as 2d.
+func parseAdvance(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"errors": map[string]any{"message": message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// respond builds the response body for a request routed to r.
+func (s *Server) respond(r *route, args []string, req *http.Request) (any, error) {
+	if r.schema == nil && s.fixtures[r.operationID] == nil {
+		return nil, nil
+	}
+	seed := r.operationID + "/" + strings.Join(args, "/")
+	fixture, hasFixture := s.fixtures[r.operationID]
+
+	if r.paging != nil {
+		var items []any
+		var body map[string]any
+		switch f := fixture.(type) {
+		case []any:
+			items = f
+		case map[string]any:
+			body = copyObject(f)
+			items, _ = body[r.paging.ItemField].([]any)
+		}
+		if body == nil {
+			body, _ = r.Spec.Example(r.schema, seed).(map[string]any)
+			if body == nil {
+				body = map[string]any{}
+			}
+		}
+		if !hasFixture {
+			items = s.synthesizeItems(r, seed)
+		}
+		if err := paginate(r.paging, body, items, req.URL.Query()); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+
+	var body any
+	if hasFixture {
+		body = copyJSONValue(fixture)
+	} else {
+		body = r.Spec.Example(r.schema, seed)
+	}
+	obj, ok := body.(map[string]any)
+	if !ok || hasFixture {
+		return body, nil
+	}
+	echoPathArgs(r, args, obj)
+	if err := echoRequestBody(r, req, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// synthesizeItems returns s.items examples of the list's item schema, each with
+// its own seed so IDs differ.
+func (s *Server) synthesizeItems(r *route, seed string) []any {
+	schema := r.Spec.FlattenSchema(r.schema)
+	if schema == nil {
+		return nil
+	}
+	prop, ok := schema.Properties[r.paging.ItemField]
+	if !ok {
+		return nil
+	}
+	arr := r.Spec.FlattenSchema(&prop)
+	if arr == nil || arr.Items == nil {
+		return nil
+	}
+	items := make([]any, 0, s.items)
+	for i := range s.items {
+		items = append(items, r.Spec.Example(arr.Items, seed+"#"+strconv.Itoa(i)))
+	}
+	return items
+}
+
+// echoPathArgs copies path arguments into same-named response fields, and into
+// id when the last path parameter names the returned resource
+// (/recipient/{recipientId}, but not /agent-coa-templates/{booksId}).
+func echoPathArgs(r *route, args []string, obj map[string]any) {
+	names := r.PathParams()
+	for i, name := range names {
+		if i < len(args) {
+			if _, ok := obj[name]; ok {
+				obj[name] = args[i]
+			}
+		}
+	}
+	if _, ok := obj["id"]; !ok || len(args) == 0 {
+		return
+	}
+	segs := strings.Split(strings.Trim(r.Path, "/"), "/")
+	last := segs[len(segs)-1]
+	if !strings.HasPrefix(last, "{") {
+		return
+	}
+	collection := ""
+	for i := len(segs) - 2; i >= 0; i-- {
+		if !strings.HasPrefix(segs[i], "{") {
+			collection = segs[i]
+			break
+		}
+	}
+	if identifies(names[len(names)-1], collection) {
+		obj["id"] = args[len(args)-1]
+	}
+}
+
+// identifies reports whether the path parameter param (e.g. customerId) names
+// an item of collection (e.g. customers).
+func identifies(param, collection string) bool {
+	stem := strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(param, "Id"), "_id"))
+	coll := strings.ToLower(strings.ReplaceAll(collection, "-", ""))
+	if stem == "" || coll == "" {
+		return false
+	}
+	return strings.Contains(coll, stem) || strings.Contains(stem, strings.TrimSuffix(coll, "s"))
+}
+
+// echoRequestBody copies top-level JSON request fields that the response schema
+// also declares, so created and updated resources reflect what was sent.
+func echoRequestBody(r *route, req *http.Request, obj map[string]any) error {
+	if req.Body == nil || !strings.Contains(req.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil || len(b) == 0 {
+		return err
+	}
+	var in map[string]any
+	if err := json.Unmarshal(b, &in); err != nil {
+		return fmt.Errorf("request body is not a JSON object: %w", err)
+	}
+	schema := r.Spec.FlattenSchema(r.schema)
+	if schema == nil {
+		return nil
+	}
+	for k, v := range in {
+		if _, ok := schema.Properties[k]; ok {
+			obj[k] = v
+		}
+	}
+	return nil
+}
+
+// paginate puts the page of items selected by q into body, in the shape --all
+// follows for p.
+func paginate(p *cligen.Pagination, body map[string]any, items []any, q url.Values) error {
+	limit := len(items)
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("limit must be a positive integer")
+		}
+		limit = n
+	}
+
+	start := 0
+	if token := q.Get(p.QueryParam); token != "" {
+		i, err := pageStart(p, items, token)
+		if err != nil {
+			return err
+		}
+		start = i
+	}
+	start = min(start, len(items))
+	end := min(start+limit, len(items))
+	page := items[start:end]
+	if page == nil {
+		page = []any{}
+	}
+	body[p.ItemField] = page
+
+	switch p.Mode {
+	case "cursor":
+		pg, _ := body["page"].(map[string]any)
+		if pg == nil {
+			pg = map[string]any{}
+		}
+		delete(pg, "previousPage")
+		if end < len(items) {
+			pg["nextPage"] = itemCursor(items, end-1)
+		} else {
+			delete(pg, "nextPage")
+		}
+		if start > 0 {
+			pg["previousPage"] = itemCursor(items, start)
+		}
+		body["page"] = pg
+		if _, ok := body["total"]; ok {
+			body["total"] = len(page)
+		}
+	case "offset":
+		body[p.TotalField] = len(items)
+	case "page_token":
+		if end < len(items) {
+			body[p.NextField] = strconv.Itoa(end)
+		} else {
+			body[p.NextField] = nil
+		}
+	}
+	return nil
+}
+
+// pageStart returns the index of the first item on the page selected by token.
+func pageStart(p *cligen.Pagination, items []any, token string) (int, error) {
+	if p.Mode == "cursor" {
+		for i := range items {
+			if itemCursor(items, i) == token {
+				return i + 1, nil
+			}
+		}
+	}
+	n, err := strconv.Atoi(token)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: unknown page %q", p.QueryParam, token)
+	}
+	return n, nil
+}
+
+// itemCursor is the cursor for the item at i: its id, or its index when it has none.
+func itemCursor(items []any, i int) string {
+	if obj, ok := items[i].(map[string]any); ok {
+		if id, ok := obj["id"].(string); ok && id != "" {
+			return id
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+func copyObject(m map[string]any) map[string]any {
+	out, _ := copyJSONValue(m).(map[string]any)
+	return out
+}
+
+func copyJSONValue(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
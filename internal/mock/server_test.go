@@ -0,0 +1,182 @@
+package mock
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tarrence/mercury-cli/internal/cligen"
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+func newTestServer(t *testing.T, opts Options) (*httptest.Server, []*openapi.SpecDoc) {
+	t.Helper()
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(docs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv, docs
+}
+
+func get(t *testing.T, url string) map[string]any {
+	t.Helper()
+	return call(t, http.MethodGet, url, "")
+}
+
+func call(t *testing.T, method, url, body string) map[string]any {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: %d %s", method, url, resp.StatusCode, b)
+	}
+	var v map[string]any
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatalf("%s %s: %v: %s", method, url, err, b)
+	}
+	return v
+}
+
+// Every GET with a JSON response answers with a body that matches its schema,
+// including fields echoed from the path.
+func TestResponsesMatchSpec(t *testing.T) {
+	srv, docs := newTestServer(t, Options{})
+	ops, err := cligen.ListOperations(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		if op.Method != http.MethodGet {
+			continue
+		}
+		_, ct, schema := successResponse(op.Spec, op.Op)
+		if ct != "application/json" || schema == nil {
+			continue
+		}
+		path := op.Path
+		for _, p := range op.PathParams() {
+			path = strings.Replace(path, "{"+p+"}", openapi.ExampleUUID(p), 1)
+		}
+		resp, err := http.Get(srv.URL + "/api/v1" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v any
+		err = json.NewDecoder(resp.Body).Decode(&v)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: %d %v", path, resp.StatusCode, err)
+			continue
+		}
+		if errs := op.Spec.Validate(schema, v); len(errs) > 0 {
+			t.Errorf("GET %s: response does not match spec:\n%v", path, errs)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	srv, _ := newTestServer(t, Options{Items: 5})
+
+	// cursor
+	first := get(t, srv.URL+"/api/v1/accounts?limit=2")
+	accounts := first["accounts"].([]any)
+	next, _ := first["page"].(map[string]any)["nextPage"].(string)
+	if len(accounts) != 2 || next != accounts[1].(map[string]any)["id"] {
+		t.Fatalf("unexpected first page: %v", first)
+	}
+	seen := map[any]bool{}
+	for _, a := range accounts {
+		seen[a.(map[string]any)["id"]] = true
+	}
+	for next != "" {
+		page := get(t, srv.URL+"/api/v1/accounts?limit=2&start_after="+next)
+		for _, a := range page["accounts"].([]any) {
+			seen[a.(map[string]any)["id"]] = true
+		}
+		next, _ = page["page"].(map[string]any)["nextPage"].(string)
+	}
+	if len(seen) != 5 {
+		t.Fatalf("cursor pages returned %d distinct accounts, want 5", len(seen))
+	}
+
+	// offset
+	page := get(t, srv.URL+"/api/v1/account/acc_1/transactions?limit=2&offset=4")
+	if n := len(page["transactions"].([]any)); n != 1 || page["total"] != 5.0 {
+		t.Fatalf("unexpected offset page: %v", page)
+	}
+
+	// page_token
+	page = get(t, srv.URL+"/api/v1/journal-entries/b1?limit=3")
+	if n := len(page["records"].([]any)); n != 3 || page["next_page_token"] != "3" {
+		t.Fatalf("unexpected page_token page: %v", page)
+	}
+	page = get(t, srv.URL+"/api/v1/journal-entries/b1?limit=3&page_token=3")
+	if n := len(page["records"].([]any)); n != 2 || page["next_page_token"] != nil {
+		t.Fatalf("unexpected last page_token page: %v", page)
+	}
+}
+
+func TestEchoesPathAndBody(t *testing.T) {
+	srv, _ := newTestServer(t, Options{})
+
+	rcp := get(t, srv.URL+"/api/v1/recipient/rcp_42")
+	if rcp["id"] != "rcp_42" {
+		t.Fatalf("id not taken from path: %v", rcp["id"])
+	}
+	created := call(t, http.MethodPost, srv.URL+"/api/v1/recipients", `{"name":"Acme Corp","emails":["ap@acme.example"],"unknown":1}`)
+	if created["name"] != "Acme Corp" || created["unknown"] != nil {
+		t.Fatalf("request body not echoed: %v", created)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/no-such-thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown route: %d", resp.StatusCode)
+	}
+}
+
+func TestSeedFixtures(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "getAccounts.json"), []byte(`[{"id":"a1","name":"Ops"},{"id":"a2","name":"Payroll"}]`), 0o644)
+	os.WriteFile(filepath.Join(dir, "getOrganization.json"), []byte(`{"organization":{"legalBusinessName":"Acme"}}`), 0o644)
+	srv, _ := newTestServer(t, Options{SeedDir: dir})
+
+	page := get(t, srv.URL+"/api/v1/accounts?limit=1&start_after=a1")
+	if accounts := page["accounts"].([]any); len(accounts) != 1 || accounts[0].(map[string]any)["name"] != "Payroll" {
+		t.Fatalf("fixture not paged: %v", page)
+	}
+	if org := get(t, srv.URL+"/api/v1/organization"); org["organization"].(map[string]any)["legalBusinessName"] != "Acme" {
+		t.Fatalf("fixture not returned: %v", org)
+	}
+
+	os.WriteFile(filepath.Join(dir, "noSuchOperation.json"), []byte(`{}`), 0o644)
+	docs, _ := openapi.LoadEmbeddedSpecs()
+	if _, err := NewServer(docs, Options{SeedDir: dir}); err == nil || !strings.Contains(err.Error(), "noSuchOperation") {
+		t.Fatalf("expected unknown fixture error, got %v", err)
+	}
+}
@@ -0,0 +1,664 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+const (
+	// achSettlement is how long an ACH payment stays pending on the simulated clock.
+	achSettlement = 24 * time.Hour
+	// failingCents makes a payment whose amount ends in .13 fail at settlement,
+	// so failure handling can be exercised.
+	failingCents = 13
+)
+
+const stateVersion = 1
+
+// State is the model behind a stateful mock server: accounts, recipients and
+// the transactions between them. Payments are created pending, hold funds from
+// the available balance and settle (or fail) as the simulated clock passes their
+// estimated delivery date.
+type State struct {
+	mu   sync.Mutex
+	path string
+
+	// The simulated time is base plus the real time elapsed since anchor,
+	// scaled by speed.
+	realNow func() time.Time
+	speed   float64
+	base    time.Time
+	anchor  time.Time
+
+	seq          int
+	accounts     []map[string]any
+	recipients   []map[string]any
+	transactions []*transaction
+	keys         map[string][]string // idempotencyKey -> transaction IDs
+}
+
+// transaction is a Transaction as the API returns it.
+type transaction struct {
+	ID                         string     `json:"id"`
+	AccountID                  string     `json:"accountId"`
+	Amount                     float64    `json:"amount"`
+	Status                     string     `json:"status"`
+	Kind                       string     `json:"kind"`
+	CounterpartyID             string     `json:"counterpartyId"`
+	CounterpartyName           string     `json:"counterpartyName"`
+	CreatedAt                  time.Time  `json:"createdAt"`
+	EstimatedDeliveryDate      time.Time  `json:"estimatedDeliveryDate"`
+	PostedAt                   *time.Time `json:"postedAt"`
+	FailedAt                   *time.Time `json:"failedAt"`
+	ReasonForFailure           *string    `json:"reasonForFailure"`
+	Note                       *string    `json:"note"`
+	ExternalMemo               *string    `json:"externalMemo"`
+	DashboardLink              string     `json:"dashboardLink"`
+	CompliantWithReceiptPolicy bool       `json:"compliantWithReceiptPolicy"`
+	HasGeneratedReceipt        bool       `json:"hasGeneratedReceipt"`
+	Attachments                []any      `json:"attachments"`
+	RelatedTransactions        []any      `json:"relatedTransactions"`
+}
+
+type stateFile struct {
+	Version         int                 `json:"version"`
+	Clock           time.Time           `json:"clock"`
+	Seq             int                 `json:"seq"`
+	Accounts        []map[string]any    `json:"accounts"`
+	Recipients      []map[string]any    `json:"recipients"`
+	Transactions    []*transaction      `json:"transactions"`
+	IdempotencyKeys map[string][]string `json:"idempotency_keys,omitempty"`
+}
+
+// apiError is answered with its status and an error body.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+func notFound(kind, id string) error {
+	return &apiError{http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, id)}
+}
+
+func badRequest(format string, args ...any) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// newState loads the state from path when it exists, or starts from seed
+// accounts and recipients (synthesized accounts when there are none).
+func newState(path string, speed float64, now func() time.Time, spec *openapi.Spec, account *openapi.Schema, seedAccounts, seedRecipients []any) (*State, error) {
+	if now == nil {
+		now = time.Now
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	st := &State{path: path, realNow: now, speed: speed, anchor: now(), keys: map[string][]string{}}
+	st.base = st.anchor.UTC().Truncate(time.Second)
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			var f stateFile
+			if err := json.Unmarshal(b, &f); err != nil {
+				return nil, fmt.Errorf("mock: state %s: %w", path, err)
+			}
+			if f.Version != stateVersion {
+				return nil, fmt.Errorf("mock: state %s: unsupported version %d", path, f.Version)
+			}
+			st.base, st.seq = f.Clock, f.Seq
+			st.accounts, st.recipients, st.transactions = f.Accounts, f.Recipients, f.Transactions
+			if f.IdempotencyKeys != nil {
+				st.keys = f.IdempotencyKeys
+			}
+			return st, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("mock: state: %w", err)
+		}
+	}
+
+	for _, a := range seedAccounts {
+		if m, ok := a.(map[string]any); ok {
+			st.accounts = append(st.accounts, m)
+		}
+	}
+	for _, r := range seedRecipients {
+		if m, ok := r.(map[string]any); ok {
+			st.recipients = append(st.recipients, m)
+		}
+	}
+	if len(st.accounts) == 0 {
+		for _, a := range []struct {
+			name, kind string
+			balance    float64
+		}{{"Ops Checking", "checking", 100000}, {"Reserve Savings", "savings", 250000}} {
+			acct, _ := spec.Example(account, "mock/account/"+a.kind).(map[string]any)
+			if acct == nil {
+				acct = map[string]any{}
+			}
+			acct["id"] = openapi.ExampleUUID("mock/account/" + a.kind)
+			acct["name"] = a.name
+			acct["kind"] = a.kind
+			acct["status"] = "active"
+			acct["nickname"] = nil
+			acct["availableBalance"] = a.balance
+			acct["currentBalance"] = a.balance
+			acct["createdAt"] = st.base.Format(time.RFC3339)
+			st.accounts = append(st.accounts, acct)
+		}
+	}
+	return st, st.save()
+}
+
+// Now returns the simulated time.
+func (st *State) Now() time.Time {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.now()
+}
+
+func (st *State) now() time.Time {
+	elapsed := time.Duration(float64(st.realNow().Sub(st.anchor)) * st.speed)
+	return st.base.Add(elapsed).UTC().Truncate(time.Second)
+}
+
+// Advance moves the simulated clock forward by d and settles the payments that
+// became due.
+func (st *State) Advance(d time.Duration) (time.Time, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.base = st.base.Add(d)
+	st.settle()
+	return st.now(), st.save()
+}
+
+func (st *State) nextID(kind string) string {
+	st.seq++
+	return openapi.ExampleUUID("mock/" + kind + "/" + strconv.Itoa(st.seq))
+}
+
+// settle moves pending payments whose estimated delivery date has passed to
+// sent, or to failed for amounts ending in .13, and books them on the account.
+func (st *State) settle() bool {
+	now := st.now()
+	changed := false
+	for _, t := range st.transactions {
+		if t.Status != "pending" || t.EstimatedDeliveryDate.After(now) {
+			continue
+		}
+		acct := st.account(t.AccountID)
+		at := t.EstimatedDeliveryDate
+		if cents(t.Amount) == failingCents {
+			t.Status = "failed"
+			t.FailedAt = &at
+			reason := "Simulated failure: payment amounts ending in .13 fail"
+			t.ReasonForFailure = &reason
+			if acct != nil {
+				addBalance(acct, "availableBalance", -t.Amount)
+			}
+		} else {
+			t.Status = "sent"
+			t.PostedAt = &at
+			if acct != nil {
+				addBalance(acct, "currentBalance", t.Amount)
+			}
+		}
+		changed = true
+	}
+	return changed
+}
+
+func cents(amount float64) int {
+	c := int(math.Round(math.Abs(amount) * 100))
+	return c % 100
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func addBalance(acct map[string]any, field string, delta float64) {
+	v, _ := acct[field].(float64)
+	acct[field] = roundCents(v + delta)
+}
+
+func (st *State) account(id string) map[string]any {
+	for _, a := range st.accounts {
+		if a["id"] == id {
+			return a
+		}
+	}
+	return nil
+}
+
+func (st *State) recipient(id string) map[string]any {
+	for _, r := range st.recipients {
+		if r["id"] == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (st *State) transaction(id string) *transaction {
+	for _, t := range st.transactions {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (st *State) save() error {
+	if st.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st.file(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(st.path), ".mock-state-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), st.path)
+}
+
+func (st *State) file() stateFile {
+	return stateFile{
+		Version:         stateVersion,
+		Clock:           st.now(),
+		Seq:             st.seq,
+		Accounts:        st.accounts,
+		Recipients:      st.recipients,
+		Transactions:    st.transactions,
+		IdempotencyKeys: st.keys,
+	}
+}
+
+// Snapshot returns the whole state as it is persisted.
+func (st *State) Snapshot() any {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.settle()
+	return copyJSONValue(st.file())
+}
+
+// stateHandler answers one operation from the state. body is the decoded JSON
+// request body, or nil.
+type stateHandler func(st *State, r *route, args []string, q url.Values, body map[string]any) (any, error)
+
+var stateHandlers = map[string]stateHandler{
+	"getAccounts":             (*State).getAccounts,
+	"getAccount":              (*State).getAccount,
+	"getRecipients":           (*State).getRecipients,
+	"getRecipient":            (*State).getRecipient,
+	"createRecipient":         (*State).createRecipient,
+	"updateRecipient":         (*State).updateRecipient,
+	"createTransaction":       (*State).createTransaction,
+	"createInternalTransfer":  (*State).createInternalTransfer,
+	"listAccountTransactions": (*State).listAccountTransactions,
+	"listTransactions":        (*State).listTransactions,
+	"getTransaction":          (*State).getTransaction,
+	"getTransactionById":      (*State).getTransactionByID,
+}
+
+// handle answers r from the state. It reports false for operations the state
+// does not model, which are answered with synthesized responses instead, and
+// for every operation when st is nil.
+func (st *State) handle(r *route, args []string, req *http.Request) (any, bool, error) {
+	h, ok := stateHandlers[r.operationID]
+	if st == nil || !ok {
+		return nil, false, nil
+	}
+	var body map[string]any
+	if req.Body != nil && strings.Contains(req.Header.Get("Content-Type"), "json") {
+		dec := json.NewDecoder(req.Body)
+		if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			return nil, true, badRequest("request body is not a JSON object: %v", err)
+		}
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	changed := st.settle()
+	v, err := h(st, r, args, req.URL.Query(), body)
+	if err != nil {
+		return nil, true, err
+	}
+	if changed || req.Method != http.MethodGet {
+		if err := st.save(); err != nil {
+			return nil, true, err
+		}
+	}
+	return copyJSONValue(v), true, nil
+}
+
+func (st *State) getAccounts(r *route, _ []string, q url.Values, _ map[string]any) (any, error) {
+	return pageOf(r, q, toItems(st.accounts))
+}
+
+func (st *State) getAccount(_ *route, args []string, _ url.Values, _ map[string]any) (any, error) {
+	if a := st.account(args[0]); a != nil {
+		return a, nil
+	}
+	return nil, notFound("account", args[0])
+}
+
+func (st *State) getRecipients(r *route, _ []string, q url.Values, _ map[string]any) (any, error) {
+	return pageOf(r, q, toItems(st.recipients))
+}
+
+func (st *State) getRecipient(_ *route, args []string, _ url.Values, _ map[string]any) (any, error) {
+	if rcp := st.recipient(args[0]); rcp != nil {
+		return rcp, nil
+	}
+	return nil, notFound("recipient", args[0])
+}
+
+func (st *State) createRecipient(r *route, _ []string, _ url.Values, body map[string]any) (any, error) {
+	name, _ := body["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		return nil, badRequest("name is required")
+	}
+	if _, ok := body["emails"].([]any); !ok {
+		return nil, badRequest("emails is required")
+	}
+	rcp := map[string]any{
+		"id":          st.nextID("recipient"),
+		"status":      "active",
+		"attachments": []any{},
+	}
+	mergeDeclared(r, rcp, body)
+	rcp["defaultPaymentMethod"] = defaultPaymentMethod(rcp)
+	st.recipients = append(st.recipients, rcp)
+	return rcp, nil
+}
+
+func (st *State) updateRecipient(r *route, args []string, _ url.Values, body map[string]any) (any, error) {
+	rcp := st.recipient(args[0])
+	if rcp == nil {
+		return nil, notFound("recipient", args[0])
+	}
+	mergeDeclared(r, rcp, body)
+	rcp["defaultPaymentMethod"] = defaultPaymentMethod(rcp)
+	return rcp, nil
+}
+
+// defaultPaymentMethod picks the first payment method the recipient has routing
+// information for.
+func defaultPaymentMethod(rcp map[string]any) string {
+	for _, m := range []struct{ field, method string }{
+		{"electronicRoutingInfo", "ach"},
+		{"domesticWireRoutingInfo", "domesticWire"},
+		{"internationalWireRoutingInfo", "internationalWire"},
+		{"checkInfo", "check"},
+		{"address", "check"},
+	} {
+		if rcp[m.field] != nil {
+			return m.method
+		}
+	}
+	return "ach"
+}
+
+// mergeDeclared copies body fields that the operation's response schema declares.
+func mergeDeclared(r *route, obj, body map[string]any) {
+	schema := r.Spec.FlattenSchema(r.schema)
+	if schema == nil {
+		return
+	}
+	for k, v := range body {
+		if _, ok := schema.Properties[k]; ok {
+			obj[k] = v
+		}
+	}
+}
+
+// replayed returns the transactions created earlier with the same idempotency key.
+func (st *State) replayed(body map[string]any) []*transaction {
+	key, _ := body["idempotencyKey"].(string)
+	var out []*transaction
+	for _, id := range st.keys[key] {
+		if t := st.transaction(id); t != nil {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (st *State) remember(body map[string]any, txs ...*transaction) {
+	key, _ := body["idempotencyKey"].(string)
+	if key == "" {
+		return
+	}
+	for _, t := range txs {
+		st.keys[key] = append(st.keys[key], t.ID)
+	}
+}
+
+func positiveAmount(body map[string]any) (float64, error) {
+	amount, ok := body["amount"].(float64)
+	if !ok || roundCents(amount) < 0.01 {
+		return 0, badRequest("amount must be a positive dollar amount")
+	}
+	return roundCents(amount), nil
+}
+
+// debit holds amount from acct's available balance.
+func debit(acct map[string]any, amount float64) error {
+	if available, _ := acct["availableBalance"].(float64); available < amount {
+		return badRequest("insufficient funds: available balance is %.2f", available)
+	}
+	addBalance(acct, "availableBalance", -amount)
+	return nil
+}
+
+func (st *State) newTransaction(accountID string, amount float64, kind, counterpartyID, counterpartyName string) *transaction {
+	id := st.nextID("transaction")
+	now := st.now()
+	return &transaction{
+		ID:                    id,
+		AccountID:             accountID,
+		Amount:                amount,
+		Status:                "pending",
+		Kind:                  kind,
+		CounterpartyID:        counterpartyID,
+		CounterpartyName:      counterpartyName,
+		CreatedAt:             now,
+		EstimatedDeliveryDate: now.Add(achSettlement),
+		DashboardLink:         "https://app.mercury.com/transactions/" + id,
+		Attachments:           []any{},
+		RelatedTransactions:   []any{},
+	}
+}
+
+func optionalString(body map[string]any, field string) *string {
+	if s, ok := body[field].(string); ok && s != "" {
+		return &s
+	}
+	return nil
+}
+
+func (st *State) createTransaction(_ *route, args []string, _ url.Values, body map[string]any) (any, error) {
+	if prev := st.replayed(body); len(prev) == 1 {
+		return prev[0], nil
+	}
+	acct := st.account(args[0])
+	if acct == nil {
+		return nil, notFound("account", args[0])
+	}
+	recipientID, _ := body["recipientId"].(string)
+	rcp := st.recipient(recipientID)
+	if rcp == nil {
+		return nil, notFound("recipient", recipientID)
+	}
+	if rcp["status"] != "active" {
+		return nil, badRequest("recipient %s is not active", recipientID)
+	}
+	if m, _ := body["paymentMethod"].(string); m != "ach" {
+		return nil, badRequest("paymentMethod must be \"ach\"")
+	}
+	amount, err := positiveAmount(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := debit(acct, amount); err != nil {
+		return nil, err
+	}
+	name, _ := rcp["name"].(string)
+	t := st.newTransaction(args[0], -amount, "externalTransfer", recipientID, name)
+	t.Note = optionalString(body, "note")
+	t.ExternalMemo = optionalString(body, "externalMemo")
+	st.transactions = append(st.transactions, t)
+	st.remember(body, t)
+	rcp["dateLastPaid"] = t.CreatedAt.Format(time.RFC3339)
+	return t, nil
+}
+
+// createInternalTransfer moves money between two accounts at once.
+func (st *State) createInternalTransfer(_ *route, _ []string, _ url.Values, body map[string]any) (any, error) {
+	if prev := st.replayed(body); len(prev) == 2 {
+		return map[string]any{"debitTransaction": prev[0], "creditTransaction": prev[1]}, nil
+	}
+	srcID, _ := body["sourceAccountId"].(string)
+	dstID, _ := body["destinationAccountId"].(string)
+	src, dst := st.account(srcID), st.account(dstID)
+	if src == nil {
+		return nil, notFound("account", srcID)
+	}
+	if dst == nil {
+		return nil, notFound("account", dstID)
+	}
+	if srcID == dstID {
+		return nil, badRequest("source and destination accounts must differ")
+	}
+	amount, err := positiveAmount(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := debit(src, amount); err != nil {
+		return nil, err
+	}
+	addBalance(src, "currentBalance", -amount)
+	addBalance(dst, "availableBalance", amount)
+	addBalance(dst, "currentBalance", amount)
+
+	srcName, _ := src["name"].(string)
+	dstName, _ := dst["name"].(string)
+	debitTx := st.newTransaction(srcID, -amount, "internalTransfer", dstID, dstName)
+	creditTx := st.newTransaction(dstID, amount, "internalTransfer", srcID, srcName)
+	for _, t := range []*transaction{debitTx, creditTx} {
+		posted := t.CreatedAt
+		t.Status, t.PostedAt, t.EstimatedDeliveryDate = "sent", &posted, posted
+		t.Note = optionalString(body, "note")
+	}
+	st.transactions = append(st.transactions, debitTx, creditTx)
+	st.remember(body, debitTx, creditTx)
+	return map[string]any{"debitTransaction": debitTx, "creditTransaction": creditTx}, nil
+}
+
+// filterTransactions returns the transactions matching the status and accountId
+// query filters, newest first unless order=asc.
+func (st *State) filterTransactions(q url.Values, accountIDs []string) []any {
+	statuses := q["status"]
+	var out []any
+	for i := len(st.transactions) - 1; i >= 0; i-- {
+		t := st.transactions[i]
+		if len(statuses) > 0 && !slices.Contains(statuses, t.Status) {
+			continue
+		}
+		if len(accountIDs) > 0 && !slices.Contains(accountIDs, t.AccountID) {
+			continue
+		}
+		out = append(out, t)
+	}
+	if q.Get("order") == "asc" {
+		slices.Reverse(out)
+	}
+	return toItems(out)
+}
+
+func (st *State) listAccountTransactions(r *route, args []string, q url.Values, _ map[string]any) (any, error) {
+	if st.account(args[0]) == nil {
+		return nil, notFound("account", args[0])
+	}
+	return pageOf(r, q, st.filterTransactions(q, args[:1]))
+}
+
+func (st *State) listTransactions(r *route, _ []string, q url.Values, _ map[string]any) (any, error) {
+	return pageOf(r, q, st.filterTransactions(q, q["accountId"]))
+}
+
+func (st *State) getTransaction(_ *route, args []string, _ url.Values, _ map[string]any) (any, error) {
+	if t := st.transaction(args[1]); t != nil && t.AccountID == args[0] {
+		return t, nil
+	}
+	return nil, notFound("transaction", args[1])
+}
+
+func (st *State) getTransactionByID(_ *route, args []string, _ url.Values, _ map[string]any) (any, error) {
+	if t := st.transaction(args[0]); t != nil {
+		return t, nil
+	}
+	return nil, notFound("transaction", args[0])
+}
+
+// toItems converts state records to decoded JSON values for paging.
+func toItems[T any](records []T) []any {
+	items, _ := copyJSONValue(records).([]any)
+	if items == nil {
+		items = []any{}
+	}
+	return items
+}
+
+// pageOf returns the page of items selected by q, shaped like r's list response.
+func pageOf(r *route, q url.Values, items []any) (any, error) {
+	body := map[string]any{}
+	if r.paging.Mode == "cursor" {
+		body["page"] = map[string]any{}
+	}
+	if schema := r.Spec.FlattenSchema(r.schema); schema != nil && hasProperty(schema, "total") {
+		body["total"] = 0
+	}
+	if err := paginate(r.paging, body, items, q); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return body, nil
+}
+
+func hasProperty(schema *openapi.Schema, name string) bool {
+	_, ok := schema.Properties[name]
+	return ok
+}
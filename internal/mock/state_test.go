@@ -0,0 +1,167 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+func newStatefulServer(t *testing.T, opts Options) (*httptest.Server, *Server) {
+	t.Helper()
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Stateful = true
+	s, err := NewServer(docs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+// conforms checks v against the response schema of operationID.
+func conforms(t *testing.T, s *Server, operationID string, v any) {
+	t.Helper()
+	r := s.route(operationID)
+	if errs := r.Spec.Validate(r.schema, v); len(errs) > 0 {
+		t.Fatalf("%s response does not match spec:\n%v", operationID, errs)
+	}
+}
+
+func status(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var v map[string]any
+	json.NewDecoder(resp.Body).Decode(&v)
+	msg, _ := v["errors"].(map[string]any)["message"].(string)
+	return resp.StatusCode, msg
+}
+
+func TestStatefulPayments(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	srv, s := newStatefulServer(t, Options{StateFile: statePath, now: func() time.Time { return now }})
+	api := srv.URL + "/api/v1"
+
+	accounts := get(t, api+"/accounts")
+	conforms(t, s, "getAccounts", accounts)
+	checking := accounts["accounts"].([]any)[0].(map[string]any)["id"].(string)
+	savings := accounts["accounts"].([]any)[1].(map[string]any)["id"].(string)
+
+	rcp := call(t, http.MethodPost, api+"/recipients", `{"name":"Acme Corp","emails":["ap@acme.example"],
+		"electronicRoutingInfo":{"accountNumber":"123456789","routingNumber":"021000021","electronicAccountType":"businessChecking",
+		"address":{"address1":"1 Main St","city":"SF","region":"CA","postalCode":"94105","country":"US"}}}`)
+	conforms(t, s, "createRecipient", rcp)
+	rcpID := rcp["id"].(string)
+	if got := get(t, api+"/recipient/"+rcpID); got["name"] != "Acme Corp" || got["defaultPaymentMethod"] != "ach" {
+		t.Fatalf("created recipient not fetchable: %v", got)
+	}
+	if n := len(get(t, api+"/recipients")["recipients"].([]any)); n != 1 {
+		t.Fatalf("got %d recipients, want 1", n)
+	}
+
+	send := func(amount, key string) map[string]any {
+		return call(t, http.MethodPost, api+"/account/"+checking+"/transactions",
+			`{"recipientId":"`+rcpID+`","amount":`+amount+`,"paymentMethod":"ach","idempotencyKey":"`+key+`"}`)
+	}
+	paid := send("1500", "k1")
+	conforms(t, s, "createTransaction", paid)
+	if paid["status"] != "pending" || paid["amount"] != -1500.0 || paid["counterpartyName"] != "Acme Corp" {
+		t.Fatalf("unexpected payment: %v", paid)
+	}
+	if again := send("1500", "k1"); again["id"] != paid["id"] {
+		t.Fatalf("idempotency key not honored: %v vs %v", again["id"], paid["id"])
+	}
+	failing := send("10.13", "k2")
+
+	acct := get(t, api+"/account/"+checking)
+	if acct["availableBalance"] != 98489.87 || acct["currentBalance"] != 100000.0 {
+		t.Fatalf("pending payments should only hold funds: %v / %v", acct["availableBalance"], acct["currentBalance"])
+	}
+
+	// A day later the payment has gone out and the failed one released its hold.
+	now = now.Add(25 * time.Hour)
+	tx := get(t, api+"/account/"+checking+"/transaction/"+paid["id"].(string))
+	conforms(t, s, "getTransaction", tx)
+	if tx["status"] != "sent" || tx["postedAt"] == nil {
+		t.Fatalf("payment not settled: %v", tx)
+	}
+	if tx := get(t, api+"/transaction/"+failing["id"].(string)); tx["status"] != "failed" || tx["reasonForFailure"] == nil {
+		t.Fatalf("payment ending in .13 should fail: %v", tx)
+	}
+	acct = get(t, api+"/account/"+checking)
+	if acct["availableBalance"] != 98500.0 || acct["currentBalance"] != 98500.0 {
+		t.Fatalf("unexpected balances after settlement: %v / %v", acct["availableBalance"], acct["currentBalance"])
+	}
+
+	transfer := call(t, http.MethodPost, api+"/transfer",
+		`{"sourceAccountId":"`+savings+`","destinationAccountId":"`+checking+`","amount":500,"idempotencyKey":"k3"}`)
+	conforms(t, s, "createInternalTransfer", transfer)
+	if acct = get(t, api+"/account/"+checking); acct["currentBalance"] != 99000.0 {
+		t.Fatalf("transfer not booked: %v", acct["currentBalance"])
+	}
+
+	list := get(t, api+"/account/"+checking+"/transactions?status=sent")
+	conforms(t, s, "listAccountTransactions", list)
+	if list["total"] != 2.0 {
+		t.Fatalf("expected the payment and the transfer credit, got %v", list)
+	}
+	all := get(t, api+"/transactions?limit=2")
+	conforms(t, s, "listTransactions", all)
+	if next := all["page"].(map[string]any)["nextPage"]; next == nil {
+		t.Fatalf("expected a second page of 4 transactions: %v", all)
+	}
+
+	if code, msg := status(t, http.MethodPost, api+"/account/"+checking+"/transactions",
+		`{"recipientId":"`+rcpID+`","amount":1000000,"paymentMethod":"ach","idempotencyKey":"k4"}`); code != 400 || !strings.Contains(msg, "insufficient funds") {
+		t.Fatalf("expected insufficient funds, got %d %q", code, msg)
+	}
+	if code, _ := status(t, http.MethodGet, api+"/recipient/"+openapi.ExampleUUID("nope"), ""); code != 404 {
+		t.Fatalf("expected 404 for an unknown recipient, got %d", code)
+	}
+
+	// The state file survives a restart, clock included.
+	srv2, _ := newStatefulServer(t, Options{StateFile: statePath, now: func() time.Time { return now }})
+	if got := get(t, srv2.URL+"/api/v1/recipient/"+rcpID); got["name"] != "Acme Corp" {
+		t.Fatalf("recipient not persisted: %v", got)
+	}
+	if acct = get(t, srv2.URL+"/api/v1/account/"+checking); acct["currentBalance"] != 99000.0 {
+		t.Fatalf("balance not persisted: %v", acct["currentBalance"])
+	}
+}
+
+func TestStatefulClockControl(t *testing.T) {
+	srv, s := newStatefulServer(t, Options{})
+	api := srv.URL + "/api/v1"
+	checking := get(t, api+"/accounts")["accounts"].([]any)[0].(map[string]any)["id"].(string)
+	rcp := call(t, http.MethodPost, api+"/recipients", `{"name":"Acme","emails":[]}`)
+	tx := call(t, http.MethodPost, api+"/account/"+checking+"/transactions",
+		`{"recipientId":"`+rcp["id"].(string)+`","amount":25,"paymentMethod":"ach","idempotencyKey":"k"}`)
+
+	start := s.State().Now()
+	adv := call(t, http.MethodPost, api+"/_mock/clock/advance?by=2d", "")
+	if at, _ := time.Parse(time.RFC3339, adv["now"].(string)); at.Sub(start) < 48*time.Hour {
+		t.Fatalf("clock not advanced: %v -> %v", start, at)
+	}
+	if got := get(t, api+"/transaction/"+tx["id"].(string)); got["status"] != "sent" {
+		t.Fatalf("payment not settled after advancing the clock: %v", got["status"])
+	}
+	if st := get(t, srv.URL+"/_mock/state"); len(st["transactions"].([]any)) != 1 {
+		t.Fatalf("unexpected state: %v", st)
+	}
+}
@@ -0,0 +1,98 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CallbackPath is where the loopback listener receives the authorization response.
+const CallbackPath = "/callback"
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// Login runs the authorization-code flow with PKCE. It listens on
+// 127.0.0.1:port (0 picks a free port), sets c.RedirectURL accordingly, calls open
+// with the authorization URL, waits for the redirect and exchanges the code.
+func (c *Config) Login(ctx context.Context, port int, open func(authURL string) error) (*Token, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("oauth: start redirect listener: %w", err)
+	}
+	defer ln.Close()
+	c.RedirectURL = "http://" + ln.Addr().String() + CallbackPath
+
+	pkce, err := NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	authURL, err := c.AuthCodeURL(state, pkce.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(CallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		res := readCallback(r, state)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if res.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<p>Authorization failed: %s</p>", html.EscapeString(res.err.Error()))
+		} else {
+			fmt.Fprint(w, "<p>Authorization complete. You can close this window and return to the terminal.</p>")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	if err := open(authURL); err != nil {
+		return nil, err
+	}
+
+	var res callbackResult
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("oauth: waiting for authorization: %w", ctx.Err())
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	return c.Exchange(ctx, res.code, pkce.Verifier)
+}
+
+func readCallback(r *http.Request, wantState string) callbackResult {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		if d := q.Get("error_description"); d != "" {
+			return callbackResult{err: fmt.Errorf("oauth: authorization denied: %s: %s", e, d)}
+		}
+		return callbackResult{err: fmt.Errorf("oauth: authorization denied: %s", e)}
+	}
+	if q.Get("state") != wantState {
+		return callbackResult{err: errors.New("oauth: state mismatch in redirect")}
+	}
+	code := q.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("oauth: redirect has no authorization code")}
+	}
+	return callbackResult{code: code}
+}
@@ -0,0 +1,205 @@
+// Package oauth implements the OAuth2 authorization-code flow with PKCE against
+// Mercury's OAuth2 server, using a loopback redirect for the CLI.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config describes an OAuth2 client and the authorization server endpoints.
+type Config struct {
+	ClientID string
+	// ClientSecret is optional; public PKCE clients leave it empty.
+	ClientSecret string
+
+	AuthURL  string
+	TokenURL string
+
+	// RedirectURL is set by Login to the loopback listener address.
+	RedirectURL string
+	Scopes      []string
+
+	// HTTPClient is used for token requests. nil means a client with a 30s timeout.
+	HTTPClient *http.Client
+}
+
+// Token is a token endpoint response.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	Scope        string
+	// Expiry is zero when the server did not send expires_in.
+	Expiry time.Time
+}
+
+// PKCE holds a code verifier and its S256 challenge (RFC 7636).
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE returns a fresh random verifier and its challenge.
+func NewPKCE() (PKCE, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return PKCE{}, err
+	}
+	v := base64.RawURLEncoding.EncodeToString(b)
+	return PKCE{Verifier: v, Challenge: S256Challenge(v)}, nil
+}
+
+// S256Challenge returns BASE64URL(SHA256(verifier)).
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL the user visits to approve the client.
+func (c *Config) AuthCodeURL(state string, challenge string) (string, error) {
+	u, err := url.Parse(c.AuthURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.ClientID)
+	q.Set("redirect_uri", c.RedirectURL)
+	if len(c.Scopes) > 0 {
+		q.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	q.Set("state", state)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for a token.
+func (c *Config) Exchange(ctx context.Context, code string, verifier string) (*Token, error) {
+	return c.tokenRequest(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"code_verifier": {verifier},
+	})
+}
+
+// Refresh obtains a new access token. The returned token keeps refreshToken when
+// the server does not rotate it.
+func (c *Config) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	tok, err := c.tokenRequest(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refreshToken
+	}
+	return tok, nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	Scope            string `json:"scope"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *Config) tokenRequest(ctx context.Context, form url.Values) (*Token, error) {
+	if c.TokenURL == "" {
+		return nil, errors.New("oauth: token URL not set")
+	}
+	// The token endpoint authenticates clients with HTTP Basic; public clients
+	// identify themselves with client_id in the form instead.
+	if c.ClientSecret == "" {
+		form.Set("client_id", c.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oauth: token request: %w", err)
+	}
+
+	var tr tokenResponse
+	jsonErr := json.Unmarshal(body, &tr)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		switch {
+		case jsonErr == nil && tr.Error != "" && tr.ErrorDescription != "":
+			return nil, fmt.Errorf("oauth: token endpoint returned HTTP %d: %s: %s", resp.StatusCode, tr.Error, tr.ErrorDescription)
+		case jsonErr == nil && tr.Error != "":
+			return nil, fmt.Errorf("oauth: token endpoint returned HTTP %d: %s", resp.StatusCode, tr.Error)
+		default:
+			return nil, fmt.Errorf("oauth: token endpoint returned HTTP %d", resp.StatusCode)
+		}
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("oauth: decode token response: %w", jsonErr)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("oauth: token response has no access_token")
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return nil, fmt.Errorf("oauth: unsupported token_type %q", tr.TokenType)
+	}
+
+	tok := &Token{
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		TokenType:    tr.TokenType,
+		Scope:        tr.Scope,
+	}
+	if tr.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+// Expired reports whether a token with the given expiry should be refreshed
+// before use. A zero expiry never expires.
+func Expired(expiry time.Time) bool {
+	return !expiry.IsZero() && time.Now().Add(30*time.Second).After(expiry)
+}
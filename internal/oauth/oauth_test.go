@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is a minimal authorization server that enforces PKCE.
+type fakeServer struct {
+	mu         sync.Mutex
+	challenges map[string]string // code -> code_challenge
+	redirects  map[string]string // code -> redirect_uri
+	refreshed  int
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	t.Helper()
+	f := &fakeServer{challenges: map[string]string{}, redirects: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/auth", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("response_type") != "code" || q.Get("client_id") != "cli" || q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.challenges["code-1"] = q.Get("code_challenge")
+		f.redirects["code-1"] = q.Get("redirect_uri")
+		f.mu.Unlock()
+		u, _ := url.Parse(q.Get("redirect_uri"))
+		u.RawQuery = url.Values{"code": {"code-1"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			code := r.PostForm.Get("code")
+			if S256Challenge(r.PostForm.Get("code_verifier")) != f.challenges[code] || r.PostForm.Get("redirect_uri") != f.redirects[code] {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "access-1", "refresh_token": "refresh-1", "token_type": "Bearer", "expires_in": 3600})
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			f.refreshed++
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "access-2", "token_type": "bearer", "expires_in": 3600})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func TestLoginAndRefresh(t *testing.T) {
+	f, srv := newFakeServer(t)
+	cfg := &Config{
+		ClientID: "cli",
+		AuthURL:  srv.URL + "/oauth2/auth",
+		TokenURL: srv.URL + "/oauth2/token",
+		Scopes:   []string{"read", "offline_access"},
+	}
+
+	var visited string
+	browser := func(u string) error {
+		visited = u
+		resp, err := http.Get(u)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tok, err := cfg.Login(ctx, 0, browser)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if tok.AccessToken != "access-1" || tok.RefreshToken != "refresh-1" {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+	if tok.Expiry.Before(time.Now().Add(59 * time.Minute)) {
+		t.Fatalf("unexpected expiry %v", tok.Expiry)
+	}
+	if !strings.Contains(visited, "scope=read+offline_access") || !strings.HasPrefix(cfg.RedirectURL, "http://127.0.0.1:") {
+		t.Fatalf("unexpected auth URL %q / redirect %q", visited, cfg.RedirectURL)
+	}
+
+	tok, err = cfg.Refresh(ctx, tok.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if tok.AccessToken != "access-2" || tok.RefreshToken != "refresh-1" || f.refreshed != 1 {
+		t.Fatalf("unexpected refreshed token: %+v (refreshed=%d)", tok, f.refreshed)
+	}
+
+	if _, err := cfg.Refresh(ctx, "revoked"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expected invalid_grant error, got %v", err)
+	}
+}
+
+func TestLoginRejectsStateMismatch(t *testing.T) {
+	_, srv := newFakeServer(t)
+	cfg := &Config{ClientID: "cli", AuthURL: srv.URL + "/oauth2/auth", TokenURL: srv.URL + "/oauth2/token"}
+	browser := func(string) error {
+		resp, err := http.Get(cfg.RedirectURL + "?code=x&state=forged")
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := cfg.Login(ctx, 0, browser); err == nil || !strings.Contains(err.Error(), "state mismatch") {
+		t.Fatalf("expected state mismatch, got %v", err)
+	}
+}
+
+func TestS256Challenge(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	got := S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("S256Challenge = %q", got)
+	}
+}
@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxExampleDepth bounds how deep Example expands nested and recursive schemas.
+const maxExampleDepth = 8
+
+// Example synthesizes a value for schema, preferring the schema's own example,
+// then its default, then the first enum value, and otherwise building one from
+// the type, format and bounds. IDs (uuid formats and properties named id or
+// ending in Id) are derived from seed and their position in the document, so the
+// same seed always yields the same value and different seeds yield different IDs.
+// Values use the types encoding/json decodes into, so numbers are float64.
+func (s *Spec) Example(schema *Schema, seed string) any {
+	return s.example(schema, seed, "", "", 0)
+}
+
+func (s *Spec) example(schema *Schema, seed, path, name string, depth int) any {
+	if schema == nil || depth > maxExampleDepth {
+		return nil
+	}
+	schema = s.FlattenSchema(schema)
+	if schema == nil || schema.Ref != "" {
+		return nil
+	}
+
+	switch {
+	case schema.Example != nil:
+		return copyJSON(schema.Example)
+	case schema.Default != nil:
+		return copyJSON(schema.Default)
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	case len(schema.OneOf) > 0:
+		return s.example(schema.OneOf[0], seed, path, name, depth+1)
+	case len(schema.AnyOf) > 0:
+		return s.example(schema.AnyOf[0], seed, path, name, depth+1)
+	}
+
+	typ := strings.ToLower(schema.Type)
+	if typ == "" && len(schema.Properties) > 0 {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		obj := map[string]any{}
+		for _, k := range schema.PropertyNames() {
+			prop := schema.Properties[k]
+			obj[k] = s.example(&prop, seed, path+"/"+k, k, depth+1)
+		}
+		return obj
+	case "array":
+		n := 1
+		if schema.MinItems != nil && *schema.MinItems > n {
+			n = *schema.MinItems
+		}
+		if schema.MaxItems != nil && *schema.MaxItems < n {
+			n = *schema.MaxItems
+		}
+		// Recursive trees (ledger children and the like) end in an empty
+		// array rather than items whose fields were cut off by the depth limit.
+		if depth+2 > maxExampleDepth {
+			n = 0
+		}
+		items := make([]any, 0, n)
+		for i := 0; i < n && schema.Items != nil; i++ {
+			if v := s.example(schema.Items, seed, path+"/"+strconv.Itoa(i), name, depth+1); v != nil {
+				items = append(items, v)
+			}
+		}
+		return items
+	case "string":
+		return exampleString(schema, seed, path, name)
+	case "integer":
+		return exampleNumber(schema, 1)
+	case "number":
+		return exampleNumber(schema, 100)
+	case "boolean":
+		return true
+	}
+	return nil
+}
+
+func exampleString(schema *Schema, seed, path, name string) string {
+	lower := strings.ToLower(name)
+	var v string
+	switch format := strings.ToLower(schema.Format); {
+	case format == "uuid" || lower == "id" || strings.HasSuffix(name, "Id") || strings.HasSuffix(lower, "_id"):
+		v = ExampleUUID(seed + path)
+	case format == "date":
+		v = "2024-01-15"
+	case format == "date-time" || strings.HasPrefix(format, "yyyy-mm-ddt"):
+		v = "2024-01-15T12:00:00Z"
+	case format == "email" || strings.Contains(lower, "email"):
+		v = "user@example.com"
+	case format == "uri" || format == "url" || strings.HasSuffix(lower, "url") || strings.HasSuffix(lower, "link"):
+		v = "https://example.com/" + strings.Trim(path, "/")
+	case format == "binary" || format == "byte":
+		v = ""
+	case name != "":
+		v = "Example " + name
+	default:
+		v = "example"
+	}
+	if schema.MaxLength != nil && len(v) > *schema.MaxLength {
+		v = v[:*schema.MaxLength]
+	}
+	if schema.MinLength != nil && len(v) < *schema.MinLength {
+		v += strings.Repeat("x", *schema.MinLength-len(v))
+	}
+	return v
+}
+
+// exampleNumber returns def moved into [minimum, maximum] and rounded to multipleOf.
+func exampleNumber(schema *Schema, def float64) float64 {
+	v := def
+	if schema.Minimum != nil && v < *schema.Minimum {
+		v = *schema.Minimum
+	}
+	if schema.Maximum != nil && v > *schema.Maximum {
+		v = *schema.Maximum
+	}
+	if m := schema.MultipleOf; m != nil && *m > 0 {
+		v = math.Ceil(v / *m) * *m
+		v = math.Round(v*1e9) / 1e9
+	}
+	return v
+}
+
+// ExampleUUID returns a deterministic version 4 style UUID derived from seed.
+func ExampleUUID(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	b := sum[:16]
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// copyJSON deep-copies a decoded JSON value so callers may modify examples.
+func copyJSON(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package openapi
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Synthesized examples must validate against the schemas they come from.
+func TestExampleValidatesForEmbeddedResponses(t *testing.T) {
+	docs, err := LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := 0
+	for _, doc := range docs {
+		paths := make([]string, 0, len(doc.Spec.Paths))
+		for p := range doc.Spec.Paths {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			item := doc.Spec.Paths[p]
+			for method, op := range item.Operations() {
+				for status := range op.Responses {
+					if !strings.HasPrefix(status, "2") {
+						continue
+					}
+					resp, err := doc.Spec.OperationResponse(op, status)
+					if err != nil || resp == nil {
+						continue
+					}
+					for ct, mt := range resp.Content {
+						if !strings.HasPrefix(ct, "application/json") || mt.Schema == nil {
+							continue
+						}
+						v := doc.Spec.Example(mt.Schema, "seed")
+						if errs := doc.Spec.Validate(mt.Schema, v); len(errs) > 0 {
+							t.Errorf("%s %s %s: example does not validate:\n%v", method, p, status, errs)
+						}
+						checked++
+					}
+				}
+			}
+		}
+	}
+	if checked < 50 {
+		t.Fatalf("only %d response schemas checked", checked)
+	}
+}
+
+func TestExampleSeeds(t *testing.T) {
+	minAmount := 250.0
+	spec := &Spec{}
+	schema := &Schema{Type: "object", Properties: map[string]Schema{
+		"id":        {Type: "string"},
+		"accountId": {Type: "string"},
+		"kind":      {Type: "string", Enum: []any{"checking", "savings"}},
+		"amount":    {Type: "number", Minimum: &minAmount},
+		"postedAt":  {Type: "string", Format: "date-time"},
+	}}
+	a := spec.Example(schema, "a").(map[string]any)
+	b := spec.Example(schema, "b").(map[string]any)
+	if a["id"] == b["id"] || a["id"] == a["accountId"] {
+		t.Fatalf("IDs not distinct per seed and field: %v %v", a, b)
+	}
+	if again := spec.Example(schema, "a").(map[string]any); again["id"] != a["id"] {
+		t.Fatalf("IDs not deterministic: %v vs %v", again["id"], a["id"])
+	}
+	if a["kind"] != "checking" || a["amount"] != 250.0 || a["postedAt"] != "2024-01-15T12:00:00Z" {
+		t.Fatalf("unexpected example: %v", a)
+	}
+}
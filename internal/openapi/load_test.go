@@ -1,6 +1,10 @@
 package openapi
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func TestLoadEmbeddedSpecs(t *testing.T) {
 	docs, err := LoadEmbeddedSpecs()
@@ -22,3 +26,22 @@ func TestLoadEmbeddedSpecs(t *testing.T) {
 		}
 	}
 }
+
+func TestSchemaPropertyOrder(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(`{"type":"object","properties":{"zeta":{"type":"string"},"alpha":{"type":"object","properties":{"b":{},"a":{}}},"mid":{}}}`), &s); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.PropertyNames(), ","); got != "zeta,alpha,mid" {
+		t.Fatalf("PropertyNames = %s", got)
+	}
+	alpha := s.Properties["alpha"]
+	if got := strings.Join(alpha.PropertyNames(), ","); got != "b,a" {
+		t.Fatalf("nested PropertyNames = %s", got)
+	}
+
+	built := &Schema{Properties: map[string]Schema{"b": {}, "a": {}}, PropertyOrder: []string{"b"}}
+	if got := strings.Join(built.PropertyNames(), ","); got != "b,a" {
+		t.Fatalf("PropertyNames with partial order = %s", got)
+	}
+}
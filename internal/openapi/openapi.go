@@ -1,5 +1,11 @@
 package openapi
 
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
 type SpecDoc struct {
 	// Name is a stable identifier derived from the embedded filename (no extension).
 	Name string
@@ -38,8 +44,12 @@ type Server struct {
 }
 
 type Components struct {
-	Schemas         map[string]Schema `json:"schemas,omitempty"`
-	SecuritySchemes map[string]any    `json:"securitySchemes,omitempty"`
+	Schemas         map[string]Schema      `json:"schemas,omitempty"`
+	Parameters      map[string]Parameter   `json:"parameters,omitempty"`
+	RequestBodies   map[string]RequestBody `json:"requestBodies,omitempty"`
+	Responses       map[string]Response    `json:"responses,omitempty"`
+	Headers         map[string]Header      `json:"headers,omitempty"`
+	SecuritySchemes map[string]any         `json:"securitySchemes,omitempty"`
 }
 
 type PathItem struct {
@@ -86,9 +96,18 @@ type RequestBody struct {
 type Response struct {
 	Ref         string               `json:"$ref,omitempty"`
 	Description string               `json:"description,omitempty"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
 	Content     map[string]MediaType `json:"content,omitempty"`
 }
 
+type Header struct {
+	Ref         string `json:"$ref,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+
+	Schema *Schema `json:"schema,omitempty"`
+}
+
 type MediaType struct {
 	Schema *Schema `json:"schema,omitempty"`
 }
@@ -102,10 +121,76 @@ type Schema struct {
 	Default     any               `json:"default,omitempty"`
 	Example     any               `json:"example,omitempty"`
 	Enum        []any             `json:"enum,omitempty"`
+	Minimum     *float64          `json:"minimum,omitempty"`
+	Maximum     *float64          `json:"maximum,omitempty"`
+	MultipleOf  *float64          `json:"multipleOf,omitempty"`
+	MinLength   *int              `json:"minLength,omitempty"`
+	MaxLength   *int              `json:"maxLength,omitempty"`
+	MinItems    *int              `json:"minItems,omitempty"`
+	MaxItems    *int              `json:"maxItems,omitempty"`
 	Items       *Schema           `json:"items,omitempty"`
 	Properties  map[string]Schema `json:"properties,omitempty"`
 	Required    []string          `json:"required,omitempty"`
 	AllOf       []*Schema         `json:"allOf,omitempty"`
 	AnyOf       []*Schema         `json:"anyOf,omitempty"`
 	OneOf       []*Schema         `json:"oneOf,omitempty"`
+
+	// PropertyOrder lists the Properties keys in document order.
+	PropertyOrder []string `json:"-"`
+}
+
+// UnmarshalJSON decodes a schema and records the document order of its properties.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	type plain Schema
+	if err := json.Unmarshal(b, (*plain)(s)); err != nil {
+		return err
+	}
+	var raw struct {
+		Properties json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil || len(raw.Properties) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw.Properties))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if k, ok := t.(string); ok {
+			s.PropertyOrder = append(s.PropertyOrder, k)
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// PropertyNames returns the property names in document order. Properties missing
+// from PropertyOrder (e.g. on schemas built in code) follow in name order.
+func (s *Schema) PropertyNames() []string {
+	if s == nil || len(s.Properties) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(s.Properties))
+	seen := map[string]bool{}
+	for _, k := range s.PropertyOrder {
+		if _, ok := s.Properties[k]; ok && !seen[k] {
+			out = append(out, k)
+			seen[k] = true
+		}
+	}
+	var rest []string
+	for k := range s.Properties {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(out, rest...)
 }
@@ -0,0 +1,107 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	refPrefixSchemas       = "#/components/schemas/"
+	refPrefixParameters    = "#/components/parameters/"
+	refPrefixRequestBodies = "#/components/requestBodies/"
+	refPrefixResponses     = "#/components/responses/"
+	refPrefixHeaders       = "#/components/headers/"
+)
+
+var refTokenUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// refName returns the component name referenced by ref when it points into the
+// component section identified by prefix. JSON pointer escapes are decoded.
+func refName(ref string, prefix string) (string, bool) {
+	if !strings.HasPrefix(ref, prefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(ref, prefix)
+	if name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return refTokenUnescaper.Replace(name), true
+}
+
+// resolveRef follows a chain of local $refs into table until it reaches a
+// concrete value. Cycles and dangling refs are reported as errors. The returned
+// value is a copy so callers can mutate it safely.
+func resolveRef[T any](v *T, refOf func(*T) string, prefix string, table map[string]T) (*T, error) {
+	seen := map[string]bool{}
+	for v != nil {
+		ref := refOf(v)
+		if ref == "" {
+			return v, nil
+		}
+		if seen[ref] {
+			return nil, fmt.Errorf("cyclic $ref %q", ref)
+		}
+		seen[ref] = true
+
+		name, ok := refName(ref, prefix)
+		if !ok {
+			return nil, fmt.Errorf("unsupported $ref %q (expected %s<name>)", ref, prefix)
+		}
+		target, ok := table[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", ref)
+		}
+		cp := target
+		v = &cp
+	}
+	return nil, nil
+}
+
+// ResolveParameter returns p with any #/components/parameters $ref chain expanded.
+func (s *Spec) ResolveParameter(p *Parameter) (*Parameter, error) {
+	return resolveRef(p, func(p *Parameter) string { return p.Ref }, refPrefixParameters, s.Components.Parameters)
+}
+
+// ResolveRequestBody returns rb with any #/components/requestBodies $ref chain expanded.
+func (s *Spec) ResolveRequestBody(rb *RequestBody) (*RequestBody, error) {
+	return resolveRef(rb, func(rb *RequestBody) string { return rb.Ref }, refPrefixRequestBodies, s.Components.RequestBodies)
+}
+
+// ResolveResponse returns r with any #/components/responses $ref chain expanded.
+func (s *Spec) ResolveResponse(r *Response) (*Response, error) {
+	return resolveRef(r, func(r *Response) string { return r.Ref }, refPrefixResponses, s.Components.Responses)
+}
+
+// ResolveHeader returns h with any #/components/headers $ref chain expanded.
+func (s *Spec) ResolveHeader(h *Header) (*Header, error) {
+	return resolveRef(h, func(h *Header) string { return h.Ref }, refPrefixHeaders, s.Components.Headers)
+}
+
+// OperationParameters returns op's parameters with all $refs resolved, in declaration order.
+func (s *Spec) OperationParameters(op *Operation) ([]Parameter, error) {
+	if op == nil {
+		return nil, nil
+	}
+	out := make([]Parameter, 0, len(op.Parameters))
+	for i := range op.Parameters {
+		p, err := s.ResolveParameter(&op.Parameters[i])
+		if err != nil {
+			return nil, fmt.Errorf("parameter %d: %w", i, err)
+		}
+		out = append(out, *p)
+	}
+	return out, nil
+}
+
+// OperationResponse returns the resolved response for statusCode, or nil if the
+// operation does not declare one.
+func (s *Spec) OperationResponse(op *Operation, statusCode string) (*Response, error) {
+	if op == nil {
+		return nil, nil
+	}
+	resp, ok := op.Responses[statusCode]
+	if !ok {
+		return nil, nil
+	}
+	return s.ResolveResponse(&resp)
+}
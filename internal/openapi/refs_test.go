@@ -0,0 +1,114 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadFixtureSpec(t *testing.T, name string) *Spec {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec Spec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	return &spec
+}
+
+func TestOperationParametersResolvesRefs(t *testing.T) {
+	spec := loadFixtureSpec(t, "refs.json")
+	params, err := spec.OperationParameters(spec.Paths["/widgets"].Get)
+	if err != nil {
+		t.Fatalf("OperationParameters: %v", err)
+	}
+	var names []string
+	for _, p := range params {
+		if p.Ref != "" {
+			t.Fatalf("parameter still has $ref: %+v", p)
+		}
+		names = append(names, p.In+":"+p.Name)
+	}
+	if got, want := strings.Join(names, ","), "query:limit,query:start_after,query:order"; got != want {
+		t.Fatalf("params = %s, want %s", got, want)
+	}
+	if params[0].Description != "Page size" {
+		t.Fatalf("unexpected limit description %q", params[0].Description)
+	}
+}
+
+func TestResolveParameterCycle(t *testing.T) {
+	spec := loadFixtureSpec(t, "refs.json")
+	_, err := spec.ResolveParameter(&Parameter{Ref: "#/components/parameters/LoopA"})
+	if err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Fatalf("expected cyclic $ref error, got %v", err)
+	}
+}
+
+func TestResolveParameterErrors(t *testing.T) {
+	spec := loadFixtureSpec(t, "refs.json")
+	if _, err := spec.ResolveParameter(&Parameter{Ref: "#/components/parameters/Missing"}); err == nil {
+		t.Fatalf("expected error for dangling $ref")
+	}
+	if _, err := spec.ResolveParameter(&Parameter{Ref: "other.json#/components/parameters/Limit"}); err == nil {
+		t.Fatalf("expected error for external $ref")
+	}
+}
+
+func TestResolveRequestBody(t *testing.T) {
+	spec := loadFixtureSpec(t, "refs.json")
+	rb, err := spec.ResolveRequestBody(spec.Paths["/widgets"].Post.RequestBody)
+	if err != nil {
+		t.Fatalf("ResolveRequestBody: %v", err)
+	}
+	if !rb.Required {
+		t.Fatalf("expected resolved request body to be required")
+	}
+	mt, ok := rb.Content["application/json;charset=utf-8"]
+	if !ok || mt.Schema == nil || mt.Schema.Ref != "#/components/schemas/Widget" {
+		t.Fatalf("unexpected request body content: %+v", rb.Content)
+	}
+}
+
+func TestOperationResponseAndHeaders(t *testing.T) {
+	spec := loadFixtureSpec(t, "refs.json")
+	op := spec.Paths["/widgets"].Get
+
+	resp, err := spec.OperationResponse(op, "200")
+	if err != nil {
+		t.Fatalf("OperationResponse: %v", err)
+	}
+	if resp == nil || resp.Description != "A page of widgets" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	h := resp.Headers["X-Request-Id"]
+	rh, err := spec.ResolveHeader(&h)
+	if err != nil {
+		t.Fatalf("ResolveHeader: %v", err)
+	}
+	if rh.Description != "Request correlation ID" || rh.Schema == nil || rh.Schema.Type != "string" {
+		t.Fatalf("unexpected header: %+v", rh)
+	}
+
+	if resp, err := spec.OperationResponse(op, "404"); err != nil || resp != nil {
+		t.Fatalf("expected nil response for undeclared status, got %+v, %v", resp, err)
+	}
+}
+
+func TestSchemaRefJSONPointerEscapes(t *testing.T) {
+	spec := loadFixtureSpec(t, "refs.json")
+	resp, err := spec.OperationResponse(spec.Paths["/widgets"].Get, "200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := resp.Content["application/json"].Schema.Properties["page"]
+	s := spec.DerefSchema(&page)
+	if _, ok := s.Properties["nextPage"]; !ok {
+		t.Fatalf("expected escaped schema ref to resolve, got %+v", s)
+	}
+}
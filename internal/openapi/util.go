@@ -1,9 +1,5 @@
 package openapi
 
-import (
-	"strings"
-)
-
 func (pi *PathItem) Operations() map[string]*Operation {
 	out := map[string]*Operation{}
 	if pi.Get != nil {
@@ -49,11 +45,7 @@ func (s *Spec) OperationRequiresAuth(op *Operation) bool {
 }
 
 func refSchemaName(ref string) (string, bool) {
-	const prefix = "#/components/schemas/"
-	if !strings.HasPrefix(ref, prefix) {
-		return "", false
-	}
-	return strings.TrimPrefix(ref, prefix), true
+	return refName(ref, refPrefixSchemas)
 }
 
 func (s *Spec) ResolveSchemaRef(ref string) (*Schema, bool) {
@@ -116,22 +108,40 @@ func (s *Spec) flattenSchema(schema *Schema, seen map[string]bool) *Schema {
 			Type:       "object",
 			Properties: map[string]Schema{},
 		}
+		var last *Schema
 		for _, sub := range schema.AllOf {
 			subF := s.flattenSchema(sub, seen)
 			if subF == nil {
 				continue
 			}
+			last = subF
 			if subF.Type != "" && merged.Type == "" {
 				merged.Type = subF.Type
 			}
-			for k, v := range subF.Properties {
-				merged.Properties[k] = v
+			for _, k := range subF.PropertyNames() {
+				if _, dup := merged.Properties[k]; !dup {
+					merged.PropertyOrder = append(merged.PropertyOrder, k)
+				}
+				merged.Properties[k] = subF.Properties[k]
 			}
+			merged.Required = append(merged.Required, subF.Required...)
 		}
 		if len(merged.Properties) == 0 {
+			// A single-element allOf is commonly used to attach a description to a $ref
+			// (e.g. {"allOf":[{"$ref":"#/components/schemas/Email"}],"description":"..."}).
+			if len(schema.AllOf) == 1 && last != nil {
+				cp := *last
+				if schema.Description != "" {
+					cp.Description = schema.Description
+				}
+				cp.Nullable = cp.Nullable || schema.Nullable
+				return &cp
+			}
 			// Fall back to the original schema if we couldn't merge anything useful.
 			return schema
 		}
+		merged.Description = schema.Description
+		merged.Nullable = schema.Nullable
 		return merged
 	}
 
@@ -0,0 +1,305 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxValidateDepth guards against unbounded recursion through self-referencing schemas.
+const maxValidateDepth = 64
+
+// ValidationError is a single schema violation. Path is a JSON pointer into the
+// validated document ("" is the document root).
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + e.Message
+}
+
+// ValidationErrors collects every violation found in a document.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, v := range e {
+		lines = append(lines, v.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json into any)
+// against schema using the JSON Schema subset OpenAPI 3.0 specs rely on: type,
+// nullable, required, properties, items, enum, allOf/anyOf/oneOf, minimum/maximum,
+// multipleOf, min/max length and items, and the date, date-time, uuid and email
+// formats. Unknown formats and properties not described by the schema are accepted.
+func (s *Spec) Validate(schema *Schema, v any) ValidationErrors {
+	var errs ValidationErrors
+	s.validate(schema, v, "", 0, &errs)
+	return errs
+}
+
+func (s *Spec) validate(schema *Schema, v any, path string, depth int, errs *ValidationErrors) {
+	if schema == nil || depth > maxValidateDepth {
+		return
+	}
+	schema = s.derefSchema(schema, map[string]bool{})
+	if schema.Ref != "" {
+		// Unresolvable or cyclic; nothing more we can check.
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if v == nil {
+		if schema.Nullable || enumContains(schema.Enum, nil) {
+			return
+		}
+		if schema.Type != "" {
+			fail("must not be null")
+			return
+		}
+	}
+
+	for _, sub := range schema.AllOf {
+		s.validate(sub, v, path, depth+1, errs)
+	}
+	if len(schema.AnyOf) > 0 {
+		if matched, best := s.matchBranches(schema.AnyOf, v, path, depth); matched == 0 {
+			*errs = append(*errs, best...)
+		}
+	}
+	if len(schema.OneOf) > 0 {
+		matched, best := s.matchBranches(schema.OneOf, v, path, depth)
+		switch {
+		case matched == 0:
+			*errs = append(*errs, best...)
+		case matched > 1:
+			fail("matches %d oneOf schemas, expected exactly one", matched)
+		}
+	}
+
+	if v == nil {
+		return
+	}
+
+	typ := strings.ToLower(schema.Type)
+	if typ == "" && len(schema.Properties) > 0 {
+		if _, ok := v.(map[string]any); ok {
+			typ = "object"
+		}
+	}
+	if typ != "" && !jsonTypeMatches(typ, v) {
+		fail("expected %s, got %s", typ, jsonTypeName(v))
+		return
+	}
+
+	if len(schema.Enum) > 0 && !enumContains(schema.Enum, v) {
+		fail("value %s is not one of: %s", formatJSONValue(v), formatEnum(schema.Enum))
+	}
+
+	switch t := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(t)
+		if schema.MinLength != nil && n < *schema.MinLength {
+			fail("length must be >= %d", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && n > *schema.MaxLength {
+			fail("length must be <= %d", *schema.MaxLength)
+		}
+		if msg := checkFormat(schema.Format, t); msg != "" {
+			fail("%s", msg)
+		}
+	case float64:
+		if schema.Minimum != nil && t < *schema.Minimum {
+			fail("must be >= %s", formatNumber(*schema.Minimum))
+		}
+		if schema.Maximum != nil && t > *schema.Maximum {
+			fail("must be <= %s", formatNumber(*schema.Maximum))
+		}
+		if schema.MultipleOf != nil && *schema.MultipleOf > 0 && !isMultipleOf(t, *schema.MultipleOf) {
+			fail("must be a multiple of %s", formatNumber(*schema.MultipleOf))
+		}
+	case []any:
+		if schema.MinItems != nil && len(t) < *schema.MinItems {
+			fail("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(t) > *schema.MaxItems {
+			fail("must have at most %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for i, item := range t {
+				s.validate(schema.Items, item, path+"/"+strconv.Itoa(i), depth+1, errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := t[name]; !ok {
+				*errs = append(*errs, ValidationError{Path: path + "/" + escapePointer(name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pv, ok := t[name]
+			if !ok {
+				continue
+			}
+			prop := schema.Properties[name]
+			s.validate(&prop, pv, path+"/"+escapePointer(name), depth+1, errs)
+		}
+	}
+}
+
+// matchBranches validates v against each branch and returns how many matched,
+// plus the errors of the closest non-matching branch for reporting.
+func (s *Spec) matchBranches(branches []*Schema, v any, path string, depth int) (int, ValidationErrors) {
+	matched := 0
+	var best ValidationErrors
+	for _, b := range branches {
+		var errs ValidationErrors
+		s.validate(b, v, path, depth+1, &errs)
+		if len(errs) == 0 {
+			matched++
+			continue
+		}
+		if best == nil || len(errs) < len(best) {
+			best = errs
+		}
+	}
+	return matched, best
+}
+
+func jsonTypeMatches(typ string, v any) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	default:
+		return true
+	}
+}
+
+func jsonTypeName(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if t == math.Trunc(t) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func checkFormat(format string, v string) string {
+	switch format {
+	case "date":
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return fmt.Sprintf("invalid date %q (expected YYYY-MM-DD)", v)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return fmt.Sprintf("invalid date-time %q (expected RFC 3339)", v)
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(v) {
+			return fmt.Sprintf("invalid uuid %q", v)
+		}
+	case "email":
+		if a, err := mail.ParseAddress(v); err != nil || a.Address != v {
+			return fmt.Sprintf("invalid email %q", v)
+		}
+	}
+	return ""
+}
+
+func isMultipleOf(v float64, m float64) bool {
+	q := v / m
+	return math.Abs(q-math.Round(q)) < 1e-9
+}
+
+func enumContains(enum []any, v any) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	parts := make([]string, 0, len(enum))
+	for _, e := range enum {
+		parts = append(parts, formatJSONValue(e))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatJSONValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(t)
+	case float64:
+		return formatNumber(t)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(token string) string {
+	return pointerEscaper.Replace(token)
+}
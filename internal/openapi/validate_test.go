@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const validateFixture = `{
+  "openapi": "3.0.0",
+  "paths": {},
+  "components": {
+    "schemas": {
+      "PositiveDollar": {"type": "number", "minimum": 0.01, "multipleOf": 0.01},
+      "Method": {"type": "string", "enum": ["ach", "check"]},
+      "Address": {
+        "type": "object",
+        "required": ["city"],
+        "properties": {"city": {"type": "string", "minLength": 2}}
+      },
+      "Payment": {
+        "type": "object",
+        "required": ["recipientId", "amount", "paymentMethod"],
+        "properties": {
+          "recipientId": {"type": "string", "format": "uuid"},
+          "amount": {"allOf": [{"$ref": "#/components/schemas/PositiveDollar"}], "description": "Amount"},
+          "paymentMethod": {"allOf": [{"$ref": "#/components/schemas/Method"}]},
+          "sendOn": {"type": "string", "format": "date"},
+          "emails": {"type": "array", "maxItems": 2, "items": {"type": "string", "format": "email"}},
+          "count": {"type": "integer", "maximum": 10},
+          "note": {"type": "string", "nullable": true},
+          "address": {"allOf": [{"$ref": "#/components/schemas/Address"}], "nullable": true},
+          "target": {
+            "oneOf": [
+              {"type": "object", "required": ["accountId"], "properties": {"accountId": {"type": "string"}}},
+              {"type": "object", "required": ["email"], "properties": {"email": {"type": "string"}}}
+            ]
+          },
+          "label": {"anyOf": [{"type": "string"}, {"type": "integer"}]}
+        }
+      }
+    }
+  }
+}`
+
+func validateDoc(t *testing.T, doc string) ValidationErrors {
+	t.Helper()
+	var spec Spec
+	if err := json.Unmarshal([]byte(validateFixture), &spec); err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	return spec.Validate(&Schema{Ref: "#/components/schemas/Payment"}, v)
+}
+
+func TestValidateValid(t *testing.T) {
+	errs := validateDoc(t, `{
+		"recipientId": "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+		"amount": 12.34,
+		"paymentMethod": "ach",
+		"sendOn": "2024-02-29",
+		"emails": ["ap@example.com"],
+		"count": 3,
+		"note": null,
+		"address": null,
+		"target": {"accountId": "a1"},
+		"label": 7
+	}`)
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got:\n%v", errs)
+	}
+}
+
+func TestValidateReportsPaths(t *testing.T) {
+	errs := validateDoc(t, `{
+		"recipientId": "not-a-uuid",
+		"amount": 0.001,
+		"paymentMethod": "wire",
+		"sendOn": "02/29/2024",
+		"emails": ["ok@example.com", "nope", "third@example.com"],
+		"count": 1.5,
+		"address": {"city": "X"},
+		"target": {"accountId": "a1", "email": "e"},
+		"label": true
+	}`)
+	want := []string{
+		"/recipientId: invalid uuid",
+		"/amount: must be >= 0.01",
+		"/amount: must be a multiple of 0.01",
+		`/paymentMethod: value "wire" is not one of: "ach", "check"`,
+		"/sendOn: invalid date",
+		"/emails: must have at most 2 items",
+		`/emails/1: invalid email "nope"`,
+		"/count: expected integer, got number",
+		"/address/city: length must be >= 2",
+		"/target: matches 2 oneOf schemas",
+		"/label: expected string, got boolean",
+	}
+	got := errs.Error()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("missing %q in:\n%s", w, got)
+		}
+	}
+}
+
+func TestValidateRequiredAndNull(t *testing.T) {
+	errs := validateDoc(t, `{"amount": null, "target": {}}`)
+	got := errs.Error()
+	for _, w := range []string{
+		"/recipientId: is required",
+		"/paymentMethod: is required",
+		"/amount: must not be null",
+		"/target/accountId: is required",
+	} {
+		if !strings.Contains(got, w) {
+			t.Errorf("missing %q in:\n%s", w, got)
+		}
+	}
+}
+
+func TestValidateRootTypeMismatch(t *testing.T) {
+	errs := validateDoc(t, `[1,2]`)
+	if len(errs) != 1 || errs[0].Error() != "/: expected object, got array" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
@@ -0,0 +1,239 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tarrence/mercury-cli/internal/query"
+)
+
+// RowWriter writes list items as CSV or TSV rows. Nested objects are flattened to
+// dotted column names; arrays of scalars are joined with ";" and other arrays are
+// written as compact JSON.
+//
+// The header is --columns if given, else the schema fields from Shape followed by
+// any other keys seen in the first batch of items. Keys that first appear in later
+// batches are dropped (with one warning) so rows can be streamed.
+type RowWriter struct {
+	out     io.Writer
+	warn    io.Writer
+	csv     *csv.Writer
+	columns []string
+	fields  []string
+	fixed   bool
+	header  bool
+	dropped map[string]bool
+	query   *query.Query
+}
+
+// NewRowWriter returns a writer for the printer's csv or tsv format.
+func (p *Printer) NewRowWriter() *RowWriter {
+	rw := &RowWriter{out: p.out, warn: p.err, dropped: map[string]bool{}, query: p.query}
+	if p.format == FormatCSV {
+		rw.csv = csv.NewWriter(p.out)
+	}
+	if len(p.columns) > 0 {
+		rw.columns, rw.fixed = p.columns, true
+	} else if p.query == nil {
+		rw.fields = p.shape.Fields
+	}
+	return rw
+}
+
+// WriteItems writes one row per item, or per --query result for each item. The
+// first call fixes the header.
+func (rw *RowWriter) WriteItems(items []any) error {
+	if rw.query != nil {
+		var results []any
+		for _, it := range items {
+			out, err := rw.query.Run(it)
+			if err != nil {
+				return fmt.Errorf("--query: %w", err)
+			}
+			results = append(results, out...)
+		}
+		items = results
+	}
+	flat := make([]map[string]string, 0, len(items))
+	for _, it := range items {
+		row := map[string]string{}
+		flattenInto(row, "", it)
+		flat = append(flat, row)
+	}
+	if !rw.header {
+		if !rw.fixed {
+			rw.columns = unionColumns(rw.fields, flat)
+		}
+		if err := rw.writeRecord(rw.columns); err != nil {
+			return err
+		}
+		rw.header = true
+	}
+
+	for _, row := range flat {
+		if !rw.fixed {
+			rw.warnDropped(row)
+		}
+		rec := make([]string, len(rw.columns))
+		for i, c := range rw.columns {
+			rec[i] = row[c]
+		}
+		if err := rw.writeRecord(rec); err != nil {
+			return err
+		}
+	}
+	return rw.flush()
+}
+
+// Close writes the header if no rows were written and flushes buffered output.
+func (rw *RowWriter) Close() error {
+	if !rw.header {
+		return rw.WriteItems(nil)
+	}
+	return rw.flush()
+}
+
+func (rw *RowWriter) warnDropped(row map[string]string) {
+	var missing []string
+	for k := range row {
+		if !rw.dropped[k] && !contains(rw.columns, k) {
+			rw.dropped[k] = true
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		fmt.Fprintf(rw.warn, "warning: dropping fields not in the header: %s (use --columns to select them)\n", strings.Join(missing, ", "))
+	}
+}
+
+// writeRecord writes CSV with standard quoting, or TSV with tabs and newlines in
+// values replaced by spaces.
+func (rw *RowWriter) writeRecord(rec []string) error {
+	if rw.csv != nil {
+		return rw.csv.Write(rec)
+	}
+	clean := make([]string, len(rec))
+	for i, f := range rec {
+		clean[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(f)
+	}
+	_, err := io.WriteString(rw.out, strings.Join(clean, "\t")+"\n")
+	return err
+}
+
+func (rw *RowWriter) flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+// unionColumns returns fields followed by the remaining keys of rows, in the order
+// they first appear (keys within a row are sorted).
+func unionColumns(fields []string, rows []map[string]string) []string {
+	cols := append([]string(nil), fields...)
+	seen := map[string]bool{}
+	for _, c := range cols {
+		seen[c] = true
+	}
+	for _, row := range rows {
+		keys := make([]string, 0, len(row))
+		for k := range row {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			seen[k] = true
+			cols = append(cols, k)
+		}
+	}
+	return cols
+}
+
+// MaxFlattenDepth is the most path segments a flattened column name has; objects
+// nested deeper are written as compact JSON.
+const MaxFlattenDepth = 5
+
+// flattenInto adds the leaves of v to row under dotted keys.
+func flattenInto(row map[string]string, prefix string, v any) {
+	switch t := v.(type) {
+	case map[string]any:
+		if prefix != "" && strings.Count(prefix, ".")+1 >= MaxFlattenDepth {
+			b, _ := json.Marshal(t)
+			row[prefix] = string(b)
+			return
+		}
+		for k, val := range t {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenInto(row, key, val)
+		}
+	case []any:
+		row[keyOrValue(prefix)] = joinArray(t)
+	default:
+		row[keyOrValue(prefix)] = csvScalar(t)
+	}
+}
+
+// keyOrValue names the column for a list item that is not an object.
+func keyOrValue(prefix string) string {
+	if prefix == "" {
+		return "value"
+	}
+	return prefix
+}
+
+func joinArray(arr []any) string {
+	parts := make([]string, 0, len(arr))
+	for _, el := range arr {
+		switch el.(type) {
+		case map[string]any, []any:
+			b, _ := json.Marshal(arr)
+			return string(b)
+		}
+		parts = append(parts, csvScalar(el))
+	}
+	return strings.Join(parts, ";")
+}
+
+func csvScalar(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return formatCell(t)
+	}
+}
+
+// writeRows renders a whole JSON body as CSV/TSV: the rows are the array at
+// shape.ItemField, the body itself if it is an array, or else the single object.
+func (p *Printer) writeRows(body []byte) error {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	rows, ok := tableRows(v, p.shape.ItemField)
+	if !ok {
+		rows = []any{v}
+	}
+	rw := p.NewRowWriter()
+	if err := rw.WriteItems(rows); err != nil {
+		return err
+	}
+	return rw.Close()
+}
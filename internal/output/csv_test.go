@@ -0,0 +1,88 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tarrence/mercury-cli/internal/query"
+)
+
+func TestRowWriterFlattensAndStreams(t *testing.T) {
+	var out, errBuf bytes.Buffer
+	p := NewPrinter(&out, &errBuf, PrinterOptions{Format: FormatCSV})
+	p.SetShape(Shape{Fields: []string{"id", "amount", "counterparty.name"}})
+
+	rw := p.NewRowWriter()
+	if err := rw.WriteItems([]any{
+		map[string]any{"id": "t1", "amount": -12.5, "counterparty": map[string]any{"name": "Acme, Inc."}, "tags": []any{"a", "b"}},
+		map[string]any{"id": "t2", "amount": 3.0, "attachments": []any{map[string]any{"fileName": "r.pdf"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	first := out.String()
+	if !strings.HasPrefix(first, "id,amount,counterparty.name,tags,attachments\n") {
+		t.Fatalf("unexpected header:\n%s", first)
+	}
+	if err := rw.WriteItems([]any{map[string]any{"id": "t3", "late": true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,amount,counterparty.name,tags,attachments\n" +
+		"t1,-12.5,\"Acme, Inc.\",a;b,\n" +
+		"t2,3,,,\"[{\"\"fileName\"\":\"\"r.pdf\"\"}]\"\n" +
+		"t3,,,,\n"
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if !strings.Contains(errBuf.String(), "dropping fields not in the header: late") {
+		t.Fatalf("expected warning about dropped field, got %q", errBuf.String())
+	}
+}
+
+func TestPrintBodyTSV(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out, PrinterOptions{Format: FormatTSV, Columns: []string{"id", "note"}})
+	p.SetShape(Shape{ItemField: "items"})
+	if err := p.PrintBody([]byte(`{"items":[{"id":"a","note":"line1\nline2\tx"},{"id":"b"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "id\tnote\na\tline1 line2 x\nb\t\n"; out.String() != want {
+		t.Fatalf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := p.PrintBody([]byte(`{"id":"c","note":"single"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "id\tnote\nc\tsingle\n"; out.String() != want {
+		t.Fatalf("single object: got %q, want %q", out.String(), want)
+	}
+}
+
+func TestRowWriterAppliesQueryPerItem(t *testing.T) {
+	q, err := query.Parse(`select(.amount < 0) | {id, amount}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out, PrinterOptions{Format: FormatCSV, Query: q})
+	p.SetShape(Shape{Fields: []string{"id", "amount", "kind"}})
+
+	rw := p.NewRowWriter()
+	if err := rw.WriteItems([]any{
+		map[string]any{"id": "t1", "amount": -12.5, "kind": "fee"},
+		map[string]any{"id": "t2", "amount": 3.0, "kind": "other"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "amount,id\n-12.5,t1\n" {
+		t.Fatalf("got:\n%s", out.String())
+	}
+}
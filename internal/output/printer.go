@@ -8,15 +8,41 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"text/template"
 
+	"github.com/tarrence/mercury-cli/internal/query"
 	"golang.org/x/term"
 )
 
+// Output formats accepted by PrinterOptions.Format.
+const (
+	FormatJSON  = "json"
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+)
+
+// Formats lists the accepted values for PrinterOptions.Format.
+var Formats = []string{FormatJSON, FormatTable, FormatCSV, FormatTSV}
+
 type PrinterOptions struct {
 	ForcePretty  bool
 	ForceCompact bool
 	Ndjson       bool
 
+	// Format is one of Formats; empty means FormatJSON.
+	Format string
+	// Columns overrides the table/CSV columns; dotted paths select nested fields.
+	Columns []string
+	// Width truncates table output to this many columns. 0 uses the terminal
+	// width when stdout is a terminal, and no limit otherwise.
+	Width int
+	// Query filters JSON bodies (and each NDJSON item) before they are printed.
+	Query *query.Query
+	// Template renders JSON bodies (or each --query result, or each NDJSON item)
+	// instead of printing JSON. See ParseTemplate.
+	Template *template.Template
+
 	PrintStatus  bool
 	PrintHeaders bool
 }
@@ -29,6 +55,14 @@ type Printer struct {
 
 	ndjson bool
 
+	format  string
+	columns []string
+	width   int
+	shape   Shape
+	query   *query.Query
+
+	template *template.Template
+
 	printStatus  bool
 	printHeaders bool
 }
@@ -46,6 +80,19 @@ func NewPrinter(out io.Writer, err io.Writer, opts PrinterOptions) *Printer {
 		}
 	}
 
+	format := opts.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	width := opts.Width
+	if width == 0 {
+		if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			if w, _, err := term.GetSize(int(f.Fd())); err == nil {
+				width = w
+			}
+		}
+	}
+
 	return &Printer{
 		out: out,
 		err: err,
@@ -53,6 +100,13 @@ func NewPrinter(out io.Writer, err io.Writer, opts PrinterOptions) *Printer {
 		pretty: pretty,
 		ndjson: opts.Ndjson,
 
+		format:  format,
+		columns: opts.Columns,
+		width:   width,
+		query:   opts.Query,
+
+		template: opts.Template,
+
 		printStatus:  opts.PrintStatus,
 		printHeaders: opts.PrintHeaders,
 	}
@@ -61,6 +115,13 @@ func NewPrinter(out io.Writer, err io.Writer, opts PrinterOptions) *Printer {
 func (p *Printer) Out() io.Writer      { return p.out }
 func (p *Printer) Err() io.Writer      { return p.err }
 func (p *Printer) NDJSONEnabled() bool { return p.ndjson }
+func (p *Printer) Format() string      { return p.format }
+
+// SetShape describes the response about to be printed, for table and CSV output.
+func (p *Printer) SetShape(s Shape) { p.shape = s }
+
+// WritesRows reports whether list items should be streamed through NewRowWriter.
+func (p *Printer) WritesRows() bool { return p.format == FormatCSV || p.format == FormatTSV }
 
 func (p *Printer) PrintHTTP(status int, headers http.Header, body []byte) error {
 	if p.printStatus {
@@ -81,13 +142,131 @@ func (p *Printer) PrintHTTP(status int, headers http.Header, body []byte) error
 		}
 	}
 
-	return p.printBodyTo(p.out, body)
+	return p.PrintBody(body)
 }
 
 func (p *Printer) PrintBody(body []byte) error {
+	if p.query != nil && len(body) > 0 {
+		results, err := p.query.RunJSON(body)
+		if err != nil {
+			return fmt.Errorf("--query: %w", err)
+		}
+		return p.printResults(results)
+	}
+	if p.template != nil && len(body) > 0 {
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("--template: response is not JSON: %w", err)
+		}
+		return p.executeTemplate(v)
+	}
+	if p.format == FormatTable && json.Valid(body) {
+		return writeTable(p.out, body, p.shape, p.columns, p.width)
+	}
+	if p.WritesRows() && json.Valid(body) {
+		return p.writeRows(body)
+	}
 	return p.printBodyTo(p.out, body)
 }
 
+// printResults prints the outputs of --query. JSON prints each result on its own
+// line (or through the template); table and CSV treat a single array result, or
+// else the results themselves, as the rows. The response shape no longer
+// applies, but --columns still does.
+func (p *Printer) printResults(results []any) error {
+	if p.format == FormatJSON {
+		for _, v := range results {
+			if p.template != nil {
+				if err := p.executeTemplate(v); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.printValue(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var v any = results
+	if len(results) == 1 {
+		v = results[0]
+	}
+	if p.WritesRows() {
+		rows, ok := v.([]any)
+		if !ok {
+			rows = []any{v}
+		}
+		rw := p.NewRowWriter()
+		rw.query = nil // already applied to the whole body
+		if err := rw.WriteItems(rows); err != nil {
+			return err
+		}
+		return rw.Close()
+	}
+	b, err := marshalValue(v)
+	if err != nil {
+		return err
+	}
+	return writeTable(p.out, b, Shape{}, p.columns, p.width)
+}
+
+// PrintItem prints one list item as an NDJSON line, after applying --query. With
+// a template the item is rendered through it instead.
+func (p *Printer) PrintItem(item any) error {
+	results := []any{item}
+	if p.query != nil {
+		var err error
+		if results, err = p.query.Run(item); err != nil {
+			return fmt.Errorf("--query: %w", err)
+		}
+	}
+	for _, v := range results {
+		if p.template != nil {
+			if err := p.executeTemplate(v); err != nil {
+				return err
+			}
+			continue
+		}
+		line, err := marshalValue(v)
+		if err != nil {
+			return err
+		}
+		if _, err := p.out.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintJSON prints v as JSON, bypassing --query, --template and table/CSV
+// formats. It is used for CLI-generated documents such as --dry-run requests.
+func (p *Printer) PrintJSON(v any) error {
+	return p.printValue(v)
+}
+
+func (p *Printer) printValue(v any) error {
+	b, err := marshalValue(v)
+	if err != nil {
+		return err
+	}
+	return p.printBodyTo(p.out, b)
+}
+
+// marshalValue encodes v as compact JSON without escaping <, > and &.
+func marshalValue(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
 func (p *Printer) PrintHTTPError(status int, headers http.Header, body []byte) error {
 	// Always print a status line for non-2xx responses.
 	statusText := http.StatusText(status)
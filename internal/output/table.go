@@ -0,0 +1,300 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Shape tells table output where the rows of a response are and which columns to
+// show by default. It is derived from the operation's response schema.
+type Shape struct {
+	// ItemField is the top-level array property holding the rows (e.g. "accounts").
+	// Empty means the body itself is the array, or a single object.
+	ItemField string
+	// Columns are the default table columns when --columns is not given.
+	Columns []string
+	// Fields are the flattened leaf fields of an item in schema order, used as the
+	// CSV header.
+	Fields []string
+}
+
+// PreferredColumns are picked first, in this order, when choosing default columns.
+var PreferredColumns = []string{"id", "name", "status", "amount", "createdAt"}
+
+// maxDefaultColumns caps how many columns are chosen automatically.
+const maxDefaultColumns = 6
+
+// DefaultColumns picks columns from the available property names: the preferred
+// ones first, then other scalar properties in name order. scalar reports whether a
+// property is a scalar and may be nil.
+func DefaultColumns(names []string, scalar func(name string) bool) []string {
+	have := map[string]bool{}
+	for _, n := range names {
+		have[n] = true
+	}
+	var out []string
+	for _, c := range PreferredColumns {
+		if have[c] {
+			out = append(out, c)
+		}
+	}
+	if len(out) >= 3 {
+		return out
+	}
+	rest := append([]string(nil), names...)
+	sort.Strings(rest)
+	for _, n := range rest {
+		if len(out) >= maxDefaultColumns {
+			break
+		}
+		if contains(out, n) || (scalar != nil && !scalar(n)) {
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTable renders a JSON body as aligned columns. Arrays (the body itself or
+// shape.ItemField) become one row per element; a single object becomes key/value
+// lines.
+func writeTable(w io.Writer, body []byte, shape Shape, columns []string, width int) error {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	rows, isList := tableRows(v, shape.ItemField)
+	if !isList {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			_, err := fmt.Fprintln(w, formatCell(v))
+			return err
+		}
+		return writeKeyValues(w, body, obj, columns, width)
+	}
+
+	if len(columns) == 0 {
+		columns = shape.Columns
+	}
+	if len(columns) == 0 {
+		columns = columnsFromRows(rows)
+	}
+
+	cells := make([][]string, 0, len(rows)+1)
+	cells = append(cells, columns)
+	for _, r := range rows {
+		line := make([]string, len(columns))
+		for i, c := range columns {
+			if val, ok := lookup(r, c); ok {
+				line[i] = formatCell(val)
+			}
+		}
+		cells = append(cells, line)
+	}
+	return writeAligned(w, cells, width)
+}
+
+func tableRows(v any, itemField string) ([]any, bool) {
+	switch t := v.(type) {
+	case []any:
+		return t, true
+	case map[string]any:
+		if itemField == "" {
+			return nil, false
+		}
+		if arr, ok := t[itemField].([]any); ok {
+			return arr, true
+		}
+	}
+	return nil, false
+}
+
+// columnsFromRows picks default columns from the keys of the first object row.
+func columnsFromRows(rows []any) []string {
+	for _, r := range rows {
+		obj, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(obj))
+		for k := range obj {
+			names = append(names, k)
+		}
+		return DefaultColumns(names, func(n string) bool {
+			switch obj[n].(type) {
+			case map[string]any, []any:
+				return false
+			}
+			return true
+		})
+	}
+	return []string{"value"}
+}
+
+func writeKeyValues(w io.Writer, body []byte, obj map[string]any, columns []string, width int) error {
+	keys := columns
+	if len(keys) == 0 {
+		keys = objectKeys(body)
+	}
+	cells := make([][]string, 0, len(keys))
+	for _, k := range keys {
+		val, _ := lookup(obj, k)
+		cells = append(cells, []string{k, formatCell(val)})
+	}
+	return writeAligned(w, cells, width)
+}
+
+// objectKeys returns the top-level keys of a JSON object in document order.
+func objectKeys(body []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		k, _ := t.(string)
+		keys = append(keys, k)
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// lookup resolves a dotted path such as "counterparty.name" in a decoded value.
+func lookup(v any, path string) (any, bool) {
+	cur := v
+	for _, part := range strings.Split(path, ".") {
+		switch t := cur.(type) {
+		case map[string]any:
+			next, ok := t[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			cur = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func formatCell(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(t)
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(b)
+	}
+}
+
+const columnGap = "  "
+
+// writeAligned pads cells into columns. With width > 0 the widest columns are
+// shrunk, and their cells truncated with "…", until each line fits.
+func writeAligned(w io.Writer, cells [][]string, width int) error {
+	if len(cells) == 0 {
+		return nil
+	}
+	n := len(cells[0])
+	widths := make([]int, n)
+	for _, row := range cells {
+		for i, c := range row {
+			if l := utf8.RuneCountInString(c); l > widths[i] {
+				widths[i] = l
+			}
+		}
+	}
+	if width > 0 {
+		shrinkWidths(widths, width-len(columnGap)*(n-1))
+	}
+
+	var buf, line bytes.Buffer
+	for _, row := range cells {
+		line.Reset()
+		for i, c := range row {
+			c = truncate(c, widths[i])
+			line.WriteString(c)
+			if i < n-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)))
+				line.WriteString(columnGap)
+			}
+		}
+		buf.Write(bytes.TrimRight(line.Bytes(), " "))
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// minColumnWidth is the narrowest a column is shrunk to when fitting the terminal.
+const minColumnWidth = 4
+
+func shrinkWidths(widths []int, avail int) {
+	total := 0
+	for _, w := range widths {
+		total += w
+	}
+	for total > avail {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string([]rune(s)[:width])
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
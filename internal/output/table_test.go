@@ -0,0 +1,59 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTableRowsAndColumns(t *testing.T) {
+	body := []byte(`{"accounts":[{"id":"a1","name":"Checking","kind":"checking","counterparty":{"name":"Acme"}},{"id":"a2","name":"Savings"}],"page":{}}`)
+
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out, PrinterOptions{Format: FormatTable})
+	p.SetShape(Shape{ItemField: "accounts", Columns: []string{"id", "name"}})
+	if err := p.PrintBody(body); err != nil {
+		t.Fatal(err)
+	}
+	want := "id  name\na1  Checking\na2  Savings\n"
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	p = NewPrinter(&out, &out, PrinterOptions{Format: FormatTable, Columns: []string{"id", "counterparty.name"}})
+	p.SetShape(Shape{ItemField: "accounts"})
+	if err := p.PrintBody(body); err != nil {
+		t.Fatal(err)
+	}
+	want = "id  counterparty.name\na1  Acme\na2\n"
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestTableSingleObjectAndTruncation(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out, PrinterOptions{Format: FormatTable, Width: 20})
+	if err := p.PrintBody([]byte(`{"id":"a1","memo":"a rather long memo that will not fit","amount":12.50}`)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id ") || !strings.HasPrefix(lines[2], "amount  12.50") {
+		t.Fatalf("unexpected key/value output:\n%s", out.String())
+	}
+	if l := len([]rune(lines[1])); l != 20 || !strings.HasSuffix(lines[1], "…") {
+		t.Fatalf("expected memo truncated to 20 columns, got %q (%d)", lines[1], l)
+	}
+}
+
+func TestDefaultColumns(t *testing.T) {
+	got := DefaultColumns([]string{"amount", "zeta", "createdAt", "id", "status"}, nil)
+	if strings.Join(got, ",") != "id,status,amount,createdAt" {
+		t.Fatalf("DefaultColumns = %v", got)
+	}
+	got = DefaultColumns([]string{"routingNumber", "id", "meta", "accountNumber"}, func(n string) bool { return n != "meta" })
+	if strings.Join(got, ",") != "id,accountNumber,routingNumber" {
+		t.Fatalf("DefaultColumns = %v", got)
+	}
+}
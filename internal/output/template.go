@@ -0,0 +1,268 @@
+package output
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// ParseTemplate compiles a --template with TemplateFuncs available.
+func ParseTemplate(src string) (*template.Template, error) {
+	return template.New("output").Funcs(TemplateFuncs()).Parse(src)
+}
+
+// TemplateFuncs returns the helpers available to --template:
+//
+//	money v              $1,234.50 (negative amounts as -$1,234.50)
+//	currency sym v       like money with another symbol, e.g. currency "€" .amount
+//	number v             1,234.50
+//	date layout v        reformat an RFC 3339 timestamp or YYYY-MM-DD date
+//	parseTime v          time.Time for use with .Format, .Sub, ...
+//	now                  the current time
+//	padLeft n v          right-align v in n columns
+//	padRight n v         left-align v in n columns
+//	truncate n v         cut v to n columns, ending in "…"
+//	json v               compact JSON
+//	jsonIndent v         indented JSON
+//	upper, lower v       change case
+//	join sep list        join a list's elements
+//	default d v          d when v is missing or empty
+//
+// eq, ne, lt, le, gt and ge replace the builtins so that numbers compare by
+// value whatever their type: JSON numbers are decoded as json.Number to keep
+// their digits, which the builtins would compare as strings, or refuse to
+// compare with a number literal such as {{if gt .amount 100}}.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"money":     func(v any) (string, error) { return formatMoney("$", v) },
+		"currency":  formatMoney,
+		"number":    func(v any) (string, error) { return formatMoney("", v) },
+		"date":      formatDate,
+		"parseTime": parseTime,
+		"now":       time.Now,
+		"padLeft":   func(n int, v any) string { return pad(n, v, true) },
+		"padRight":  func(n int, v any) string { return pad(n, v, false) },
+		"truncate":  func(n int, v any) string { return truncate(templateString(v), n) },
+		"json": func(v any) (string, error) {
+			b, err := marshalValue(v)
+			return string(b), err
+		},
+		"jsonIndent": func(v any) (string, error) {
+			b, err := json.MarshalIndent(v, "", "  ")
+			return string(b), err
+		},
+		"upper": func(v any) string { return strings.ToUpper(templateString(v)) },
+		"lower": func(v any) string { return strings.ToLower(templateString(v)) },
+		"join": func(sep string, v any) string {
+			list, _ := v.([]any)
+			parts := make([]string, len(list))
+			for i, el := range list {
+				parts[i] = templateString(el)
+			}
+			return strings.Join(parts, sep)
+		},
+		"eq": templateEq,
+		"ne": func(a, b any) (bool, error) {
+			eq, err := templateEq(a, b)
+			return !eq, err
+		},
+		"lt": func(a, b any) (bool, error) { return templateOrder(a, b, func(c int) bool { return c < 0 }) },
+		"le": func(a, b any) (bool, error) { return templateOrder(a, b, func(c int) bool { return c <= 0 }) },
+		"gt": func(a, b any) (bool, error) { return templateOrder(a, b, func(c int) bool { return c > 0 }) },
+		"ge": func(a, b any) (bool, error) { return templateOrder(a, b, func(c int) bool { return c >= 0 }) },
+		"default": func(def, v any) any {
+			switch t := v.(type) {
+			case nil:
+				return def
+			case string:
+				if t == "" {
+					return def
+				}
+			}
+			return v
+		},
+	}
+}
+
+// executeTemplate runs the template against a decoded JSON value.
+func (p *Printer) executeTemplate(v any) error {
+	var buf bytes.Buffer
+	if err := p.template.Execute(&buf, v); err != nil {
+		return fmt.Errorf("--template: %w", err)
+	}
+	_, err := p.out.Write(buf.Bytes())
+	return err
+}
+
+func templateFloat(v any) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int:
+		return float64(t), nil
+	case json.Number:
+		return t.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(t), 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// templateNumber returns v as a float64 if it is a number of any Go type or a
+// json.Number.
+func templateNumber(v any) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// templateEq reports whether a equals any of bs, like the builtin eq but
+// comparing numbers by value.
+func templateEq(a any, bs ...any) (bool, error) {
+	if len(bs) == 0 {
+		return false, fmt.Errorf("missing argument for comparison")
+	}
+	for _, b := range bs {
+		if x, ok := templateNumber(a); ok {
+			if y, ok := templateNumber(b); ok {
+				if x == y {
+					return true, nil
+				}
+				continue
+			}
+		}
+		ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+		switch {
+		case a == nil || b == nil:
+			if a == b {
+				return true, nil
+			}
+		case ra.Kind() == reflect.String && rb.Kind() == reflect.String:
+			if ra.String() == rb.String() {
+				return true, nil
+			}
+		case ra.Type() == rb.Type() && ra.Type().Comparable():
+			if a == b {
+				return true, nil
+			}
+		default:
+			return false, fmt.Errorf("incompatible types for comparison: %T and %T", a, b)
+		}
+	}
+	return false, nil
+}
+
+// templateOrder compares numbers by value and strings lexically, reporting ok
+// of the comparison's sign.
+func templateOrder(a, b any, ok func(c int) bool) (bool, error) {
+	if x, isNum := templateNumber(a); isNum {
+		if y, isNum := templateNumber(b); isNum {
+			return ok(cmp.Compare(x, y)), nil
+		}
+	}
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if ra.Kind() == reflect.String && rb.Kind() == reflect.String {
+		return ok(strings.Compare(ra.String(), rb.String())), nil
+	}
+	return false, fmt.Errorf("incompatible types for comparison: %T and %T", a, b)
+}
+
+func templateString(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func formatMoney(symbol string, v any) (string, error) {
+	f, err := templateFloat(v)
+	if err != nil {
+		return "", err
+	}
+	s := symbol + groupThousands(strconv.FormatFloat(math.Abs(f), 'f', 2, 64))
+	if f < 0 && math.Round(f*100) != 0 {
+		s = "-" + s
+	}
+	return s, nil
+}
+
+// groupThousands inserts commas into the integer part of a non-negative decimal.
+func groupThousands(s string) string {
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteByte('.')
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+func parseTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range timeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a time", t)
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %v as a time", v)
+}
+
+func formatDate(layout string, v any) (string, error) {
+	if v == nil || v == "" {
+		return "", nil
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+func pad(n int, v any, left bool) string {
+	s := templateString(v)
+	gap := n - utf8.RuneCountInString(s)
+	if gap <= 0 {
+		return s
+	}
+	if left {
+		return strings.Repeat(" ", gap) + s
+	}
+	return s + strings.Repeat(" ", gap)
+}
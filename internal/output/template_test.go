@@ -0,0 +1,68 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{money .a}}`, "$1,234,567.50"},
+		{`{{money .neg}}`, "-$12.05"},
+		{`{{money .tiny}}`, "$0.00"},
+		{`{{currency "€" .a}}`, "€1,234,567.50"},
+		{`{{number .small}}`, "999.00"},
+		{`{{date "Jan 2, 2006" .created}}`, "Mar 4, 2024"},
+		{`{{date "2006-01-02" .day}}`, "2024-03-05"},
+		{`{{(parseTime .created).Year}}`, "2024"},
+		{`[{{padLeft 6 .name}}][{{padRight 6 .name}}]`, "[  Acme][Acme  ]"},
+		{`{{truncate 3 .name}}`, "Ac…"},
+		{`{{json .tags}} {{join "," .tags}}`, `["a","b"] a,b`},
+		{`{{.missing | default "n/a"}} {{upper .name}}`, "n/a ACME"},
+		{`{{if gt .a 100}}big{{end}} {{if lt .small 1000.5}}small{{end}} {{if ge .small .small}}ge{{end}}`, "big small ge"},
+		{`{{if eq .small 999}}999{{end}} {{if ne .neg 0}}nonzero{{end}} {{if eq .name "Acme" "Other"}}acme{{end}}`, "999 nonzero acme"},
+		{`{{if lt .name "B"}}A{{end}} {{if eq .missing nil}}nil{{end}}`, "A nil"},
+	}
+	body := []byte(`{"a":1234567.5,"neg":-12.05,"tiny":-0.001,"small":999,"created":"2024-03-04T10:00:00Z","day":"2024-03-05","name":"Acme","tags":["a","b"]}`)
+	for _, tt := range tests {
+		tmpl, err := ParseTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.tmpl, err)
+		}
+		var out bytes.Buffer
+		p := NewPrinter(&out, &out, PrinterOptions{Template: tmpl})
+		if err := p.PrintBody(body); err != nil {
+			t.Fatalf("%s: %v", tt.tmpl, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s = %q, want %q", tt.tmpl, out.String(), tt.want)
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	tmpl, err := ParseTemplate(`{{money .name}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	p := NewPrinter(&out, &out, PrinterOptions{Template: tmpl})
+	if err := p.PrintBody([]byte(`{"name":"Acme"}`)); err == nil || !strings.HasPrefix(err.Error(), "--template:") {
+		t.Fatalf("expected a --template error, got %v", err)
+	}
+	tmpl, err = ParseTemplate(`{{if gt .name 1}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = NewPrinter(&out, &out, PrinterOptions{Template: tmpl})
+	if err := p.PrintBody([]byte(`{"name":"Acme"}`)); err == nil || !strings.Contains(err.Error(), "incompatible types") {
+		t.Fatalf("expected an incompatible types error, got %v", err)
+	}
+	if err := p.PrintBody([]byte(`not json`)); err == nil {
+		t.Fatal("expected an error for a non-JSON body")
+	}
+}
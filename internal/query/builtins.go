@@ -0,0 +1,510 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// builtin evaluates a function call. args are unevaluated so functions such as
+// select and map can run them against each element.
+type builtin func(in any, args []node) ([]any, error)
+
+type builtinKey struct {
+	name  string
+	arity int
+}
+
+var builtins map[builtinKey]builtin
+
+func init() {
+	builtins = map[builtinKey]builtin{
+		{"empty", 0}:          func(any, []node) ([]any, error) { return nil, nil },
+		{"not", 0}:            func(in any, _ []node) ([]any, error) { return []any{!truthy(in)}, nil },
+		{"length", 0}:         one(length),
+		{"keys", 0}:           one(keys),
+		{"type", 0}:           one(func(in any) (any, error) { return typeName(in), nil }),
+		{"tostring", 0}:       one(func(in any) (any, error) { return toString(in), nil }),
+		{"tonumber", 0}:       one(tonumber),
+		{"ascii_downcase", 0}: one(stringFunc(strings.ToLower)),
+		{"ascii_upcase", 0}:   one(stringFunc(strings.ToUpper)),
+		{"reverse", 0}:        one(reverse),
+		{"sort", 0}:           one(func(in any) (any, error) { return sortBy(in, nil) }),
+		{"unique", 0}:         one(func(in any) (any, error) { return uniqueBy(in, nil) }),
+		{"add", 0}:            one(add),
+		{"min", 0}:            one(func(in any) (any, error) { return extreme(in, -1) }),
+		{"max", 0}:            one(func(in any) (any, error) { return extreme(in, 1) }),
+		{"first", 0}:          one(func(in any) (any, error) { return index(in, 0.0) }),
+		{"last", 0}:           one(func(in any) (any, error) { return index(in, -1.0) }),
+		{"to_entries", 0}:     one(toEntries),
+		{"from_entries", 0}:   one(fromEntries),
+		{"any", 0}:            one(func(in any) (any, error) { return anyAll(in, true) }),
+		{"all", 0}:            one(func(in any) (any, error) { return anyAll(in, false) }),
+
+		{"select", 1}:       selectFn,
+		{"map", 1}:          mapFn,
+		{"has", 1}:          withArg(has),
+		{"sort_by", 1}:      byFn(sortBy),
+		{"unique_by", 1}:    byFn(uniqueBy),
+		{"join", 1}:         withArg(join),
+		{"startswith", 1}:   withArg(stringTest(strings.HasPrefix)),
+		{"endswith", 1}:     withArg(stringTest(strings.HasSuffix)),
+		{"contains", 1}:     withArg(containsFn),
+		{"test", 1}:         withArg(test),
+		{"with_entries", 1}: withEntries,
+		{"first", 1}: func(in any, args []node) ([]any, error) {
+			out, err := args[0].eval(in)
+			if err != nil || len(out) == 0 {
+				return nil, err
+			}
+			return out[:1], nil
+		},
+		{"limit", 2}: func(in any, args []node) ([]any, error) {
+			n, err := evalOne(args[0], in)
+			if err != nil {
+				return nil, err
+			}
+			f, ok := toFloat(n)
+			if !ok {
+				return nil, fmt.Errorf("limit must be a number")
+			}
+			out, err := args[1].eval(in)
+			if err != nil {
+				return nil, err
+			}
+			return out[:min(max(int(f), 0), len(out))], nil
+		},
+	}
+}
+
+// one adapts a function of the input alone.
+func one(f func(in any) (any, error)) builtin {
+	return func(in any, _ []node) ([]any, error) {
+		v, err := f(in)
+		if err != nil {
+			return nil, err
+		}
+		return []any{v}, nil
+	}
+}
+
+// withArg adapts a function of the input and one argument value, producing one
+// output per argument output.
+func withArg(f func(in, arg any) (any, error)) builtin {
+	return func(in any, args []node) ([]any, error) {
+		vals, err := args[0].eval(in)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]any, 0, len(vals))
+		for _, a := range vals {
+			v, err := f(in, a)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+}
+
+// byFn adapts sort_by-style functions whose argument is evaluated per element.
+func byFn(f func(in any, key node) (any, error)) builtin {
+	return func(in any, args []node) ([]any, error) {
+		v, err := f(in, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []any{v}, nil
+	}
+}
+
+func selectFn(in any, args []node) ([]any, error) {
+	conds, err := args[0].eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, c := range conds {
+		if truthy(c) {
+			out = append(out, in)
+		}
+	}
+	return out, nil
+}
+
+func mapFn(in any, args []node) ([]any, error) {
+	elems, err := iterateNode{}.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	out := []any{}
+	for _, el := range elems {
+		v, err := args[0].eval(el)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v...)
+	}
+	return []any{out}, nil
+}
+
+func length(in any) (any, error) {
+	switch t := in.(type) {
+	case nil:
+		return 0.0, nil
+	case bool:
+		return nil, fmt.Errorf("boolean has no length")
+	case string:
+		return float64(utf8.RuneCountInString(t)), nil
+	case []any:
+		return float64(len(t)), nil
+	case map[string]any:
+		return float64(len(t)), nil
+	}
+	f, _ := toFloat(in)
+	if f < 0 {
+		f = -f
+	}
+	return f, nil
+}
+
+func keys(in any) (any, error) {
+	switch t := in.(type) {
+	case map[string]any:
+		return stringsToAny(sortedKeys(t)), nil
+	case []any:
+		out := make([]any, len(t))
+		for i := range t {
+			out[i] = float64(i)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s has no keys", typeName(in))
+}
+
+func has(in, key any) (any, error) {
+	switch t := in.(type) {
+	case map[string]any:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot check whether object has a %s key", typeName(key))
+		}
+		_, found := t[k]
+		return found, nil
+	case []any:
+		f, ok := toFloat(key)
+		if !ok {
+			return nil, fmt.Errorf("cannot check whether array has a %s key", typeName(key))
+		}
+		return f >= 0 && int(f) < len(t), nil
+	}
+	return nil, fmt.Errorf("cannot check whether %s has a key", typeName(in))
+}
+
+func tonumber(in any) (any, error) {
+	if f, ok := toFloat(in); ok {
+		return f, nil
+	}
+	s, ok := in.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse %s as a number", typeName(in))
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q as a number", s)
+	}
+	return f, nil
+}
+
+func stringFunc(f func(string) string) func(any) (any, error) {
+	return func(in any) (any, error) {
+		s, ok := in.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a string", typeName(in))
+		}
+		return f(s), nil
+	}
+}
+
+func stringTest(f func(s, sub string) bool) func(in, arg any) (any, error) {
+	return func(in, arg any) (any, error) {
+		s, ok1 := in.(string)
+		sub, ok2 := arg.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("requires string inputs")
+		}
+		return f(s, sub), nil
+	}
+}
+
+func containsFn(in, arg any) (any, error) {
+	if s, ok := in.(string); ok {
+		sub, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot check whether string contains %s", typeName(arg))
+		}
+		return strings.Contains(s, sub), nil
+	}
+	return containsDeep(in, arg), nil
+}
+
+// containsDeep implements jq's contains for arrays and objects: every element of
+// b is contained in some element of a.
+func containsDeep(a, b any) bool {
+	switch bt := b.(type) {
+	case map[string]any:
+		at, ok := a.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, bv := range bt {
+			av, ok := at[k]
+			if !ok || !containsDeep(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		at, ok := a.([]any)
+		if !ok {
+			return false
+		}
+		for _, bv := range bt {
+			found := false
+			for _, av := range at {
+				if containsDeep(av, bv) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case string:
+		as, ok := a.(string)
+		return ok && strings.Contains(as, bt)
+	}
+	return compare(a, b) == 0
+}
+
+func test(in, arg any) (any, error) {
+	s, ok1 := in.(string)
+	pattern, ok2 := arg.(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("requires string inputs")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+func join(in, arg any) (any, error) {
+	arr, ok := in.([]any)
+	sep, ok2 := arg.(string)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("cannot join %s with %s", typeName(in), typeName(arg))
+	}
+	parts := make([]string, len(arr))
+	for i, el := range arr {
+		switch el.(type) {
+		case nil:
+		case []any, map[string]any:
+			return nil, fmt.Errorf("cannot join %s", typeName(el))
+		default:
+			parts[i] = toString(el)
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func reverse(in any) (any, error) {
+	switch t := in.(type) {
+	case nil:
+		return []any{}, nil
+	case string:
+		r := []rune(t)
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	case []any:
+		out := make([]any, len(t))
+		for i, v := range t {
+			out[len(t)-1-i] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot reverse %s", typeName(in))
+}
+
+// keyed pairs array elements with the output of a key expression.
+func keyed(in any, key node) ([]any, []any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not an array", typeName(in))
+	}
+	keys := make([]any, len(arr))
+	for i, el := range arr {
+		if key == nil {
+			keys[i] = el
+			continue
+		}
+		k, err := key.eval(el)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[i] = orEmpty(k)
+	}
+	return arr, keys, nil
+}
+
+func sortBy(in any, key node) (any, error) {
+	arr, keys, err := keyed(in, key)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(arr))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return compare(keys[idx[a]], keys[idx[b]]) < 0 })
+	out := make([]any, len(arr))
+	for i, j := range idx {
+		out[i] = arr[j]
+	}
+	return out, nil
+}
+
+func uniqueBy(in any, key node) (any, error) {
+	arr, keys, err := keyed(in, key)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(arr))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return compare(keys[idx[a]], keys[idx[b]]) < 0 })
+	out := []any{}
+	for n, j := range idx {
+		if n > 0 && compare(keys[idx[n-1]], keys[j]) == 0 {
+			continue
+		}
+		out = append(out, arr[j])
+	}
+	return out, nil
+}
+
+func add(in any) (any, error) {
+	elems, err := iterateNode{}.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var acc any
+	for _, el := range elems {
+		if acc, err = binary("+", acc, el); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func extreme(in any, sign int) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", typeName(in))
+	}
+	var best any
+	for i, el := range arr {
+		if i == 0 || compare(el, best)*sign > 0 {
+			best = el
+		}
+	}
+	return best, nil
+}
+
+func anyAll(in any, wantAny bool) (any, error) {
+	elems, err := iterateNode{}.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range elems {
+		if truthy(el) == wantAny {
+			return wantAny, nil
+		}
+	}
+	return !wantAny, nil
+}
+
+func toEntries(in any) (any, error) {
+	obj, ok := in.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an object", typeName(in))
+	}
+	out := make([]any, 0, len(obj))
+	for _, k := range sortedKeys(obj) {
+		out = append(out, map[string]any{"key": k, "value": obj[k]})
+	}
+	return out, nil
+}
+
+func withEntries(in any, args []node) ([]any, error) {
+	entries, err := toEntries(in)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := mapFn(entries, args)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := fromEntries(mapped[0])
+	if err != nil {
+		return nil, err
+	}
+	return []any{obj}, nil
+}
+
+func fromEntries(in any) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", typeName(in))
+	}
+	out := make(map[string]any, len(arr))
+	for _, el := range arr {
+		e, ok := el.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("entry is %s, not an object", typeName(el))
+		}
+		var k any
+		for _, name := range []string{"key", "k", "name", "Name", "Key"} {
+			if v, ok := e[name]; ok && v != nil {
+				k = v
+				break
+			}
+		}
+		var v any
+		for _, name := range []string{"value", "v", "Value"} {
+			if val, ok := e[name]; ok {
+				v = val
+				break
+			}
+		}
+		switch kt := k.(type) {
+		case string:
+			out[kt] = v
+		case nil:
+			return nil, fmt.Errorf("entry has no key")
+		default:
+			out[toString(kt)] = v
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,627 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type identityNode struct{}
+
+func (identityNode) eval(in any) ([]any, error) { return []any{in}, nil }
+
+type recurseNode struct{}
+
+func (recurseNode) eval(in any) ([]any, error) {
+	var out []any
+	var walk func(v any)
+	walk = func(v any) {
+		out = append(out, v)
+		switch t := v.(type) {
+		case []any:
+			for _, el := range t {
+				walk(el)
+			}
+		case map[string]any:
+			for _, k := range sortedKeys(t) {
+				walk(t[k])
+			}
+		}
+	}
+	walk(in)
+	return out, nil
+}
+
+type literalNode struct{ value any }
+
+func (n literalNode) eval(any) ([]any, error) { return []any{n.value}, nil }
+
+type fieldNode struct{ name string }
+
+func (n fieldNode) eval(in any) ([]any, error) {
+	switch t := in.(type) {
+	case nil:
+		return []any{nil}, nil
+	case map[string]any:
+		return []any{t[n.name]}, nil
+	}
+	return nil, fmt.Errorf("cannot index %s with %q", typeName(in), n.name)
+}
+
+type iterateNode struct{}
+
+func (iterateNode) eval(in any) ([]any, error) {
+	switch t := in.(type) {
+	case []any:
+		return t, nil
+	case map[string]any:
+		out := make([]any, 0, len(t))
+		for _, k := range sortedKeys(t) {
+			out = append(out, t[k])
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", typeName(in))
+}
+
+type indexNode struct{ index node }
+
+func (n indexNode) eval(in any) ([]any, error) {
+	idxs, err := n.index.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, idx := range idxs {
+		v, err := index(in, idx)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func index(in, idx any) (any, error) {
+	if in == nil {
+		return nil, nil
+	}
+	if s, ok := idx.(string); ok {
+		return fieldNode{s}.eval(in)
+	}
+	arr, ok := in.([]any)
+	f, isNum := toFloat(idx)
+	if !ok || !isNum {
+		return nil, fmt.Errorf("cannot index %s with %s", typeName(in), typeName(idx))
+	}
+	i := int(math.Floor(f))
+	if i < 0 {
+		i += len(arr)
+	}
+	if i < 0 || i >= len(arr) {
+		return nil, nil
+	}
+	return arr[i], nil
+}
+
+type sliceNode struct{ from, to node }
+
+func (n sliceNode) eval(in any) ([]any, error) {
+	if in == nil {
+		return []any{nil}, nil
+	}
+	var length int
+	switch t := in.(type) {
+	case []any:
+		length = len(t)
+	case string:
+		length = len([]rune(t))
+	default:
+		return nil, fmt.Errorf("cannot slice %s", typeName(in))
+	}
+	bound := func(b node, def int) (int, error) {
+		if b == nil {
+			return def, nil
+		}
+		v, err := evalOne(b, in)
+		if err != nil {
+			return 0, err
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return 0, fmt.Errorf("slice bounds must be numbers, got %s", typeName(v))
+		}
+		i := int(math.Floor(f))
+		if i < 0 {
+			i += length
+		}
+		return min(max(i, 0), length), nil
+	}
+	from, err := bound(n.from, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := bound(n.to, length)
+	if err != nil {
+		return nil, err
+	}
+	to = max(from, to)
+	if s, ok := in.(string); ok {
+		return []any{string([]rune(s)[from:to])}, nil
+	}
+	return []any{in.([]any)[from:to]}, nil
+}
+
+type pipeNode struct{ left, right node }
+
+func (n pipeNode) eval(in any) ([]any, error) {
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, l := range lefts {
+		rights, err := n.right.eval(l)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rights...)
+	}
+	return out, nil
+}
+
+type commaNode struct{ left, right node }
+
+func (n commaNode) eval(in any) ([]any, error) {
+	l, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	return append(l, r...), nil
+}
+
+// altNode is a // b: the truthy outputs of a, or else the outputs of b.
+type altNode struct{ left, right node }
+
+func (n altNode) eval(in any) ([]any, error) {
+	l, err := n.left.eval(in)
+	var out []any
+	if err == nil {
+		for _, v := range l {
+			if truthy(v) {
+				out = append(out, v)
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return n.right.eval(in)
+}
+
+type tryNode struct{ body node }
+
+func (n tryNode) eval(in any) ([]any, error) {
+	out, err := n.body.eval(in)
+	if err != nil {
+		return nil, nil
+	}
+	return out, nil
+}
+
+type logicNode struct {
+	op          string
+	left, right node
+}
+
+func (n logicNode) eval(in any) ([]any, error) {
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, l := range lefts {
+		if n.op == "and" && !truthy(l) {
+			out = append(out, false)
+			continue
+		}
+		if n.op == "or" && truthy(l) {
+			out = append(out, true)
+			continue
+		}
+		rights, err := n.right.eval(in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			out = append(out, truthy(r))
+		}
+	}
+	return out, nil
+}
+
+type negateNode struct{ operand node }
+
+func (n negateNode) eval(in any) ([]any, error) {
+	vals, err := n.operand.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, 0, len(vals))
+	for _, v := range vals {
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %s", typeName(v))
+		}
+		out = append(out, -f)
+	}
+	return out, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n binaryNode) eval(in any) ([]any, error) {
+	rights, err := n.right.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, r := range rights {
+		for _, l := range lefts {
+			v, err := binary(n.op, l, r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func binary(op string, l, r any) (any, error) {
+	switch op {
+	case "==":
+		return compare(l, r) == 0, nil
+	case "!=":
+		return compare(l, r) != 0, nil
+	case "<":
+		return compare(l, r) < 0, nil
+	case "<=":
+		return compare(l, r) <= 0, nil
+	case ">":
+		return compare(l, r) > 0, nil
+	case ">=":
+		return compare(l, r) >= 0, nil
+	}
+
+	lf, lnum := toFloat(l)
+	rf, rnum := toFloat(r)
+	if lnum && rnum {
+		switch op {
+		case "+":
+			return lf + rf, nil
+		case "-":
+			return lf - rf, nil
+		case "*":
+			return lf * rf, nil
+		case "/":
+			if rf == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return lf / rf, nil
+		case "%":
+			if int64(rf) == 0 {
+				return nil, fmt.Errorf("modulo by zero")
+			}
+			return float64(int64(lf) % int64(rf)), nil
+		}
+	}
+	if op == "+" {
+		switch lt := l.(type) {
+		case nil:
+			return r, nil
+		case string:
+			if rs, ok := r.(string); ok {
+				return lt + rs, nil
+			}
+		case []any:
+			if ra, ok := r.([]any); ok {
+				return append(append([]any{}, lt...), ra...), nil
+			}
+		case map[string]any:
+			if ro, ok := r.(map[string]any); ok {
+				merged := make(map[string]any, len(lt)+len(ro))
+				for k, v := range lt {
+					merged[k] = v
+				}
+				for k, v := range ro {
+					merged[k] = v
+				}
+				return merged, nil
+			}
+		}
+		if r == nil {
+			return l, nil
+		}
+	}
+	if op == "-" {
+		if la, ok := l.([]any); ok {
+			if ra, ok := r.([]any); ok {
+				var out []any
+				for _, v := range la {
+					if !containsValue(ra, v) {
+						out = append(out, v)
+					}
+				}
+				return orEmpty(out), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s and %s", op, typeName(l), typeName(r))
+}
+
+type collectNode struct{ body node }
+
+func (n collectNode) eval(in any) ([]any, error) {
+	if n.body == nil {
+		return []any{[]any{}}, nil
+	}
+	out, err := n.body.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	return []any{orEmpty(out)}, nil
+}
+
+type objectEntry struct{ key, value node }
+
+type objectNode struct{ entries []objectEntry }
+
+// eval builds one object per combination of key and value outputs, as jq does.
+func (n objectNode) eval(in any) ([]any, error) {
+	results := []map[string]any{{}}
+	for _, e := range n.entries {
+		keys, err := e.key.eval(in)
+		if err != nil {
+			return nil, err
+		}
+		vals, err := e.value.eval(in)
+		if err != nil {
+			return nil, err
+		}
+		var next []map[string]any
+		for _, obj := range results {
+			for _, k := range keys {
+				ks, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, got %s", typeName(k))
+				}
+				for _, v := range vals {
+					cp := make(map[string]any, len(obj)+1)
+					for ok, ov := range obj {
+						cp[ok] = ov
+					}
+					cp[ks] = v
+					next = append(next, cp)
+				}
+			}
+		}
+		results = next
+	}
+	out := make([]any, len(results))
+	for i, r := range results {
+		out[i] = r
+	}
+	return out, nil
+}
+
+type callNode struct {
+	name string
+	fn   builtin
+	args []node
+}
+
+func (n callNode) eval(in any) ([]any, error) {
+	out, err := n.fn(in, n.args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return out, nil
+}
+
+// evalOne evaluates n and requires exactly one output.
+func evalOne(n node, in any) (any, error) {
+	out, err := n.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != 1 {
+		return nil, fmt.Errorf("expected a single value, got %d", len(out))
+	}
+	return out[0], nil
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	}
+	return true
+}
+
+// toFloat converts numbers from literals (float64) and decoded bodies
+// (json.Number).
+func toFloat(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	if _, ok := toFloat(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// typeRank orders values as jq does: null, false, true, numbers, strings,
+// arrays, objects.
+func typeRank(v any) int {
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if t {
+			return 2
+		}
+		return 1
+	case string:
+		return 4
+	case []any:
+		return 5
+	case map[string]any:
+		return 6
+	}
+	return 3
+}
+
+func compare(a, b any) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return cmpInt(ra, rb)
+	}
+	switch at := a.(type) {
+	case string:
+		bs := b.(string)
+		switch {
+		case at < bs:
+			return -1
+		case at > bs:
+			return 1
+		}
+		return 0
+	case []any:
+		bt := b.([]any)
+		for i := 0; i < len(at) && i < len(bt); i++ {
+			if c := compare(at[i], bt[i]); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(len(at), len(bt))
+	case map[string]any:
+		bt := b.(map[string]any)
+		ak, bk := sortedKeys(at), sortedKeys(bt)
+		if c := compare(stringsToAny(ak), stringsToAny(bk)); c != 0 {
+			return c
+		}
+		for _, k := range ak {
+			if c := compare(at[k], bt[k]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	if ra == 3 {
+		af, _ := toFloat(a)
+		bf, _ := toFloat(b)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+	}
+	return 0
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringsToAny(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+func containsValue(list []any, v any) bool {
+	for _, el := range list {
+		if compare(el, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// orEmpty turns a nil slice into an empty array so it encodes as [] not null.
+func orEmpty(v []any) []any {
+	if v == nil {
+		return []any{}
+	}
+	return v
+}
+
+// toString renders v the way jq's tostring does.
+func toString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
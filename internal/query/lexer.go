@@ -0,0 +1,146 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokDot
+	tokDotDot
+	tokField // .name
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct // [ ] { } ( ) | , : ; ?
+	tokOp    // == != < <= > >= + - * / % //
+)
+
+type token struct {
+	kind tokenKind
+	text string // identifier, field name, operator or punctuation
+	str  string // decoded string literal
+	num  float64
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokField:
+		return "." + t.text
+	case tokString:
+		return strconv.Quote(t.str)
+	case tokNumber:
+		return strconv.FormatFloat(t.num, 'g', -1, 64)
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '.':
+			start := i
+			switch {
+			case i+1 < len(src) && src[i+1] == '.':
+				toks = append(toks, token{kind: tokDotDot, text: "..", pos: start})
+				i += 2
+			case i+1 < len(src) && isIdentStart(src[i+1]):
+				j := i + 1
+				for j < len(src) && isIdentChar(src[j]) {
+					j++
+				}
+				toks = append(toks, token{kind: tokField, text: src[i+1 : j], pos: start})
+				i = j
+			default:
+				toks = append(toks, token{kind: tokDot, text: ".", pos: start})
+				i++
+			}
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'e' || src[j] == 'E' ||
+				((src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[i:j], i)
+			}
+			toks = append(toks, token{kind: tokNumber, num: n, text: src[i:j], pos: i})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:j+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string %s at %d", src[i:j+1], i)
+			}
+			toks = append(toks, token{kind: tokString, str: s, text: src[i : j+1], pos: i})
+			i = j + 1
+		default:
+			if op := matchOp(src[i:]); op != "" {
+				toks = append(toks, token{kind: tokOp, text: op, pos: i})
+				i += len(op)
+				continue
+			}
+			if strings.IndexByte("[]{}()|,:;?", c) >= 0 {
+				toks = append(toks, token{kind: tokPunct, text: string(c), pos: i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "//", "<", ">", "+", "-", "*", "/", "%"}
+
+func matchOp(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
@@ -0,0 +1,405 @@
+package query
+
+import (
+	"fmt"
+)
+
+// node is a parsed expression. eval returns every output for one input.
+type node interface {
+	eval(in any) ([]any, error)
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) isOp(s string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == s
+}
+
+func (p *parser) isKeyword(s string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == s
+}
+
+func (p *parser) expectPunct(s string) error {
+	if !p.isPunct(s) {
+		return p.errorf("expected %q, got %s", s, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+// parsePipe parses a | b | c. Commas are not allowed inside object values.
+func (p *parser) parsePipe(allowComma bool) (node, error) {
+	left, err := p.parseComma(allowComma)
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("|") {
+		p.next()
+		right, err := p.parseComma(allowComma)
+		if err != nil {
+			return nil, err
+		}
+		left = pipeNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComma(allowComma bool) (node, error) {
+	left, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	for allowComma && p.isPunct(",") {
+		p.next()
+		right, err := p.parseAlt()
+		if err != nil {
+			return nil, err
+		}
+		left = commaNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAlt() (node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("//") {
+		p.next()
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = altNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{"or", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{"and", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return binaryNode{t.text, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		op := p.next().text
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	term, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokField:
+			p.next()
+			term = pipeNode{term, fieldNode{t.text}}
+		case t.kind == tokDot && p.toks[p.pos+1].kind == tokString:
+			p.next()
+			term = pipeNode{term, fieldNode{p.next().str}}
+		case t.kind == tokDot && p.toks[p.pos+1].kind == tokPunct && p.toks[p.pos+1].text == "[":
+			p.next()
+		case p.isPunct("["):
+			suffix, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			term = pipeNode{term, suffix}
+		case p.isPunct("?"):
+			p.next()
+			term = tryNode{term}
+		default:
+			return term, nil
+		}
+	}
+}
+
+// parseBracket parses [], [expr] and [from:to] after a term.
+func (p *parser) parseBracket() (node, error) {
+	if err := p.expectPunct("["); err != nil {
+		return nil, err
+	}
+	if p.isPunct("]") {
+		p.next()
+		return iterateNode{}, nil
+	}
+	var from, to node
+	var err error
+	if !p.isPunct(":") {
+		if from, err = p.parsePipe(true); err != nil {
+			return nil, err
+		}
+	}
+	if p.isPunct(":") {
+		p.next()
+		if !p.isPunct("]") {
+			if to, err = p.parsePipe(true); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+		return sliceNode{from, to}, nil
+	}
+	if err := p.expectPunct("]"); err != nil {
+		return nil, err
+	}
+	return indexNode{from}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokDot:
+		p.next()
+		if p.peek().kind == tokString {
+			return fieldNode{p.next().str}, nil
+		}
+		return identityNode{}, nil
+	case tokDotDot:
+		p.next()
+		return recurseNode{}, nil
+	case tokField:
+		p.next()
+		return fieldNode{t.text}, nil
+	case tokNumber:
+		p.next()
+		return literalNode{t.num}, nil
+	case tokString:
+		p.next()
+		return literalNode{t.str}, nil
+	case tokOp:
+		if t.text == "-" {
+			p.next()
+			operand, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return negateNode{operand}, nil
+		}
+	case tokPunct:
+		switch t.text {
+		case "(":
+			p.next()
+			inner, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			p.next()
+			if p.isPunct("]") {
+				p.next()
+				return collectNode{nil}, nil
+			}
+			inner, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			return collectNode{inner}, nil
+		case "{":
+			return p.parseObject()
+		}
+	case tokIdent:
+		return p.parseIdent()
+	}
+	return nil, p.errorf("unexpected %s", t)
+}
+
+func (p *parser) parseIdent() (node, error) {
+	name := p.next().text
+	switch name {
+	case "true":
+		return literalNode{true}, nil
+	case "false":
+		return literalNode{false}, nil
+	case "null":
+		return literalNode{nil}, nil
+	}
+	var args []node
+	if p.isPunct("(") {
+		p.next()
+		for {
+			arg, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.isPunct(";") {
+				p.next()
+				continue
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	fn, ok := builtins[builtinKey{name, len(args)}]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s/%d", name, len(args))
+	}
+	return callNode{name: name, fn: fn, args: args}, nil
+}
+
+// parseObject parses {a, b: .x, "c": .y, (.k): .v}.
+func (p *parser) parseObject() (node, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	var entries []objectEntry
+	for !p.isPunct("}") {
+		var e objectEntry
+		t := p.peek()
+		switch {
+		case t.kind == tokIdent:
+			p.next()
+			e.key = literalNode{t.text}
+			e.value = fieldNode{t.text}
+		case t.kind == tokString:
+			p.next()
+			e.key = literalNode{t.str}
+			e.value = fieldNode{t.str}
+		case p.isPunct("("):
+			p.next()
+			k, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			e.key = k
+		default:
+			return nil, p.errorf("unexpected %s in object key", t)
+		}
+		if p.isPunct(":") {
+			p.next()
+			v, err := p.parsePipe(false)
+			if err != nil {
+				return nil, err
+			}
+			e.value = v
+		} else if e.value == nil {
+			return nil, p.errorf("expected \":\" after computed object key")
+		}
+		entries = append(entries, e)
+		if p.isPunct(",") {
+			p.next()
+			continue
+		}
+		if !p.isPunct("}") {
+			return nil, p.errorf("expected \",\" or \"}\" in object, got %s", p.peek())
+		}
+	}
+	p.next()
+	return objectNode{entries}, nil
+}
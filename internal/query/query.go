@@ -0,0 +1,55 @@
+// Package query implements the subset of jq used by --query: paths (.a.b, .[0],
+// .[], .[1:3], ..), pipes, commas, comparisons and arithmetic, and/or/not,
+// alternatives (//), array and object construction, and common builtins such as
+// select, map, length, keys, has, sort_by and join.
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Query is a parsed expression.
+type Query struct {
+	src  string
+	root node
+}
+
+// Parse compiles expr.
+func Parse(expr string) (*Query, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parsePipe(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.peek())
+	}
+	return &Query{src: expr, root: root}, nil
+}
+
+// String returns the source expression.
+func (q *Query) String() string { return q.src }
+
+// Run evaluates the query against a decoded JSON value. Numbers may be float64
+// or json.Number; json.Number values are passed through unchanged so they keep
+// their original formatting.
+func (q *Query) Run(v any) ([]any, error) {
+	return q.root.eval(v)
+}
+
+// RunJSON decodes body and evaluates the query against it.
+func (q *Query) RunJSON(body []byte) ([]any, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %w", err)
+	}
+	return q.Run(v)
+}
@@ -0,0 +1,111 @@
+package query
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const accounts = `{
+  "accounts": [
+    {"id": "a1", "name": "Checking", "status": "active", "availableBalance": 1200.50, "kind": "checking", "tags": ["ops", "main"]},
+    {"id": "a2", "name": "Savings", "status": "active", "availableBalance": 98000, "kind": "savings", "tags": []},
+    {"id": "a3", "name": "Old", "status": "archived", "availableBalance": 0, "kind": "checking", "tags": null}
+  ],
+  "page": {"nextPage": null}
+}`
+
+func run(t *testing.T, expr, input string) string {
+	t.Helper()
+	q, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	out, err := q.RunJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("Run(%q): %v", expr, err)
+	}
+	lines := make([]string, len(out))
+	for i, v := range out {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines[i] = string(b)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		expr  string
+		input string // defaults to accounts
+		want  string
+	}{
+		{`.`, `{"a":1}`, `{"a":1}`},
+		{`.accounts[0].id`, "", `"a1"`},
+		{`.accounts[-1].name`, "", `"Old"`},
+		{`.accounts[].id`, "", "\"a1\"\n\"a2\"\n\"a3\""},
+		{`.accounts | length`, "", `3`},
+		{`.accounts[1:].[0].id`, "", `"a2"`},
+		{`.missing.deeper`, "", `null`},
+		{`."page"."nextPage"`, "", `null`},
+		{`[.accounts[] | select(.status == "active") | .id]`, "", `["a1","a2"]`},
+		{`.accounts | map(select(.availableBalance > 1000 and .kind == "checking") | .name)`, "", `["Checking"]`},
+		{`.accounts | map(.availableBalance) | add`, "", `99200.5`},
+		{`.accounts[0] | {id, name, balance: .availableBalance}`, "", `{"balance":1200.50,"id":"a1","name":"Checking"}`},
+		{`.accounts[0] | {(.id): .status}`, "", `{"a1":"active"}`},
+		{`.accounts[0] | {id, tag: .tags[]}`, "", "{\"id\":\"a1\",\"tag\":\"ops\"}\n{\"id\":\"a1\",\"tag\":\"main\"}"},
+		{`.accounts | sort_by(.availableBalance) | reverse | .[0].id`, "", `"a2"`},
+		{`.accounts | map(.kind) | unique`, "", `["checking","savings"]`},
+		{`.accounts[2].tags // "none"`, "", `"none"`},
+		{`.accounts[] | select(.tags | length > 0) | .tags | join(",")`, "", `"ops,main"`},
+		{`.accounts[0] | keys`, "", `["availableBalance","id","kind","name","status","tags"]`},
+		{`.accounts[0] | has("kind"), has("memo")`, "", "true\nfalse"},
+		{`[.accounts[].name | select(startswith("S") or test("^O"))]`, "", `["Savings","Old"]`},
+		{`.accounts[0].id | ascii_upcase + "-" + ("x" | tostring)`, "", `"A1-x"`},
+		{`[.accounts[].availableBalance | . * 2] | max`, "", `196000`},
+		{`[limit(2; .accounts[].id)]`, "", `["a1","a2"]`},
+		{`.accounts[0] | with_entries(select(.key == "id"))`, "", `{"id":"a1"}`},
+		{`[.[] | not]`, `[1,null]`, `[false,true]`},
+		{`.[0].x?`, `[1]`, ``},
+	}
+	for _, tt := range tests {
+		input := tt.input
+		if input == "" {
+			input = accounts
+		}
+		if got := run(t, tt.expr, input); got != tt.want {
+			t.Errorf("%s\n got: %s\nwant: %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompareOrdering(t *testing.T) {
+	got := run(t, `sort`, `[{"a":1},[2],"b",3,true,false,null,"a",1.5]`)
+	want := `[null,false,true,1.5,3,"a","b",[2],{"a":1}]`
+	if got != want {
+		t.Fatalf("sort = %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{`.a |`, `.[`, `{a:}`, `select(.a`, `.a ]`, `"unterminated`, `.a @ .b`, `numbers`} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	q, err := Parse(`.accounts[0].id.x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.RunJSON([]byte(accounts)); err == nil || !strings.Contains(err.Error(), `cannot index string with "x"`) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := q.RunJSON([]byte("not json")); err == nil {
+		t.Fatal("expected an error for a non-JSON body")
+	}
+}
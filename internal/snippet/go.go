@@ -0,0 +1,105 @@
+package snippet
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Go renders r as a standalone Go program that sends the request and prints the
+// response.
+func Go(r Request) (string, error) {
+	imports := map[string]bool{"fmt": true, "io": true, "net/http": true}
+	var b strings.Builder
+	body := "nil"
+
+	switch {
+	case len(r.Form) > 0:
+		imports["bytes"], imports["mime/multipart"] = true, true
+		b.WriteString("var body bytes.Buffer\nw := multipart.NewWriter(&body)\n")
+		for _, f := range r.Form {
+			if f.File {
+				imports["os"], imports["path/filepath"] = true, true
+				fmt.Fprintf(&b, "if err := addFile(w, %s, %s); err != nil {\npanic(err)\n}\n", strconv.Quote(f.Name), strconv.Quote(f.Value))
+			} else {
+				fmt.Fprintf(&b, "if err := w.WriteField(%s, %s); err != nil {\npanic(err)\n}\n", strconv.Quote(f.Name), strconv.Quote(f.Value))
+			}
+		}
+		b.WriteString("if err := w.Close(); err != nil {\npanic(err)\n}\n\n")
+		body = "&body"
+	case len(r.Body) > 0:
+		imports["strings"] = true
+		body = "strings.NewReader(" + goString(string(r.Body)) + ")"
+	}
+
+	fmt.Fprintf(&b, "req, err := http.NewRequest(%s, %s, %s)\nif err != nil {\npanic(err)\n}\n", strconv.Quote(r.Method), strconv.Quote(r.URL), body)
+	for _, h := range r.headers() {
+		fmt.Fprintf(&b, "req.Header.Add(%s, %s)\n", strconv.Quote(h[0]), strconv.Quote(h[1]))
+	}
+	if len(r.Form) > 0 {
+		b.WriteString("req.Header.Set(\"Content-Type\", w.FormDataContentType())\n")
+	}
+	switch authScheme(r.Header) {
+	case "bearer":
+		imports["os"] = true
+		fmt.Fprintf(&b, "req.Header.Set(\"Authorization\", \"Bearer \"+os.Getenv(%q))\n", TokenEnv)
+	case "basic":
+		imports["os"] = true
+		fmt.Fprintf(&b, "req.SetBasicAuth(os.Getenv(%q), \"\")\n", TokenEnv)
+	}
+	b.WriteString(`
+res, err := http.DefaultClient.Do(req)
+if err != nil {
+panic(err)
+}
+defer res.Body.Close()
+out, err := io.ReadAll(res.Body)
+if err != nil {
+panic(err)
+}
+fmt.Println(res.Status)
+fmt.Println(string(out))
+`)
+
+	names := make([]string, 0, len(imports))
+	for name := range imports {
+		names = append(names, strconv.Quote(name))
+	}
+	sort.Strings(names)
+
+	src := "package main\n\nimport (\n" + strings.Join(names, "\n") + "\n)\n\nfunc main() {\n" + b.String() + "}\n"
+	if imports["path/filepath"] {
+		src += addFileFunc
+	}
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return "", fmt.Errorf("format Go snippet: %w", err)
+	}
+	return string(out), nil
+}
+
+const addFileFunc = `
+func addFile(w *multipart.Writer, field, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	part, err := w.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
+`
+
+// goString returns s as a raw string literal when possible, for readable JSON.
+func goString(s string) string {
+	if !strings.Contains(s, "`") && !strings.Contains(s, "\r") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,332 @@
+package snippet
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CurlCommand is a parsed curl command line.
+type CurlCommand struct {
+	Method string
+	URL    string
+	Header http.Header
+	// Data is the request body from -d and friends, joined with "&" as curl does.
+	// A single "@path" value is kept as a file reference.
+	Data string
+	Form []FormField
+	// User is the -u credential, "user:password".
+	User string
+}
+
+// curlIgnored are curl options that do not change the request, with whether they
+// take a value.
+var curlIgnored = map[string]bool{
+	"-s": false, "--silent": false, "-S": false, "--show-error": false,
+	"-i": false, "--include": false, "-v": false, "--verbose": false,
+	"-L": false, "--location": false, "-k": false, "--insecure": false,
+	"-f": false, "--fail": false, "--fail-with-body": false, "--compressed": false,
+	"-g": false, "--globoff": false, "-N": false, "--no-buffer": false,
+	"-o": true, "--output": true, "-w": true, "--write-out": true,
+	"-m": true, "--max-time": true, "--connect-timeout": true, "--retry": true,
+	"-A": true, "--user-agent": true, "-e": true, "--referer": true,
+}
+
+// ParseCurl parses the arguments of a curl command (with or without the leading
+// "curl"). Only options that shape the HTTP request are supported; options that
+// don't (such as -s or -o) are ignored and anything else is an error.
+func ParseCurl(args []string) (*CurlCommand, error) {
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+	c := &CurlCommand{Header: http.Header{}}
+	var data []string
+	get := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if c.URL != "" {
+				return nil, fmt.Errorf("more than one URL (%q and %q)", c.URL, arg)
+			}
+			c.URL = arg
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue = strings.Cut(arg, "=")
+		case len(arg) > 2:
+			// Short options may carry their value (-XPOST) or be grouped (-sSL).
+			if _, ignored := curlIgnored[arg[:2]]; ignored && !curlIgnored[arg[:2]] {
+				if err := checkGroupedFlags(arg); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+		next := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("curl option %s requires a value", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch name {
+		case "-X", "--request":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			c.Method = strings.ToUpper(v)
+		case "--url":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			c.URL = v
+		case "-H", "--header":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			k, hv, ok := strings.Cut(v, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid header %q", v)
+			}
+			c.Header.Add(strings.TrimSpace(k), strings.TrimSpace(hv))
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii", "--json":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if name == "--data-raw" && strings.HasPrefix(v, "@") {
+				return nil, fmt.Errorf("--data-raw values starting with @ are not supported")
+			}
+			if name == "--json" {
+				c.Header.Set("Content-Type", "application/json")
+				c.Header.Set("Accept", "application/json")
+			}
+			data = append(data, v)
+		case "--data-urlencode":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, urlencodeData(v))
+		case "-F", "--form", "--form-string":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			k, fv, ok := strings.Cut(v, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid form field %q", v)
+			}
+			f := FormField{Name: k, Value: fv}
+			if name != "--form-string" && strings.HasPrefix(fv, "@") {
+				f.Value, f.File = strings.TrimPrefix(fv, "@"), true
+			}
+			c.Form = append(c.Form, f)
+		case "-u", "--user":
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			c.User = v
+		case "-G", "--get":
+			get = true
+		default:
+			takesValue, ok := curlIgnored[name]
+			if !ok {
+				return nil, fmt.Errorf("unsupported curl option %s", name)
+			}
+			if takesValue {
+				if _, err := next(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if c.URL == "" {
+		return nil, fmt.Errorf("no URL in curl command")
+	}
+	if len(data) > 1 {
+		for _, d := range data {
+			if strings.HasPrefix(d, "@") {
+				return nil, fmt.Errorf("cannot combine %s with other data", d)
+			}
+		}
+	}
+	joined := strings.Join(data, "&")
+
+	switch {
+	case get:
+		if joined != "" {
+			u, err := url.Parse(c.URL)
+			if err != nil {
+				return nil, err
+			}
+			if u.RawQuery != "" {
+				u.RawQuery += "&"
+			}
+			u.RawQuery += joined
+			c.URL = u.String()
+		}
+		if c.Method == "" {
+			c.Method = http.MethodGet
+		}
+	default:
+		c.Data = joined
+		if c.Method == "" {
+			if joined != "" || len(c.Form) > 0 {
+				c.Method = http.MethodPost
+			} else {
+				c.Method = http.MethodGet
+			}
+		}
+	}
+	return c, nil
+}
+
+// checkGroupedFlags accepts grouped value-less short options such as -sSL.
+func checkGroupedFlags(arg string) error {
+	for _, r := range arg[1:] {
+		if takesValue, ok := curlIgnored["-"+string(r)]; !ok || takesValue {
+			return fmt.Errorf("unsupported curl option %s", arg)
+		}
+	}
+	return nil
+}
+
+// urlencodeData implements the common --data-urlencode forms: "content",
+// "=content" and "name=content".
+func urlencodeData(v string) string {
+	name, content, ok := strings.Cut(v, "=")
+	if !ok {
+		return url.QueryEscape(v)
+	}
+	if name == "" {
+		return url.QueryEscape(content)
+	}
+	return name + "=" + url.QueryEscape(content)
+}
+
+// SplitShell splits a POSIX shell command line into words. It understands single
+// and double quotes, backslash escapes and line continuations, which covers the
+// curl examples found in API docs. It does not expand variables.
+func SplitShell(s string) ([]string, error) {
+	return SplitShellExpand(s, nil)
+}
+
+// SplitShellExpand is SplitShell with the unquoted and double-quoted text of
+// each word passed through expand, as a shell expands variables there: text in
+// single quotes and backslash-escaped characters are taken literally. A nil
+// expand leaves the text as is.
+func SplitShellExpand(s string, expand func(string) (string, error)) ([]string, error) {
+	var words []string
+	var cur, raw strings.Builder
+	inWord := false
+	// flush moves the text awaiting expansion into the word.
+	flush := func() error {
+		text := raw.String()
+		raw.Reset()
+		if expand != nil && text != "" {
+			var err error
+			if text, err = expand(text); err != nil {
+				return err
+			}
+		}
+		cur.WriteString(text)
+		return nil
+	}
+	literal := func(text string) error {
+		if err := flush(); err != nil {
+			return err
+		}
+		cur.WriteString(text)
+		return nil
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			if s[i] == '\n' {
+				continue
+			}
+			if err := literal(s[i : i+1]); err != nil {
+				return nil, err
+			}
+			inWord = true
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			if err := literal(s[i+1 : i+1+j]); err != nil {
+				return nil, err
+			}
+			i += j + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+					if err := literal(s[i : i+1]); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				raw.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			raw.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// ShellJoin quotes and joins words into a command line.
+func ShellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellQuote(w)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,76 @@
+package snippet
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitShell(t *testing.T) {
+	got, err := SplitShell("curl --request POST \\\n  --url 'https://x/y?a=1&b=2' \\\n  -H \"Authorization: Bearer $TOKEN\" -d '{\"it'\\''s\": \"ok\"}' a\\ b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"curl", "--request", "POST", "--url", "https://x/y?a=1&b=2", "-H", "Authorization: Bearer $TOKEN", "-d", `{"it's": "ok"}`, "a b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	if _, err := SplitShell(`curl 'unterminated`); err == nil {
+		t.Fatal("expected an error for an unterminated quote")
+	}
+}
+
+func TestSplitShellExpand(t *testing.T) {
+	expand := func(text string) (string, error) {
+		if strings.Contains(text, "$BAD") {
+			return "", errors.New("bad")
+		}
+		return strings.ReplaceAll(text, "$X", "v w"), nil
+	}
+	got, err := SplitShellExpand(`a $X '$X' "$X y" \$X "\$X" pre$X'$X'`, expand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "v w", "$X", "v w y", "$X", "$X", "prev w$X"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	if _, err := SplitShellExpand(`a "$BAD"`, expand); err == nil {
+		t.Fatal("expected the expand error")
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	c, err := ParseCurl([]string{"curl", "-sSL", "-XPUT", "https://x/y", "-H", "Content-Type: application/json", "--data", `{"a":1}`, "-o", "out.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Method != http.MethodPut || c.URL != "https://x/y" || c.Data != `{"a":1}` || c.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected parse: %+v", c)
+	}
+
+	c, err = ParseCurl([]string{"curl", "-G", "https://x/y?a=1", "-d", "limit=5", "--data-urlencode", "q=a b", "-u", "tok:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Method != http.MethodGet || c.URL != "https://x/y?a=1&limit=5&q=a+b" || c.Data != "" || c.User != "tok:" {
+		t.Fatalf("unexpected -G parse: %+v", c)
+	}
+
+	c, err = ParseCurl([]string{"https://x/upload", "-F", "file=@w9.pdf", "--form-string", "note=@literal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantForm := []FormField{{Name: "file", Value: "w9.pdf", File: true}, {Name: "note", Value: "@literal"}}
+	if c.Method != http.MethodPost || !reflect.DeepEqual(c.Form, wantForm) {
+		t.Fatalf("unexpected form parse: %+v", c)
+	}
+
+	for _, args := range [][]string{{"curl"}, {"curl", "--proxy", "p", "https://x"}, {"curl", "-H"}} {
+		if _, err := ParseCurl(args); err == nil {
+			t.Errorf("ParseCurl(%q) succeeded, want error", args)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package snippet renders a resolved HTTP request as a curl, HTTPie or Go
+// program that reproduces it. The API token is never included: Authorization is
+// rewritten to read $MERCURY_TOKEN.
+package snippet
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Formats lists the accepted values for Render.
+var Formats = []string{"curl", "httpie", "go"}
+
+// TokenEnv is the environment variable snippets read the token from.
+const TokenEnv = "MERCURY_TOKEN"
+
+// Request is a fully resolved request.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	// Body is the encoded body. It is ignored when Form is set.
+	Body []byte
+	// Form holds multipart/form-data fields so file uploads can be rendered as
+	// file references rather than inlined bytes.
+	Form []FormField
+}
+
+// FormField is one multipart field. For files, Value is the local path.
+type FormField struct {
+	Name  string
+	Value string
+	File  bool
+}
+
+// Render returns the snippet for format, one of Formats.
+func Render(format string, r Request) (string, error) {
+	switch format {
+	case "curl":
+		return Curl(r), nil
+	case "httpie":
+		return HTTPie(r), nil
+	case "go":
+		return Go(r)
+	}
+	return "", fmt.Errorf("unknown snippet format %q", format)
+}
+
+// authScheme reports how the request authenticates: "bearer", "basic" or "".
+func authScheme(h http.Header) string {
+	v := h.Get("Authorization")
+	switch {
+	case strings.HasPrefix(v, "Bearer "):
+		return "bearer"
+	case strings.HasPrefix(v, "Basic "):
+		return "basic"
+	}
+	return ""
+}
+
+// headers returns the headers worth reproducing in sorted order. Authorization
+// is handled separately; User-Agent and Content-Length are left to the tool, as
+// is the multipart Content-Type, whose boundary the tool chooses.
+func (r Request) headers() [][2]string {
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var out [][2]string
+	for _, k := range keys {
+		switch http.CanonicalHeaderKey(k) {
+		case "Authorization", "User-Agent", "Content-Length":
+			continue
+		case "Content-Type":
+			if len(r.Form) > 0 {
+				continue
+			}
+		}
+		for _, v := range r.Header[k] {
+			out = append(out, [2]string{k, v})
+		}
+	}
+	return out
+}
+
+// shellQuote quotes s for POSIX shells, leaving simple words bare.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@%+,=") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Curl renders r as a curl command.
+func Curl(r Request) string {
+	first := "curl"
+	// A body would otherwise make curl default to POST.
+	if r.Method != http.MethodGet || len(r.Body) > 0 || len(r.Form) > 0 {
+		first += " -X " + r.Method
+	}
+	args := []string{first + " " + shellQuote(r.URL)}
+	for _, h := range r.headers() {
+		args = append(args, "-H "+shellQuote(h[0]+": "+h[1]))
+	}
+	switch authScheme(r.Header) {
+	case "bearer":
+		args = append(args, `-H "Authorization: Bearer $`+TokenEnv+`"`)
+	case "basic":
+		args = append(args, `-u "$`+TokenEnv+`:"`)
+	}
+	switch {
+	case len(r.Form) > 0:
+		for _, f := range r.Form {
+			if f.File {
+				args = append(args, "-F "+shellQuote(f.Name+"=@"+f.Value))
+			} else {
+				args = append(args, "--form-string "+shellQuote(f.Name+"="+f.Value))
+			}
+		}
+	case len(r.Body) > 0:
+		args = append(args, "--data-raw "+shellQuote(string(r.Body)))
+	}
+	return strings.Join(args, " \\\n  ") + "\n"
+}
+
+// HTTPie renders r as an HTTPie command.
+func HTTPie(r Request) string {
+	first := "http"
+	switch {
+	case len(r.Form) > 0:
+		first += " --multipart"
+	case len(r.Body) > 0:
+		first += " --raw " + shellQuote(string(r.Body))
+	}
+	if authScheme(r.Header) == "basic" {
+		first += ` -a "$` + TokenEnv + `:"`
+	}
+	args := []string{first + " " + r.Method + " " + shellQuote(r.URL)}
+	for _, h := range r.headers() {
+		args = append(args, shellQuote(h[0]+":"+h[1]))
+	}
+	if authScheme(r.Header) == "bearer" {
+		args = append(args, `"Authorization:Bearer $`+TokenEnv+`"`)
+	}
+	for _, f := range r.Form {
+		if f.File {
+			args = append(args, shellQuote(f.Name+"@"+f.Value))
+		} else {
+			args = append(args, shellQuote(f.Name+"="+f.Value))
+		}
+	}
+	return strings.Join(args, " \\\n  ") + "\n"
+}
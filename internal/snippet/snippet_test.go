@@ -0,0 +1,87 @@
+package snippet
+
+import (
+	"go/parser"
+	"go/token"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func jsonRequest() Request {
+	return Request{
+		Method: http.MethodPost,
+		URL:    "https://api.mercury.com/api/v1/recipients?x=1&y=it's",
+		Header: http.Header{
+			"Accept":        {"application/json"},
+			"Authorization": {"Bearer secret"},
+			"Content-Type":  {"application/json"},
+			"User-Agent":    {"mercury-cli/dev"},
+		},
+		Body: []byte(`{"name":"Acme's"}`),
+	}
+}
+
+func TestCurl(t *testing.T) {
+	got := Curl(jsonRequest())
+	want := `curl -X POST 'https://api.mercury.com/api/v1/recipients?x=1&y=it'\''s' \
+  -H 'Accept: application/json' \
+  -H 'Content-Type: application/json' \
+  -H "Authorization: Bearer $MERCURY_TOKEN" \
+  --data-raw '{"name":"Acme'\''s"}'
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	r := Request{
+		Method: http.MethodPost,
+		URL:    "https://api.mercury.com/api/v1/recipient/r1/attachments",
+		Header: http.Header{"Authorization": {"Basic c2VjcmV0Og=="}, "Content-Type": {"multipart/form-data; boundary=x"}},
+		Body:   []byte("--x\r\n..."),
+		Form:   []FormField{{Name: "file", Value: "./w 9.pdf", File: true}, {Name: "fileType", Value: "@taxForm"}},
+	}
+	got = Curl(r)
+	want = `curl -X POST https://api.mercury.com/api/v1/recipient/r1/attachments \
+  -u "$MERCURY_TOKEN:" \
+  -F 'file=@./w 9.pdf' \
+  --form-string fileType=@taxForm
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHTTPie(t *testing.T) {
+	got := HTTPie(jsonRequest())
+	want := `http --raw '{"name":"Acme'\''s"}' POST 'https://api.mercury.com/api/v1/recipients?x=1&y=it'\''s' \
+  Accept:application/json \
+  Content-Type:application/json \
+  "Authorization:Bearer $MERCURY_TOKEN"
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGo(t *testing.T) {
+	for _, r := range []Request{
+		jsonRequest(),
+		{Method: http.MethodGet, URL: "https://api.mercury.com/api/v1/accounts", Header: http.Header{"Authorization": {"Basic x"}}},
+		{Method: http.MethodPost, URL: "https://example.test/upload", Header: http.Header{}, Form: []FormField{{Name: "file", Value: "a.pdf", File: true}, {Name: "kind", Value: "w9"}}},
+	} {
+		src, err := Go(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "main.go", src, 0); err != nil {
+			t.Fatalf("generated Go does not parse: %v\n%s", err, src)
+		}
+		if strings.Contains(src, "secret") {
+			t.Fatalf("token leaked into snippet:\n%s", src)
+		}
+		if r.Header.Get("Authorization") != "" && !strings.Contains(src, `os.Getenv("MERCURY_TOKEN")`) {
+			t.Fatalf("expected the token to come from $MERCURY_TOKEN:\n%s", src)
+		}
+	}
+}
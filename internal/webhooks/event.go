@@ -0,0 +1,128 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+// resourceSchemas names the schema describing each event resource type.
+var resourceSchemas = map[string]string{
+	"transaction":       "Transaction",
+	"checkingAccount":   "Account",
+	"savingsAccount":    "Account",
+	"investmentAccount": "Account",
+	"treasuryAccount":   "TreasuryAccount",
+	"creditAccount":     "CreditAccount",
+}
+
+// EventTypes returns the webhook event types declared by spec's
+// WebhookEventType schema, or nil when spec has none.
+func EventTypes(spec *openapi.Spec) []string {
+	schema, ok := spec.ResolveSchemaRef("#/components/schemas/WebhookEventType")
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, v := range schema.Enum {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// SynthesizeEvent builds an ApiEventResponse payload for eventType that
+// occurred at at. The event and its resource are synthesized from spec's
+// schemas with openapi's Example, so the same seed yields the same IDs.
+//
+// Created events carry the whole resource in mergePatch; transaction updates
+// move a pending transaction to sent and balance updates credit the account,
+// with the old values in previousValues.
+func SynthesizeEvent(spec *openapi.Spec, eventType, seed string, at time.Time) ([]byte, error) {
+	schema, ok := spec.ResolveSchemaRef("#/components/schemas/ApiEventResponse")
+	if !ok {
+		return nil, fmt.Errorf("spec has no ApiEventResponse schema")
+	}
+	types := EventTypes(spec)
+	resource, op, ok := parseEventType(eventType)
+	if !ok || resourceSchemas[resource] == "" || (len(types) > 0 && !slices.Contains(types, eventType)) {
+		return nil, fmt.Errorf("unknown event type %q (expected one of: %s)", eventType, strings.Join(types, ", "))
+	}
+	ev, _ := spec.Example(schema, seed).(map[string]any)
+	if ev == nil {
+		return nil, fmt.Errorf("cannot synthesize an ApiEventResponse")
+	}
+	var obj map[string]any
+	if rs, ok := spec.ResolveSchemaRef("#/components/schemas/" + resourceSchemas[resource]); ok {
+		obj, _ = spec.Example(rs, seed+"/resource").(map[string]any)
+	}
+	if obj == nil {
+		obj = map[string]any{}
+	}
+	// The UUID schema's example is all zeros; derive distinct IDs from the seed.
+	ev["id"] = openapi.ExampleUUID(seed + "/event")
+	ev["resourceId"] = openapi.ExampleUUID(seed + "/" + resource)
+	obj["id"] = ev["resourceId"]
+
+	occurred := at.UTC().Format(time.RFC3339)
+	ev["resourceType"] = resource
+	ev["operationType"] = op
+	ev["occurredAt"] = occurred
+
+	var patch, previous map[string]any
+	switch {
+	case op == "create":
+		ev["resourceVersion"] = float64(1)
+		if resource == "transaction" {
+			obj["status"] = "pending"
+			obj["createdAt"] = occurred
+			obj["postedAt"] = nil
+			obj["failedAt"] = nil
+			obj["reasonForFailure"] = nil
+		}
+		patch = obj
+	case resource == "transaction":
+		ev["resourceVersion"] = float64(2)
+		patch = map[string]any{"status": "sent", "postedAt": occurred}
+		previous = map[string]any{"status": "pending", "postedAt": nil}
+	default:
+		ev["resourceVersion"] = float64(2)
+		patch, previous = map[string]any{}, map[string]any{}
+		for _, k := range []string{"availableBalance", "currentBalance"} {
+			old, _ := obj[k].(float64)
+			previous[k] = old
+			patch[k] = old + 250
+		}
+	}
+	ev["mergePatch"] = patch
+	ev["changedPaths"] = slices.Sorted(maps.Keys(patch))
+	ev["previousValues"] = previous // null for created events
+	return json.Marshal(ev)
+}
+
+// parseEventType splits an event type into its resource and operation:
+// transaction.created is (transaction, create) and
+// checkingAccount.balance.updated is (checkingAccount, update).
+func parseEventType(eventType string) (resource, op string, ok bool) {
+	i := strings.IndexByte(eventType, '.')
+	j := strings.LastIndexByte(eventType, '.')
+	if i <= 0 {
+		return "", "", false
+	}
+	resource = eventType[:i]
+	switch eventType[j+1:] {
+	case "created":
+		op = "create"
+	case "updated":
+		op = "update"
+	default:
+		return "", "", false
+	}
+	return resource, op, true
+}
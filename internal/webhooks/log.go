@@ -0,0 +1,165 @@
+package webhooks
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Delivery is one received webhook, as kept in the NDJSON log.
+type Delivery struct {
+	ReceivedAt time.Time         `json:"received_at"`
+	Verified   bool              `json:"verified"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Body is the payload exactly as received, so that its recorded signature
+	// still verifies when it is replayed.
+	Body []byte `json:"-"`
+}
+
+// loggedDelivery is a Delivery as written to the log. The body is kept as a
+// string, base64-encoded when it is not valid UTF-8, rather than as embedded
+// JSON, which encoding/json would compact and re-escape.
+type loggedDelivery struct {
+	ReceivedAt time.Time         `json:"received_at"`
+	Verified   bool              `json:"verified"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       json.RawMessage   `json:"body"`
+	Encoding   string            `json:"body_encoding,omitempty"` // base64
+}
+
+func (d Delivery) MarshalJSON() ([]byte, error) {
+	l := loggedDelivery{ReceivedAt: d.ReceivedAt, Verified: d.Verified, Headers: d.Headers}
+	body := string(d.Body)
+	if !utf8.Valid(d.Body) {
+		body, l.Encoding = base64.StdEncoding.EncodeToString(d.Body), "base64"
+	}
+	var err error
+	if l.Body, err = json.Marshal(body); err != nil {
+		return nil, err
+	}
+	return json.Marshal(l)
+}
+
+// UnmarshalJSON also reads logs written before bodies were stored as strings,
+// where the body is embedded JSON.
+func (d *Delivery) UnmarshalJSON(b []byte) error {
+	var l loggedDelivery
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*d = Delivery{ReceivedAt: l.ReceivedAt, Verified: l.Verified, Headers: l.Headers}
+	if len(l.Body) == 0 || l.Body[0] != '"' {
+		d.Body = []byte(l.Body)
+		return nil
+	}
+	var body string
+	if err := json.Unmarshal(l.Body, &body); err != nil {
+		return err
+	}
+	switch l.Encoding {
+	case "":
+		d.Body = []byte(body)
+	case "base64":
+		raw, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return fmt.Errorf("body: %w", err)
+		}
+		d.Body = raw
+	default:
+		return fmt.Errorf("unknown body_encoding %q", l.Encoding)
+	}
+	return nil
+}
+
+// keptHeaders are the request headers recorded with a delivery and sent again
+// when it is forwarded or replayed.
+func keptHeaders(h http.Header, signatureHeader string) map[string]string {
+	out := map[string]string{}
+	for k, vv := range h {
+		ck := http.CanonicalHeaderKey(k)
+		if ck == "Content-Type" || ck == "User-Agent" || strings.HasPrefix(ck, "Mercury-") || strings.EqualFold(ck, signatureHeader) {
+			out[ck] = strings.Join(vv, ", ")
+		}
+	}
+	return out
+}
+
+// EventType returns the delivery's event type: its type or eventType field, or
+// one derived from resourceType and operationType (transaction + create is
+// transaction.created).
+func (d Delivery) EventType() string {
+	var ev map[string]any
+	if json.Unmarshal(d.Body, &ev) != nil {
+		return ""
+	}
+	for _, k := range []string{"type", "eventType"} {
+		if s, ok := ev[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	resource, _ := ev["resourceType"].(string)
+	op, _ := ev["operationType"].(string)
+	if resource == "" || op == "" {
+		return ""
+	}
+	if strings.HasSuffix(resource, "Account") && op == "update" {
+		return resource + ".balance.updated"
+	}
+	return resource + "." + strings.TrimSuffix(op, "e") + "ed"
+}
+
+// EventID returns the delivery's id field.
+func (d Delivery) EventID() string {
+	var ev struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(d.Body, &ev)
+	return ev.ID
+}
+
+// AppendLog appends d to the NDJSON log at path.
+func AppendLog(path string, d Delivery) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadLog returns the deliveries in the NDJSON log at path, oldest first.
+func ReadLog(path string) ([]Delivery, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Delivery
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxBodyBytes*2)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var d Delivery
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		out = append(out, d)
+	}
+	return out, sc.Err()
+}
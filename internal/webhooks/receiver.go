@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxBodyBytes caps the size of a delivery.
+const maxBodyBytes = 1 << 20
+
+// DefaultSendTimeout bounds a forward or replay sent with a nil client. The
+// receiver forwards one delivery at a time, so a target that never answers
+// would otherwise hold up every later delivery.
+const DefaultSendTimeout = 30 * time.Second
+
+var defaultClient = &http.Client{Timeout: DefaultSendTimeout}
+
+// Receiver is an http.Handler for webhook deliveries. Each delivery is
+// verified, appended to the log, forwarded and handed to OnDelivery, one at a
+// time and in arrival order.
+type Receiver struct {
+	// Secret verifies signatures. When empty, deliveries are accepted unverified.
+	Secret string
+	// SignatureHeader defaults to SignatureHeader.
+	SignatureHeader string
+	// Tolerance bounds the age of signed timestamps; see Verify.
+	Tolerance time.Duration
+	// AllowLegacy also accepts untimestamped signatures; see VerifyLegacy.
+	AllowLegacy bool
+
+	// LogPath, when set, is the NDJSON log verified deliveries are appended to.
+	LogPath string
+	// Forward, when set, is a URL verified deliveries are POSTed to. Its status
+	// is returned to the sender, so a failing local handler gets redelivered.
+	Forward string
+	// Client sends forwarded deliveries; nil means a client with
+	// DefaultSendTimeout.
+	Client *http.Client
+
+	// OnDelivery is called for each accepted delivery with the status returned
+	// by Forward (0 when not forwarding) or the error forwarding it.
+	OnDelivery func(d Delivery, forwardStatus int, forwardErr error) error
+	// OnReject is called for each rejected delivery.
+	OnReject func(r *http.Request, err error)
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+func (rc *Receiver) header() string {
+	if rc.SignatureHeader != "" {
+		return rc.SignatureHeader
+	}
+	return SignatureHeader
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		rc.reject(w, req, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err != nil {
+		rc.reject(w, req, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	now := time.Now
+	if rc.now != nil {
+		now = rc.now
+	}
+	d := Delivery{ReceivedAt: now().UTC(), Headers: keptHeaders(req.Header, rc.header()), Body: body}
+	if rc.Secret != "" {
+		sig := req.Header.Get(rc.header())
+		verify := func() error { return Verify(rc.Secret, sig, body, now(), rc.Tolerance) }
+		if rc.AllowLegacy && IsLegacy(sig) {
+			verify = func() error { return VerifyLegacy(rc.Secret, sig, body) }
+		}
+		if err := verify(); err != nil {
+			rc.reject(w, req, http.StatusUnauthorized, err)
+			return
+		}
+		d.Verified = true
+	}
+	if !json.Valid(body) {
+		rc.reject(w, req, http.StatusBadRequest, errors.New("payload is not valid JSON"))
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.LogPath != "" {
+		if err := AppendLog(rc.LogPath, d); err != nil {
+			rc.reject(w, req, http.StatusInternalServerError, fmt.Errorf("append to log: %w", err))
+			return
+		}
+	}
+	status := 0
+	var forwardErr error
+	if rc.Forward != "" {
+		status, forwardErr = Send(req.Context(), rc.Client, rc.Forward, d, nil)
+	}
+	if rc.OnDelivery != nil {
+		if err := rc.OnDelivery(d, status, forwardErr); err != nil {
+			rc.reject(w, req, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	switch {
+	case forwardErr != nil:
+		status = http.StatusBadGateway
+	case status == 0:
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *Receiver) reject(w http.ResponseWriter, req *http.Request, status int, err error) {
+	if rc.OnReject != nil {
+		rc.OnReject(req, err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// Send POSTs d's body to url with its recorded headers, replacing or adding
+// those in override (e.g. a fresh signature), and returns the response status.
+// A nil client means one with DefaultSendTimeout.
+func Send(ctx context.Context, client *http.Client, url string, d Delivery, override map[string]string) (int, error) {
+	if client == nil {
+		client = defaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range d.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range override {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
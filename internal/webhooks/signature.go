@@ -0,0 +1,104 @@
+// Package webhooks receives, verifies, logs and re-sends Mercury webhook
+// deliveries for local development.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header carrying a delivery's signature.
+const SignatureHeader = "Mercury-Signature"
+
+// DefaultTolerance is how old a signed timestamp may be before the delivery is
+// rejected as a possible replay.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrNoSignature       = errors.New("missing signature")
+	ErrSignatureMismatch = errors.New("signature does not match the payload")
+)
+
+// Sign returns the signature header value for body delivered at t:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">".
+func Sign(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, []byte(ts+"."), body)
+}
+
+func mac(secret string, parts ...[]byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks a signature header of the form written by Sign against body,
+// and its timestamp against now within tolerance (zero disables the check).
+// Several v1 entries are allowed while a secret is being rotated.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return ErrNoSignature
+	}
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, strings.ToLower(v))
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return fmt.Errorf("malformed signature header %q", header)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed signature timestamp %q", ts)
+	}
+	want := mac(secret, []byte(ts+"."), body)
+	matched := false
+	for _, s := range sigs {
+		if hmac.Equal([]byte(s), []byte(want)) {
+			matched = true
+		}
+	}
+	if !matched {
+		return ErrSignatureMismatch
+	}
+	if age := now.Sub(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("signature timestamp is %s off, outside the %s tolerance", age.Round(time.Second), tolerance)
+	}
+	return nil
+}
+
+// IsLegacy reports whether header is a bare hex HMAC-SHA256 of the body,
+// optionally prefixed with "sha256=", rather than the timestamped form.
+func IsLegacy(header string) bool {
+	header = strings.TrimSpace(header)
+	return header != "" && (!strings.Contains(header, "=") || strings.HasPrefix(header, "sha256="))
+}
+
+// VerifyLegacy checks a legacy signature header (see IsLegacy) against body.
+// It carries no timestamp, so a captured delivery can be replayed at will.
+func VerifyLegacy(secret, header string, body []byte) error {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return ErrNoSignature
+	}
+	got := strings.TrimPrefix(header, "sha256=")
+	if !hmac.Equal([]byte(strings.ToLower(got)), []byte(mac(secret, body))) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tarrence/mercury-cli/internal/openapi"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"e1"}`)
+	now := time.Unix(1767225600, 0)
+	sig := Sign("whsec", body, now)
+	if !strings.HasPrefix(sig, "t=1767225600,v1=") {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+	if err := Verify("whsec", sig, body, now.Add(time.Minute), DefaultTolerance); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	// Rotated secrets: any v1 may match.
+	if err := Verify("whsec", "t=1767225600,v1=00ff,"+strings.TrimPrefix(sig, "t=1767225600,"), body, now, DefaultTolerance); err != nil {
+		t.Fatalf("Verify with two signatures: %v", err)
+	}
+	if err := Verify("other", sig, body, now, DefaultTolerance); err != ErrSignatureMismatch {
+		t.Fatalf("wrong secret: %v", err)
+	}
+	if err := Verify("whsec", sig, []byte(`{"id":"e2"}`), now, DefaultTolerance); err != ErrSignatureMismatch {
+		t.Fatalf("tampered body: %v", err)
+	}
+	if err := Verify("whsec", sig, body, now.Add(time.Hour), DefaultTolerance); err == nil || !strings.Contains(err.Error(), "tolerance") {
+		t.Fatalf("stale timestamp: %v", err)
+	}
+	if err := Verify("whsec", sig, body, now.Add(time.Hour), 0); err != nil {
+		t.Fatalf("tolerance 0 should skip the age check: %v", err)
+	}
+	if err := Verify("whsec", "", body, now, DefaultTolerance); err != ErrNoSignature {
+		t.Fatalf("missing header: %v", err)
+	}
+
+	// Bare body HMACs carry no timestamp: only VerifyLegacy accepts them.
+	bare := mac("whsec", body)
+	for _, h := range []string{bare, "sha256=" + bare, strings.ToUpper(bare)} {
+		if err := Verify("whsec", h, body, now, DefaultTolerance); err == nil {
+			t.Fatalf("Verify(%q) accepted an untimestamped signature", h)
+		}
+		if !IsLegacy(h) {
+			t.Fatalf("IsLegacy(%q) = false", h)
+		}
+		if err := VerifyLegacy("whsec", h, body); err != nil {
+			t.Fatalf("VerifyLegacy(%q): %v", h, err)
+		}
+	}
+	if IsLegacy(sig) {
+		t.Fatalf("IsLegacy(%q) = true", sig)
+	}
+	if err := VerifyLegacy("other", bare, body); err != ErrSignatureMismatch {
+		t.Fatalf("wrong secret: %v", err)
+	}
+}
+
+func TestEventType(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"type":"transaction.updated"}`:                              "transaction.updated",
+		`{"resourceType":"transaction","operationType":"create"}`:     "transaction.created",
+		`{"resourceType":"checkingAccount","operationType":"update"}`: "checkingAccount.balance.updated",
+		`{"id":"x"}`: "",
+	} {
+		if got := (Delivery{Body: []byte(body)}).EventType(); got != want {
+			t.Fatalf("EventType(%s) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	var forwarded []string
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, r.Header.Get(SignatureHeader)+" "+string(b))
+		if strings.Contains(string(b), "boom") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(app.Close)
+
+	now := time.Unix(1767225600, 0)
+	logPath := filepath.Join(t.TempDir(), "events.ndjson")
+	var delivered []string
+	var rejected []error
+	rc := &Receiver{
+		Secret:  "whsec",
+		LogPath: logPath,
+		Forward: app.URL,
+		OnDelivery: func(d Delivery, status int, err error) error {
+			delivered = append(delivered, d.EventID())
+			return err
+		},
+		OnReject: func(_ *http.Request, err error) { rejected = append(rejected, err) },
+		now:      func() time.Time { return now },
+	}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	post := func(body, sig string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/hooks", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sig != "" {
+			req.Header.Set(SignatureHeader, sig)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	ok := `{"id":"e1","resourceType":"transaction","operationType":"create"}`
+	if code := post(ok, Sign("whsec", []byte(ok), now)); code != http.StatusOK {
+		t.Fatalf("signed delivery: %d", code)
+	}
+	if code := post(ok, Sign("nope", []byte(ok), now)); code != http.StatusUnauthorized {
+		t.Fatalf("bad signature: %d", code)
+	}
+	if code := post(ok, ""); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned delivery: %d", code)
+	}
+	boom := `{"id":"e2","boom":true}`
+	if code := post(boom, Sign("whsec", []byte(boom), now)); code != http.StatusInternalServerError {
+		t.Fatalf("the forward's status should be returned, got %d", code)
+	}
+
+	if len(delivered) != 2 || len(rejected) != 2 || len(forwarded) != 2 {
+		t.Fatalf("delivered=%v rejected=%v forwarded=%v", delivered, rejected, forwarded)
+	}
+	if !strings.HasPrefix(forwarded[0], "t=1767225600,v1=") {
+		t.Fatalf("forward should keep the signature: %q", forwarded[0])
+	}
+
+	logged, err := ReadLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 2 || !logged[0].Verified || logged[0].EventType() != "transaction.created" || string(logged[1].Body) != boom {
+		t.Fatalf("unexpected log: %+v", logged)
+	}
+	if logged[0].Headers[SignatureHeader] == "" || !logged[0].ReceivedAt.Equal(now) {
+		t.Fatalf("log entry missing signature or time: %+v", logged[0])
+	}
+
+	// Untimestamped signatures only with AllowLegacy.
+	legacy := "sha256=" + mac("whsec", []byte(ok))
+	if code := post(ok, legacy); code != http.StatusUnauthorized {
+		t.Fatalf("legacy signature without AllowLegacy: %d", code)
+	}
+	rc.AllowLegacy = true
+	if code := post(ok, legacy); code != http.StatusOK {
+		t.Fatalf("legacy signature with AllowLegacy: %d", code)
+	}
+	if code := post(ok, Sign("whsec", []byte(ok), now)); code != http.StatusOK {
+		t.Fatalf("signed delivery with AllowLegacy: %d", code)
+	}
+}
+
+func TestLogKeepsSignedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	now := time.Unix(1767225600, 0)
+	bodies := [][]byte{
+		[]byte(`{"counterpartyName": "AT&T <Ops>",  "amount": 1.50}`),
+		{'{', '"', 0xff, '"', ':', '1', '}'},
+	}
+	for _, b := range bodies {
+		d := Delivery{ReceivedAt: now, Headers: map[string]string{SignatureHeader: Sign("whsec", b, now)}, Body: b}
+		if err := AppendLog(path, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Logs written when bodies were embedded JSON still read.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"received_at":"2026-01-01T00:00:00Z","verified":false,"body":{"id":"e1"}}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	logged, err := ReadLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 3 || logged[2].EventID() != "e1" {
+		t.Fatalf("unexpected log: %+v", logged)
+	}
+	for i, b := range bodies {
+		if !bytes.Equal(logged[i].Body, b) {
+			t.Fatalf("body %d read back as %q, want %q", i, logged[i].Body, b)
+		}
+		if err := Verify("whsec", logged[i].Headers[SignatureHeader], logged[i].Body, now, DefaultTolerance); err != nil {
+			t.Fatalf("logged delivery %d no longer verifies: %v", i, err)
+		}
+	}
+}
+
+func TestSynthesizeEvent(t *testing.T) {
+	docs, err := openapi.LoadEmbeddedSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec *openapi.Spec
+	for _, doc := range docs {
+		if len(EventTypes(doc.Spec)) > 0 {
+			spec = doc.Spec
+		}
+	}
+	if spec == nil {
+		t.Fatal("no spec declares WebhookEventType")
+	}
+	eventSchema, _ := spec.ResolveSchemaRef("#/components/schemas/ApiEventResponse")
+	txSchema, _ := spec.ResolveSchemaRef("#/components/schemas/Transaction")
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, typ := range EventTypes(spec) {
+		body, err := SynthesizeEvent(spec, typ, "seed", at)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		if got := (Delivery{Body: body}).EventType(); got != typ {
+			t.Fatalf("%s: payload reads back as %q", typ, got)
+		}
+		var ev map[string]any
+		if err := json.Unmarshal(body, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if errs := spec.Validate(eventSchema, ev); len(errs) > 0 {
+			t.Fatalf("%s does not match ApiEventResponse: %v", typ, errs)
+		}
+		if ev["occurredAt"] != "2026-01-02T03:04:05Z" || len(ev["changedPaths"].([]any)) == 0 {
+			t.Fatalf("%s: unexpected event %s", typ, body)
+		}
+		if typ == "transaction.created" {
+			if errs := spec.Validate(txSchema, ev["mergePatch"]); len(errs) > 0 {
+				t.Fatalf("created transaction does not match Transaction: %v", errs)
+			}
+		}
+		again, _ := SynthesizeEvent(spec, typ, "seed", at)
+		other, _ := SynthesizeEvent(spec, typ, "other", at)
+		if string(again) != string(body) || (Delivery{Body: other}).EventID() == (Delivery{Body: body}).EventID() {
+			t.Fatalf("%s: IDs should follow the seed", typ)
+		}
+	}
+
+	if _, err := SynthesizeEvent(spec, "transaction.deleted", "seed", at); err == nil || !strings.Contains(err.Error(), "transaction.created") {
+		t.Fatalf("expected an unknown event type error listing the types, got %v", err)
+	}
+}
+
+func TestReceiverForwardTimeout(t *testing.T) {
+	release := make(chan struct{})
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(app.Close)
+	t.Cleanup(func() { close(release) })
+
+	srv := httptest.NewServer(&Receiver{Forward: app.URL, Client: &http.Client{Timeout: 50 * time.Millisecond}})
+	t.Cleanup(srv.Close)
+	start := time.Now()
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"id":"e1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || time.Since(start) > 5*time.Second {
+		t.Fatalf("hung forward: status %d after %s", resp.StatusCode, time.Since(start))
+	}
+}